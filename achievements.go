@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"html"
+	"strings"
+	"time"
+
+	"telegram-chat-bot/db"
+)
+
+// achievementState is what a badge rule sees about today's winner.
+type achievementState struct {
+	date   time.Time
+	wins   []string // win dates including today's, newest first
+	joined time.Time
+}
+
+// achievement is a badge awarded to a winner the first time earned
+// reports true. code is stored with the award and must never change.
+type achievement struct {
+	code   string
+	name   string
+	earned func(s achievementState) bool
+}
+
+const droughtDays = 100
+
+var achievements = []achievement{
+	{code: "first_win", name: TrAchievementFirstWin, earned: func(s achievementState) bool {
+		return len(s.wins) == 1
+	}},
+	{code: "streak_3", name: TrAchievementStreak3, earned: func(s achievementState) bool {
+		return winStreak(s.wins, s.date.Format("2006-01-02")) >= 3
+	}},
+	{code: "wins_10", name: TrAchievementWins10, earned: func(s achievementState) bool {
+		return len(s.wins) >= 10
+	}},
+	{code: "drought_100", name: TrAchievementDrought100, earned: func(s achievementState) bool {
+		since := s.joined
+		if len(s.wins) > 1 {
+			prev, err := time.Parse("2006-01-02", s.wins[1])
+			if err != nil {
+				return false
+			}
+			since = prev
+		}
+		return s.date.Sub(since) >= droughtDays*24*time.Hour
+	}},
+	{code: "anniversary", name: TrAchievementAnniversary, earned: func(s achievementState) bool {
+		return s.date.Year() > s.joined.Year() && s.date.Format("01-02") == s.joined.Format("01-02")
+	}},
+}
+
+// earnedAchievements lists the badges the state qualifies for, whether or
+// not they were awarded before.
+func earnedAchievements(s achievementState) []achievement {
+	var earned []achievement
+	for _, a := range achievements {
+		if a.earned(s) {
+			earned = append(earned, a)
+		}
+	}
+	return earned
+}
+
+func achievementName(tr *Translator, code string) string {
+	for _, a := range achievements {
+		if a.code == code {
+			return tr.Get(a.name)
+		}
+	}
+	return code
+}
+
+// awardAchievements stores the badges today's winner earned and announces
+// the ones they did not have yet in a single message.
+func (h *Handler) awardAchievements(ctx context.Context, chatID int64, winner db.GetParticipantsRow, date string) error {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return err
+	}
+
+	wins, err := h.storage.Queries.GetUserWinDates(ctx, db.GetUserWinDatesParams{
+		ChatID: chatID,
+		GameID: mainGameID,
+		UserID: winner.UserID,
+	})
+	if err != nil {
+		return err
+	}
+
+	membership, err := h.storage.Queries.GetMembership(ctx, db.GetMembershipParams{
+		ChatID: chatID,
+		UserID: winner.UserID,
+	})
+	if err != nil {
+		return err
+	}
+	joined, err := time.Parse("2006-01-02", membership.JoinedAt.Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, a := range earnedAchievements(achievementState{date: day, wins: wins, joined: joined}) {
+		res, err := h.storage.Queries.AwardAchievement(ctx, db.AwardAchievementParams{
+			ChatID:      chatID,
+			UserID:      winner.UserID,
+			Code:        a.code,
+			AwardedDate: date,
+		})
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			continue
+		}
+		names = append(names, h.tr.Get(a.name))
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return h.send(ctx, chatID, h.tr.Getf(TrAchievementAwarded, html.EscapeString(winner.FirstName), strings.Join(names, ", ")))
+}
+
+func (h *Handler) handleAchievements(ctx context.Context, msg *Message) error {
+	rows, err := h.storage.Queries.ListAchievements(ctx, msg.Chat.ID)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return h.send(ctx, msg.Chat.ID, h.tr.Get(TrAchievementsEmpty))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(h.tr.Get(TrAchievementsHeader))
+	for i, r := range rows {
+		if i == 0 || rows[i-1].UserID != r.UserID {
+			sb.WriteString("\n\n<b>")
+			sb.WriteString(html.EscapeString(r.FirstName))
+			sb.WriteString("</b>")
+		}
+		sb.WriteString("\n")
+		sb.WriteString(h.tr.Getf(TrAchievementsLine, achievementName(h.tr, r.Code), r.AwardedDate))
+	}
+	return h.send(ctx, msg.Chat.ID, sb.String())
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEarnedAchievements(t *testing.T) {
+	day := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name  string
+		state achievementState
+		want  []string
+	}{
+		{
+			name:  "first win",
+			state: achievementState{date: day("2026-01-15"), wins: []string{"2026-01-15"}, joined: day("2026-01-01")},
+			want:  []string{"first_win"},
+		},
+		{
+			name:  "streak",
+			state: achievementState{date: day("2026-01-15"), wins: []string{"2026-01-15", "2026-01-14", "2026-01-13"}, joined: day("2026-01-01")},
+			want:  []string{"streak_3"},
+		},
+		{
+			name:  "broken streak",
+			state: achievementState{date: day("2026-01-15"), wins: []string{"2026-01-15", "2026-01-14", "2026-01-12"}, joined: day("2026-01-01")},
+		},
+		{
+			name: "tenth win",
+			state: achievementState{date: day("2026-03-01"), joined: day("2026-01-01"), wins: []string{
+				"2026-03-01", "2026-02-20", "2026-02-18", "2026-02-16", "2026-02-14",
+				"2026-02-12", "2026-02-10", "2026-02-08", "2026-02-06", "2026-02-04",
+			}},
+			want: []string{"wins_10"},
+		},
+		{
+			name:  "drought since last win",
+			state: achievementState{date: day("2026-06-01"), wins: []string{"2026-06-01", "2026-02-20"}, joined: day("2026-01-01")},
+			want:  []string{"drought_100"},
+		},
+		{
+			name:  "drought since joining",
+			state: achievementState{date: day("2026-06-01"), wins: []string{"2026-06-01"}, joined: day("2026-01-01")},
+			want:  []string{"first_win", "drought_100"},
+		},
+		{
+			name:  "anniversary",
+			state: achievementState{date: day("2027-01-01"), wins: []string{"2027-01-01", "2026-12-30"}, joined: day("2026-01-01")},
+			want:  []string{"anniversary"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, a := range earnedAchievements(tt.state) {
+				got = append(got, a.code)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
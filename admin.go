@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+
+	"telegram-chat-bot/db"
+)
+
+// Admin commands about other players name them with a mention or by
+// replying to one of their messages; see targetUser.
+
+// handleKick removes a player from the roulette: /kick @username.
+func (h *Handler) handleKick(ctx context.Context, msg *Message) error {
+	if !h.canAdmin(msg.From.ID) {
+		return nil
+	}
+
+	chatID := msg.Chat.ID
+	user, mention, err := h.targetUser(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return h.sendTargetError(ctx, chatID, mention, TrKickUsage)
+	}
+
+	left, err := h.storage.LeaveGame(ctx, chatID, user.ID, newAudit(chatID, msg.From.ID, AuditKick, auditUser(user), nil))
+	if err != nil {
+		return err
+	}
+	if !left {
+		return h.send(ctx, chatID, h.tr.Getf(TrKickNotPlaying, html.EscapeString(user.FirstName)))
+	}
+	return h.send(ctx, chatID, h.tr.Getf(TrKickSuccess, html.EscapeString(user.FirstName)))
+}
+
+// handleAdd enrols the author of the replied-to message, or a mentioned
+// former player, in the roulette.
+func (h *Handler) handleAdd(ctx context.Context, msg *Message) error {
+	if !h.canAdmin(msg.From.ID) {
+		return nil
+	}
+
+	chatID := msg.Chat.ID
+	user, mention, err := h.targetUser(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return h.sendTargetError(ctx, chatID, mention, TrAddUsage)
+	}
+
+	playing, err := h.isPlaying(ctx, chatID, user.ID)
+	if err != nil {
+		return err
+	}
+	if playing {
+		return h.send(ctx, chatID, h.tr.Getf(TrAddAlready, html.EscapeString(user.FirstName)))
+	}
+	if err := h.storage.JoinGame(ctx, db.AddParticipantParams{
+		ChatID:    chatID,
+		UserID:    user.ID,
+		FirstName: user.FirstName,
+		Username:  user.Username,
+	}, newAudit(chatID, msg.From.ID, AuditAdd, nil, auditUser(user))); err != nil {
+		return err
+	}
+	return h.send(ctx, chatID, h.tr.Getf(TrAddSuccess, html.EscapeString(user.FirstName)))
+}
+
+// handleSetWinner corrects today's main game result: /setwinner @username
+// makes the player its winner in place of the drawn one.
+func (h *Handler) handleSetWinner(ctx context.Context, msg *Message) error {
+	if !h.canAdmin(msg.From.ID) {
+		return nil
+	}
+
+	chatID := msg.Chat.ID
+	user, mention, err := h.targetUser(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return h.sendTargetError(ctx, chatID, mention, TrSetWinnerUsage)
+	}
+
+	playing, err := h.isPlaying(ctx, chatID, user.ID)
+	if err != nil {
+		return err
+	}
+	if !playing {
+		return h.send(ctx, chatID, h.tr.Getf(TrKickNotPlaying, html.EscapeString(user.FirstName)))
+	}
+
+	date := h.todayFunc()
+	previous, ok, err := h.storage.SetWinner(ctx, chatID, mainGameID, date, user, newAudit(chatID, msg.From.ID, AuditSetWinner,
+		auditState{"date": date}, auditState{"date": date, "winner": user.FirstName, "user_id": user.ID}))
+	switch {
+	case errors.Is(err, errAlreadyWinner):
+		return h.send(ctx, chatID, h.tr.Getf(TrSetWinnerAlready, html.EscapeString(user.FirstName)))
+	case errors.Is(err, errIsLoser):
+		return h.send(ctx, chatID, h.tr.Getf(TrSetWinnerLoser, html.EscapeString(user.FirstName)))
+	case err != nil:
+		return err
+	case !ok:
+		return h.send(ctx, chatID, h.tr.Get(TrSetWinnerNoResult))
+	}
+	return h.send(ctx, chatID, h.tr.Getf(TrSetWinnerSuccess, html.EscapeString(user.FirstName), html.EscapeString(previous)))
+}
+
+// sendTargetError explains why a command names nobody: the usage when
+// there is no mention, or that the mentioned player is unknown.
+func (h *Handler) sendTargetError(ctx context.Context, chatID int64, mention, usage string) error {
+	if mention == "" {
+		return h.send(ctx, chatID, h.tr.Get(usage))
+	}
+	return h.send(ctx, chatID, h.tr.Getf(TrStatsUnknownPlayer, html.EscapeString(strings.TrimPrefix(mention, "@"))))
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"telegram-chat-bot/db"
+)
+
+// Actions stored in audit_log.action.
+const (
+	AuditJoin      = "join"
+	AuditLeave     = "leave"
+	AuditRoll      = "roll"
+	AuditReset     = "reset"
+	AuditUndo      = "undo"
+	AuditSetting   = "setting"
+	AuditWinners   = "winners"
+	AuditKick      = "kick"
+	AuditAdd       = "add"
+	AuditSetWinner = "setwinner"
+	AuditDormant   = "dormant"
+	AuditAwake     = "awake"
+	AuditAddGame   = "addgame"
+	AuditDelGame   = "delgame"
+	AuditNewSet    = "newset"
+	AuditAddStep   = "addstep"
+	AuditDelSet    = "delset"
+	AuditSetRules  = "setrules"
+	AuditBet       = "bet"
+	AuditDuel      = "duel"
+	AuditImportSet = "importset"
+	AuditTranslate = "translation"
+)
+
+// Changes made with the CLI are recorded with cliActorID as the actor.
+// Those that belong to no chat, such as global message sets and
+// translations, are recorded under globalAuditChatID.
+const (
+	cliActorID        = 0
+	globalAuditChatID = 0
+)
+
+const (
+	defaultAuditLimit = 10
+	maxAuditLimit     = 50
+)
+
+// auditState is the before or after state of an audited action, stored as
+// JSON.
+type auditState map[string]any
+
+// auditEntry records that actorID did action in a chat. It is written in
+// the transaction of the change, so the log holds every committed change
+// and nothing that was rolled back.
+type auditEntry struct {
+	chatID, actorID int64
+	action          string
+	before, after   auditState
+}
+
+func newAudit(chatID, actorID int64, action string, before, after auditState) *auditEntry {
+	return &auditEntry{chatID: chatID, actorID: actorID, action: action, before: before, after: after}
+}
+
+// cliAudit is an entry for a change made with the CLI.
+func cliAudit(chatID int64, action string, before, after auditState) *auditEntry {
+	return newAudit(chatID, cliActorID, action, before, after)
+}
+
+// record writes the entry with the queries of the change's transaction. A
+// nil state is stored as NULL.
+func (e *auditEntry) record(ctx context.Context, q *db.Queries) error {
+	return q.AddAuditEntry(ctx, db.AddAuditEntryParams{
+		ChatID:  e.chatID,
+		ActorID: e.actorID,
+		Action:  e.action,
+		Before:  auditJSON(e.before),
+		After:   auditJSON(e.after),
+	})
+}
+
+func auditJSON(s auditState) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(b), Valid: true}
+}
+
+// auditUser is the state of a player an action was about.
+func auditUser(u *User) auditState {
+	return auditState{"user_id": u.ID, "name": u.FirstName}
+}
+
+// auditDay is the state of a game's day with its winners in rank order.
+func auditDay(g db.Game, date string, winnerIDs []int64) auditState {
+	return auditState{"game": g.Command, "date": date, "winners": winnerIDs}
+}
+
+// auditGame is the state of a named game.
+func auditGame(command, title string, shared bool) auditState {
+	return auditState{"game": command, "title": title, "shared": shared}
+}
+
+// auditSetRules is the state of a chat's message set with its rules as
+// /setrules takes them.
+func auditSetRules(setID, weight int64, from, to sql.NullString, weekdays int64) auditState {
+	return auditState{"set": setID, "rules": formatSetRules(weight, from, to, weekdays)}
+}
+
+// resultWinnerIDs returns the winners of a day's results in rank order.
+func resultWinnerIDs(results []db.GetTodayResultsRow) []int64 {
+	ids := make([]int64, len(results))
+	for i, r := range results {
+		ids[i] = r.UserID
+	}
+	return ids
+}
+
+// handleAudit lists the latest audit entries of the chat: /audit [n].
+func (h *Handler) handleAudit(ctx context.Context, msg *Message) error {
+	if !h.canAdmin(msg.From.ID) {
+		return nil
+	}
+
+	chatID := msg.Chat.ID
+	limit := int64(defaultAuditLimit)
+	if arg := extractArgs(msg); arg != "" {
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			return h.send(ctx, chatID, h.tr.Getf(TrAuditUsage, maxAuditLimit))
+		}
+		limit = n
+	}
+
+	rows, err := h.storage.Queries.ListRecentAudit(ctx, db.ListRecentAuditParams{ChatID: chatID, Limit: limit})
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return h.send(ctx, chatID, h.tr.Get(TrAuditEmpty))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(h.tr.Get(TrAuditHeader))
+	sb.WriteString("\n")
+	for _, r := range rows {
+		actor := h.tr.Getf(TrUnknownUser, r.ActorID)
+		switch {
+		case r.ActorID == cliActorID:
+			actor = h.tr.Get(TrAuditCLI)
+		case r.FirstName.Valid:
+			actor = html.EscapeString(r.FirstName.String)
+		}
+		sb.WriteString("\n")
+		sb.WriteString(h.tr.Getf(TrAuditLine, r.CreatedAt.UTC().Format(time.DateTime), actor, r.Action,
+			auditChange(r.Before, r.After)))
+	}
+	return h.send(ctx, chatID, sb.String())
+}
+
+// auditChange renders the states of an entry as "before → after", leaving
+// out the missing ones.
+func auditChange(before, after sql.NullString) string {
+	var parts []string
+	if before.Valid {
+		parts = append(parts, "<code>"+html.EscapeString(before.String)+"</code>")
+	}
+	if after.Valid {
+		parts = append(parts, "<code>"+html.EscapeString(after.String)+"</code>")
+	}
+	return strings.Join(parts, " → ")
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+
+	"telegram-chat-bot/db"
+)
+
+// Players bet points on who wins the day's main game roll. The stake is
+// taken when the bet is placed. The roll settles the day's open bets in its
+// own transaction, so a bet either made it in before the roll or was
+// rejected because the result already exists.
+
+// Bet states stored in bets.status.
+const (
+	BetOpen     = "open"
+	BetWon      = "won"
+	BetLost     = "lost"
+	BetRefunded = "refunded"
+)
+
+// Ledger entry reasons of bets.
+const (
+	LedgerStake  = "stake"
+	LedgerPayout = "payout"
+	LedgerRefund = "refund"
+)
+
+var (
+	errBetExists       = errors.New("bet already placed")
+	errBetsClosed      = errors.New("bets closed")
+	errBetInsufficient = errors.New("insufficient balance")
+)
+
+// betOutcome is how a roll settled a bet.
+type betOutcome struct {
+	bet    db.ListOpenBetsRow
+	status string
+	payout int64
+}
+
+// betPayout pays a winning bet at the odds of a uniform draw: the stake
+// times the number of players per winner. Those odds only hold for the
+// uniform strategy, so bets are neither taken nor paid under the others.
+func betPayout(amount int64, players, winners int) int64 {
+	return amount * int64(players) / int64(max(winners, 1))
+}
+
+// handleBet places a bet on today's main game: /bet @username amount.
+func (h *Handler) handleBet(ctx context.Context, msg *Message) error {
+	chatID := msg.Chat.ID
+	fields := strings.Fields(extractArgs(msg))
+	if len(fields) != 2 {
+		return h.send(ctx, chatID, h.tr.Get(TrBetUsage))
+	}
+	username, ok := usernameArg(fields[0])
+	amount, err := strconv.ParseInt(fields[1], 10, 64)
+	if !ok || err != nil || amount <= 0 {
+		return h.send(ctx, chatID, h.tr.Get(TrBetUsage))
+	}
+
+	settings, err := h.chatSettings(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if settings.Strategy != StrategyUniform {
+		return h.send(ctx, chatID, h.tr.Get(TrBetsUniformOnly))
+	}
+
+	target, err := h.storage.Queries.GetParticipantByUsername(ctx, db.GetParticipantByUsernameParams{
+		ChatID:   chatID,
+		Username: username,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return h.send(ctx, chatID, h.tr.Getf(TrStatsUnknownPlayer, username))
+	}
+	if err != nil {
+		return err
+	}
+	if target.LeftAt.Valid {
+		return h.send(ctx, chatID, h.tr.Getf(TrKickNotPlaying, html.EscapeString(target.FirstName)))
+	}
+
+	date := h.todayFunc()
+	var balance int64
+	err = h.storage.InTx(ctx, func(q *db.Queries) error {
+		if _, err := q.GetUserBet(ctx, db.GetUserBetParams{
+			ChatID:  chatID,
+			UserID:  msg.From.ID,
+			BetDate: date,
+		}); err == nil {
+			return errBetExists
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		balance, err = q.GetBalance(ctx, db.GetBalanceParams{ChatID: chatID, UserID: msg.From.ID})
+		if err != nil {
+			return err
+		}
+		if balance < amount {
+			return errBetInsufficient
+		}
+
+		betID, err := q.PlaceBet(ctx, db.PlaceBetParams{
+			ChatID:   chatID,
+			UserID:   msg.From.ID,
+			TargetID: target.UserID,
+			Amount:   amount,
+			BetDate:  date,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return errBetsClosed
+		}
+		if err != nil {
+			return err
+		}
+		if err := q.AddLedgerEntry(ctx, db.AddLedgerEntryParams{
+			ChatID: chatID,
+			UserID: msg.From.ID,
+			Amount: -amount,
+			Reason: LedgerStake,
+			BetID:  sql.NullInt64{Int64: betID, Valid: true},
+		}); err != nil {
+			return err
+		}
+		return newAudit(chatID, msg.From.ID, AuditBet, nil,
+			auditState{"bet": betID, "date": date, "target_id": target.UserID, "amount": amount}).record(ctx, q)
+	})
+	switch {
+	case errors.Is(err, errBetExists):
+		return h.send(ctx, chatID, h.tr.Get(TrBetExists))
+	case errors.Is(err, errBetInsufficient):
+		return h.send(ctx, chatID, h.tr.Getf(TrBetInsufficient, balance))
+	case errors.Is(err, errBetsClosed):
+		return h.send(ctx, chatID, h.tr.Get(TrBetsClosed))
+	case err != nil:
+		return err
+	}
+
+	participants, err := h.storage.Queries.GetParticipants(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	winners, err := h.gameWinners(ctx, chatID, mainGameID)
+	if err != nil {
+		return err
+	}
+	payout := betPayout(amount, len(participants), int(winners))
+	return h.send(ctx, chatID, h.tr.Getf(TrBetPlaced, html.EscapeString(msg.From.FirstName), amount,
+		html.EscapeString(target.FirstName), payout))
+}
+
+// settleBets settles the open bets up to date with a main game roll inside
+// its transaction. Bets on players outside the draw, bets of days without a
+// roll and every bet of a roll not drawn with the uniform strategy are
+// refunded. All entries are tied to resultID, so deleting the result
+// reverses them and reopens the bets.
+func settleBets(ctx context.Context, q *db.Queries, chatID int64, date, strategy string, winners, participants []db.GetParticipantsRow, resultID int64) ([]betOutcome, error) {
+	bets, err := q.ListOpenBets(ctx, db.ListOpenBetsParams{ChatID: chatID, BetDate: date})
+	if err != nil {
+		return nil, err
+	}
+
+	isTarget := func(id int64) func(db.GetParticipantsRow) bool {
+		return func(p db.GetParticipantsRow) bool { return p.UserID == id }
+	}
+
+	outcomes := make([]betOutcome, 0, len(bets))
+	for _, b := range bets {
+		o := betOutcome{bet: b, status: BetLost}
+		reason := ""
+		switch {
+		case b.BetDate < date || strategy != StrategyUniform || !slices.ContainsFunc(participants, isTarget(b.TargetID)):
+			o.status, o.payout, reason = BetRefunded, b.Amount, LedgerRefund
+		case slices.ContainsFunc(winners, isTarget(b.TargetID)):
+			o.status, o.payout, reason = BetWon, betPayout(b.Amount, len(participants), len(winners)), LedgerPayout
+		}
+
+		if reason != "" {
+			if err := q.AddLedgerEntry(ctx, db.AddLedgerEntryParams{
+				ChatID:   chatID,
+				UserID:   b.UserID,
+				Amount:   o.payout,
+				Reason:   reason,
+				ResultID: sql.NullInt64{Int64: resultID, Valid: true},
+				BetID:    sql.NullInt64{Int64: b.ID, Valid: true},
+			}); err != nil {
+				return nil, err
+			}
+		}
+		if err := q.SettleBet(ctx, db.SettleBetParams{
+			Status:   o.status,
+			Payout:   o.payout,
+			ResultID: sql.NullInt64{Int64: resultID, Valid: true},
+			ID:       b.ID,
+		}); err != nil {
+			return nil, err
+		}
+		outcomes = append(outcomes, o)
+	}
+	return outcomes, nil
+}
+
+// resettleBets settles the bets of a corrected result again after its
+// winner changed from one player to another: winning bets on the replaced
+// winner are reversed and losing bets on the new one are paid. Refunded
+// bets stay refunded.
+func resettleBets(ctx context.Context, q *db.Queries, chatID, resultID, from, to int64, winners int) error {
+	bets, err := q.ListResultBets(ctx, sql.NullInt64{Int64: resultID, Valid: true})
+	if err != nil {
+		return err
+	}
+	players, err := q.CountResultParticipants(ctx, resultID)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range bets {
+		status, payout, amount, reason := "", int64(0), int64(0), ""
+		switch {
+		case b.Status == BetWon && b.TargetID == from:
+			status, amount, reason = BetLost, -b.Payout, LedgerReversal
+		case b.Status == BetLost && b.TargetID == to:
+			payout = betPayout(b.Amount, int(players), winners)
+			status, amount, reason = BetWon, payout, LedgerPayout
+		default:
+			continue
+		}
+
+		if err := q.AddLedgerEntry(ctx, db.AddLedgerEntryParams{
+			ChatID:   chatID,
+			UserID:   b.UserID,
+			Amount:   amount,
+			Reason:   reason,
+			ResultID: sql.NullInt64{Int64: resultID, Valid: true},
+			BetID:    sql.NullInt64{Int64: b.ID, Valid: true},
+		}); err != nil {
+			return err
+		}
+		if err := q.SettleBet(ctx, db.SettleBetParams{
+			Status:   status,
+			Payout:   payout,
+			ResultID: sql.NullInt64{Int64: resultID, Valid: true},
+			ID:       b.ID,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resettleRestoredBets settles the open bets of a day again after /undo
+// restored its results, as the roll would have.
+func resettleRestoredBets(ctx context.Context, q *db.Queries, chatID int64, date string, restored []db.GetTodayResultsRow) error {
+	top, err := q.GetTopResult(ctx, db.GetTopResultParams{ChatID: chatID, GameID: mainGameID, PlayedDate: date})
+	if err != nil {
+		return err
+	}
+	snapshot, err := q.GetResultParticipants(ctx, db.GetResultParticipantsParams{
+		ChatID:     chatID,
+		GameID:     mainGameID,
+		PlayedDate: date,
+	})
+	if err != nil {
+		return err
+	}
+
+	winners := make([]db.GetParticipantsRow, len(restored))
+	for i, r := range restored {
+		winners[i] = db.GetParticipantsRow{UserID: r.UserID, FirstName: r.WinnerName.String}
+	}
+	participants := make([]db.GetParticipantsRow, len(snapshot))
+	for i, p := range snapshot {
+		participants[i] = db.GetParticipantsRow{UserID: p.UserID, FirstName: p.FirstName}
+	}
+	_, err = settleBets(ctx, q, chatID, date, parseStrategySpec(top.Strategy).Strategy, winners, participants, top.ID)
+	return err
+}
+
+// sendBetSummary lists how the roll settled the bets.
+func (h *Handler) sendBetSummary(ctx context.Context, chatID int64, outcomes []betOutcome) error {
+	var sb strings.Builder
+	sb.WriteString(h.tr.Get(TrBetsHeader))
+	for _, o := range outcomes {
+		user := html.EscapeString(o.bet.UserName)
+		target := html.EscapeString(o.bet.TargetName)
+		sb.WriteString("\n")
+		switch o.status {
+		case BetWon:
+			sb.WriteString(h.tr.Getf(TrBetWon, user, o.payout, target))
+		case BetRefunded:
+			sb.WriteString(h.tr.Getf(TrBetRefunded, user, o.payout, target))
+		default:
+			sb.WriteString(h.tr.Getf(TrBetLost, user, o.bet.Amount, target))
+		}
+	}
+	return h.send(ctx, chatID, sb.String())
+}
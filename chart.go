@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+
+	"telegram-chat-bot/db"
+)
+
+// Charts are drawn with the standard library and the Go font, which covers
+// Latin, Greek and Cyrillic. Players whose names use other scripts or emoji
+// are labelled with their @username instead when they have one.
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartText       = color.RGBA{0x24, 0x29, 0x2f, 0xff}
+	chartMuted      = color.RGBA{0x65, 0x6d, 0x76, 0xff}
+	chartBarColor   = color.RGBA{0x09, 0x69, 0xda, 0xff}
+	heatNoDraw      = color.RGBA{0xeb, 0xed, 0xf0, 0xff}
+	heatOtherWinner = color.RGBA{0x9b, 0xe9, 0xa8, 0xff}
+	heatWin         = color.RGBA{0x21, 0x6e, 0x39, 0xff}
+)
+
+// glyphHeight is the font size in pixels, the height of a line of text.
+const glyphHeight = 14
+
+var chartFont = sync.OnceValues(func() (*opentype.Font, error) {
+	return opentype.Parse(goregular.TTF)
+})
+
+// newChartFace returns a face of the chart font. Faces are not safe for
+// concurrent use, so every chart makes its own.
+func newChartFace() (font.Face, error) {
+	f, err := chartFont()
+	if err != nil {
+		return nil, err
+	}
+	return opentype.NewFace(f, &opentype.FaceOptions{Size: glyphHeight, DPI: 72, Hinting: font.HintingFull})
+}
+
+// chartName labels a player in a chart: their first name, or their
+// @username when the font lacks some of the name's characters.
+func chartName(name, username string) string {
+	f, err := chartFont()
+	if err != nil || username == "" {
+		return name
+	}
+	for _, r := range name {
+		if x, err := f.GlyphIndex(nil, r); err != nil || x == 0 {
+			return "@" + username
+		}
+	}
+	return name
+}
+
+// drawText draws s with its top-left corner at (x, y).
+func drawText(img *image.RGBA, face font.Face, x, y int, s string, c color.Color) {
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y+face.Metrics().Ascent.Ceil()),
+	}
+	d.DrawString(s)
+}
+
+func textWidth(face font.Face, s string) int {
+	return font.MeasureString(face, s).Ceil()
+}
+
+func fillRect(img *image.RGBA, x, y, w, h int, c color.Color) {
+	draw.Draw(img, image.Rect(x, y, x+w, y+h), image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+func newCanvas(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	fillRect(img, 0, 0, w, h, chartBackground)
+	return img
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type chartBar struct {
+	label string
+	value int64
+}
+
+const (
+	chartPadding   = 20
+	chartRowHeight = 28
+	chartBarWidth  = 400
+	maxLabelChars  = 16
+)
+
+// renderBarChart draws one horizontal bar per entry, longest first as given.
+func renderBarChart(title string, bars []chartBar) ([]byte, error) {
+	face, err := newChartFace()
+	if err != nil {
+		return nil, err
+	}
+
+	labelWidth := 0
+	var maxValue int64 = 1
+	for i, b := range bars {
+		if runes := []rune(b.label); len(runes) > maxLabelChars {
+			bars[i].label = string(runes[:maxLabelChars-1]) + "."
+		}
+		labelWidth = max(labelWidth, textWidth(face, bars[i].label))
+		maxValue = max(maxValue, b.value)
+	}
+
+	width := chartPadding + labelWidth + 10 + chartBarWidth + 60 + chartPadding
+	width = max(width, 2*chartPadding+textWidth(face, title))
+	top := chartPadding + glyphHeight + 16
+	height := top + len(bars)*chartRowHeight + chartPadding
+
+	img := newCanvas(width, height)
+	drawText(img, face, chartPadding, chartPadding, title, chartText)
+
+	for i, b := range bars {
+		y := top + i*chartRowHeight
+		textY := y + (chartRowHeight-glyphHeight)/2
+		drawText(img, face, chartPadding+labelWidth-textWidth(face, b.label), textY, b.label, chartText)
+
+		x := chartPadding + labelWidth + 10
+		w := int(int64(chartBarWidth) * b.value / maxValue)
+		if b.value > 0 {
+			w = max(w, 2)
+		}
+		fillRect(img, x, y+4, w, chartRowHeight-8, chartBarColor)
+		drawText(img, face, x+w+8, textY, formatInt(b.value), chartMuted)
+	}
+
+	return encodePNG(img)
+}
+
+// Day states of the win calendar.
+const (
+	dayNoDraw = iota
+	dayOtherWinner
+	dayWin
+)
+
+const (
+	heatCell = 12
+	heatGap  = 3
+	heatWeek = heatCell + heatGap
+)
+
+var heatRowLabels = [7]string{"Mon", "", "Wed", "", "Fri", "", ""}
+
+// renderWinCalendar draws a GitHub-style grid of the 53 weeks up to today,
+// one column per week starting on Monday, colored by days[YYYY-MM-DD].
+func renderWinCalendar(title string, today time.Time, days map[string]int) ([]byte, error) {
+	face, err := newChartFace()
+	if err != nil {
+		return nil, err
+	}
+
+	start := today.AddDate(0, 0, -52*7)
+	start = start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+
+	left := chartPadding + textWidth(face, "Mon") + 8
+	top := chartPadding + glyphHeight + 12 + glyphHeight + 6
+	width := left + 53*heatWeek + chartPadding
+	height := top + 7*heatWeek + chartPadding
+
+	img := newCanvas(width, height)
+	drawText(img, face, chartPadding, chartPadding, title, chartText)
+	for row, label := range heatRowLabels {
+		drawText(img, face, chartPadding, top+row*heatWeek+(heatCell-glyphHeight)/2, label, chartMuted)
+	}
+
+	monthLabelEnd := 0
+	for day := start; !day.After(today); day = day.AddDate(0, 0, 1) {
+		week := int(day.Sub(start).Hours()/24) / 7
+		row := (int(day.Weekday()) + 6) % 7
+		x := left + week*heatWeek
+
+		if day.Day() == 1 && x >= monthLabelEnd {
+			label := day.Format("Jan")
+			drawText(img, face, x, top-glyphHeight-6, label, chartMuted)
+			monthLabelEnd = x + textWidth(face, label) + 4
+		}
+
+		c := heatNoDraw
+		switch days[day.Format("2006-01-02")] {
+		case dayOtherWinner:
+			c = heatOtherWinner
+		case dayWin:
+			c = heatWin
+		}
+		fillRect(img, x, top+row*heatWeek, heatCell, heatCell, c)
+	}
+
+	return encodePNG(img)
+}
+
+func formatInt(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+// maxChartBars keeps the leaderboard image readable in big chats.
+const maxChartBars = 50
+
+// handleChart sends the leaderboard as a bar chart, or a player's win
+// calendar for "me" and "@username". Other arguments select a stats period.
+func (h *Handler) handleChart(ctx context.Context, msg *Message) error {
+	arg := extractArgs(msg)
+	switch {
+	case arg == "me":
+		return h.sendWinCalendar(ctx, msg.Chat.ID, msg.From.ID, h.tr.Get(TrLeaveNotInGame))
+	case strings.HasPrefix(arg, "@"):
+		username, ok := usernameArg(arg)
+		if !ok {
+			return h.send(ctx, msg.Chat.ID, h.tr.Get(TrChartUsage))
+		}
+		p, err := h.storage.Queries.GetParticipantByUsername(ctx, db.GetParticipantByUsernameParams{
+			ChatID:   msg.Chat.ID,
+			Username: username,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return h.send(ctx, msg.Chat.ID, h.tr.Getf(TrStatsUnknownPlayer, username))
+		}
+		if err != nil {
+			return err
+		}
+		return h.sendWinCalendar(ctx, msg.Chat.ID, p.UserID, h.tr.Getf(TrStatsUnknownPlayer, username))
+	}
+
+	label := h.tr.Get(TrChartAllTime)
+	var bars []chartBar
+	if arg == "" {
+		stats, err := h.storage.Queries.GetStats(ctx, db.GetStatsParams{
+			GameID: mainGameID,
+			ChatID: msg.Chat.ID,
+		})
+		if err != nil {
+			return err
+		}
+		for _, s := range stats {
+			bars = append(bars, chartBar{label: chartName(s.FirstName, s.Username), value: s.Wins})
+		}
+	} else {
+		period, ok := h.parseStatsPeriod(arg, h.todayFunc())
+		if !ok {
+			return h.send(ctx, msg.Chat.ID, h.tr.Get(TrChartUsage))
+		}
+		label = period.label
+		stats, err := h.storage.Queries.GetStatsByRange(ctx, db.GetStatsByRangeParams{
+			ChatID:   msg.Chat.ID,
+			GameID:   mainGameID,
+			FromDate: period.from,
+			ToDate:   period.to,
+		})
+		if err != nil {
+			return err
+		}
+		for _, s := range stats {
+			bars = append(bars, chartBar{label: chartName(s.FirstName, s.Username), value: s.Wins})
+		}
+	}
+
+	if len(bars) == 0 {
+		return h.send(ctx, msg.Chat.ID, h.tr.Get(TrChartNoData))
+	}
+	bars = bars[:min(len(bars), maxChartBars)]
+
+	photo, err := renderBarChart(h.tr.Getf(TrChartTitle, label), bars)
+	if err != nil {
+		return err
+	}
+	return h.bot.SendPhotoUpload(ctx, SendPhotoUploadRequest{
+		ChatID:   msg.Chat.ID,
+		Photo:    photo,
+		Filename: "chart.png",
+		Caption:  h.tr.Getf(TrChartCaption, label),
+	})
+}
+
+// winCalendarDays returns the calendar state of each rolled day for
+// userID. A day with several winners is a win if userID holds any of its
+// ranks, as in the stats, and someone else's win otherwise.
+func winCalendarDays(history []db.GetWinDaysRow, userID int64) map[string]int {
+	days := make(map[string]int, len(history))
+	for _, r := range history {
+		state := dayOtherWinner
+		if r.UserID == userID {
+			state = dayWin
+		}
+		days[r.PlayedDate] = max(days[r.PlayedDate], state)
+	}
+	return days
+}
+
+// sendWinCalendar sends the last year of userID's wins as a heatmap, or
+// notFound if they never were a member of the chat.
+func (h *Handler) sendWinCalendar(ctx context.Context, chatID, userID int64, notFound string) error {
+	member, err := h.storage.Queries.GetParticipantByID(ctx, db.GetParticipantByIDParams{
+		ChatID: chatID,
+		UserID: userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return h.send(ctx, chatID, notFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	today, err := time.Parse("2006-01-02", h.todayFunc())
+	if err != nil {
+		return err
+	}
+
+	history, err := h.storage.Queries.GetWinDays(ctx, db.GetWinDaysParams{
+		ChatID: chatID,
+		GameID: mainGameID,
+	})
+	if err != nil {
+		return err
+	}
+	photo, err := renderWinCalendar(h.tr.Getf(TrChartCalendarTitle, chartName(member.FirstName, member.Username)),
+		today, winCalendarDays(history, userID))
+	if err != nil {
+		return err
+	}
+	return h.bot.SendPhotoUpload(ctx, SendPhotoUploadRequest{
+		ChatID:   chatID,
+		Photo:    photo,
+		Filename: "calendar.png",
+		Caption:  h.tr.Getf(TrChartCalendarCaption, member.FirstName),
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"maps"
+	"testing"
+	"time"
+
+	"telegram-chat-bot/db"
+)
+
+func TestRenderBarChart(t *testing.T) {
+	data, err := renderBarChart("Wins: all time", []chartBar{
+		{label: "Alice", value: 5},
+		{label: "A very long name that gets cut", value: 2},
+		{label: "Карл", value: 0},
+	})
+	if err != nil {
+		t.Fatalf("renderBarChart: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if h := img.Bounds().Dy(); h != chartPadding+glyphHeight+16+3*chartRowHeight+chartPadding {
+		t.Errorf("unexpected height %d", h)
+	}
+}
+
+func TestRenderWinCalendar(t *testing.T) {
+	today := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	data, err := renderWinCalendar("Wins of Alice", today, map[string]int{
+		"2026-01-15": dayWin,
+		"2026-01-14": dayOtherWinner,
+	})
+	if err != nil {
+		t.Fatalf("renderWinCalendar: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if w := img.Bounds().Dx(); w < 53*heatWeek {
+		t.Errorf("expected room for 53 weeks, got width %d", w)
+	}
+
+	// 2026-01-15 is a Thursday in the last column.
+	face, err := newChartFace()
+	if err != nil {
+		t.Fatalf("newChartFace: %v", err)
+	}
+	left := chartPadding + textWidth(face, "Mon") + 8
+	top := chartPadding + glyphHeight + 12 + glyphHeight + 6
+	x, y := left+52*heatWeek+1, top+3*heatWeek+1
+	if got := img.At(x, y); got != heatWin {
+		t.Errorf("expected today to be marked as a win, got %v", got)
+	}
+	if got := img.At(x, y-heatWeek); got != heatOtherWinner {
+		t.Errorf("expected yesterday to be marked as someone else's win, got %v", got)
+	}
+}
+
+func TestChartName(t *testing.T) {
+	for _, tt := range []struct{ name, username, want string }{
+		{"Alice", "alice", "Alice"},
+		{"Карл", "karl", "Карл"},
+		{"Uni 🦄", "uni", "@uni"},
+		{"太郎", "", "太郎"},
+	} {
+		if got := chartName(tt.name, tt.username); got != tt.want {
+			t.Errorf("chartName(%q, %q) = %q, want %q", tt.name, tt.username, got, tt.want)
+		}
+	}
+}
+
+func TestWinCalendarDays(t *testing.T) {
+	// Two winners on the 15th in either rank order, one on the 14th.
+	history := []db.GetWinDaysRow{
+		{UserID: 1, PlayedDate: "2026-01-15"},
+		{UserID: 2, PlayedDate: "2026-01-15"},
+		{UserID: 2, PlayedDate: "2026-01-14"},
+	}
+	for userID, want := range map[int64]map[string]int{
+		1: {"2026-01-15": dayWin, "2026-01-14": dayOtherWinner},
+		2: {"2026-01-15": dayWin, "2026-01-14": dayWin},
+		3: {"2026-01-15": dayOtherWinner, "2026-01-14": dayOtherWinner},
+	} {
+		if got := winCalendarDays(history, userID); !maps.Equal(got, want) {
+			t.Errorf("user %d: got %v, want %v", userID, got, want)
+		}
+	}
+}
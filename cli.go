@@ -0,0 +1,577 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"telegram-chat-bot/db"
+)
+
+type cliCommand struct {
+	name  string
+	usage string
+	nargs int
+	run   func(ctx context.Context, s *Storage, w io.Writer, args []string) error
+}
+
+var cliCommands = []cliCommand{
+	{"chats", "", 0, cliChats},
+	{"participants", "<chat_id>", 1, cliParticipants},
+	{"add-participant", "<chat_id> <user_id> <first_name> [username]", 3, cliAddParticipant},
+	{"remove-participant", "<chat_id> <user_id>", 2, cliRemoveParticipant},
+	{"timeline", "<chat_id> [user_id]", 1, cliTimeline},
+	{"results", "<chat_id> [limit]", 1, cliResults},
+	{"set-result", "[--game <command>] <chat_id> <YYYY-MM-DD> <user_id>", 3, cliSetResult},
+	{"delete-result", "<chat_id> <YYYY-MM-DD>", 2, cliDeleteResult},
+	{"ledger", "<chat_id> [user_id]", 1, cliLedger},
+	{"export-audit", "<chat_id>", 1, cliExportAudit},
+	{"import-sets", "<file.json>", 1, cliImportSets},
+	{"set-translation", "<key> <value>", 2, cliSetTranslation},
+}
+
+func runCLI(ctx context.Context, dbPath string, args []string, w io.Writer) error {
+	name, args := args[0], args[1:]
+
+	var cmd *cliCommand
+	for i := range cliCommands {
+		if cliCommands[i].name == name {
+			cmd = &cliCommands[i]
+			break
+		}
+	}
+	if cmd == nil {
+		printUsage(w)
+		if name == "help" {
+			return nil
+		}
+		return fmt.Errorf("unknown command %q", name)
+	}
+	if len(args) < cmd.nargs {
+		return fmt.Errorf("usage: %s %s", cmd.name, cmd.usage)
+	}
+
+	storage, err := NewStorage(ctx, dbPath)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer storage.Close()
+
+	return cmd.run(ctx, storage, w, args)
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: telegram-chat-bot [command] [args...]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	fmt.Fprintln(w, "  run (default)")
+	for _, c := range cliCommands {
+		fmt.Fprintf(w, "  %s %s\n", c.name, c.usage)
+	}
+}
+
+func parseID(s, what string) (int64, error) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", what, s, err)
+	}
+	return id, nil
+}
+
+func parseDate(s string) (string, error) {
+	if _, err := time.Parse("2006-01-02", s); err != nil {
+		return "", fmt.Errorf("invalid date %q: expected YYYY-MM-DD", s)
+	}
+	return s, nil
+}
+
+func cliChats(ctx context.Context, s *Storage, w io.Writer, _ []string) error {
+	chats, err := s.Queries.ListChats(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHAT ID\tPARTICIPANTS\tDORMANT SINCE")
+	for _, c := range chats {
+		dormant := "-"
+		if c.DormantSince.Valid {
+			dormant = c.DormantSince.Time.UTC().Format(time.DateTime)
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%s\n", c.ChatID, c.Participants, dormant)
+	}
+	return tw.Flush()
+}
+
+func cliParticipants(ctx context.Context, s *Storage, w io.Writer, args []string) error {
+	chatID, err := parseID(args[0], "chat ID")
+	if err != nil {
+		return err
+	}
+
+	participants, err := s.Queries.GetParticipants(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "USER ID\tNAME\tUSERNAME")
+	for _, p := range participants {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", p.UserID, p.FirstName, p.Username)
+	}
+	return tw.Flush()
+}
+
+func cliAddParticipant(ctx context.Context, s *Storage, w io.Writer, args []string) error {
+	chatID, err := parseID(args[0], "chat ID")
+	if err != nil {
+		return err
+	}
+	userID, err := parseID(args[1], "user ID")
+	if err != nil {
+		return err
+	}
+
+	var username string
+	if len(args) > 3 {
+		username = strings.TrimPrefix(args[3], "@")
+	}
+
+	if err := s.JoinGame(ctx, db.AddParticipantParams{
+		ChatID:    chatID,
+		UserID:    userID,
+		FirstName: args[2],
+		Username:  username,
+	}, cliAudit(chatID, AuditAdd, nil, auditUser(&User{ID: userID, FirstName: args[2]}))); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Added %s (%d) to chat %d\n", args[2], userID, chatID)
+	return nil
+}
+
+func cliRemoveParticipant(ctx context.Context, s *Storage, w io.Writer, args []string) error {
+	chatID, err := parseID(args[0], "chat ID")
+	if err != nil {
+		return err
+	}
+	userID, err := parseID(args[1], "user ID")
+	if err != nil {
+		return err
+	}
+
+	left, err := s.LeaveGame(ctx, chatID, userID, cliAudit(chatID, AuditKick, auditState{"user_id": userID}, nil))
+	if err != nil {
+		return err
+	}
+	if !left {
+		return fmt.Errorf("user %d is not a participant in chat %d", userID, chatID)
+	}
+
+	fmt.Fprintf(w, "Removed %d from chat %d\n", userID, chatID)
+	return nil
+}
+
+func cliTimeline(ctx context.Context, s *Storage, w io.Writer, args []string) error {
+	chatID, err := parseID(args[0], "chat ID")
+	if err != nil {
+		return err
+	}
+	var userID int64
+	if len(args) > 1 {
+		userID, err = parseID(args[1], "user ID")
+		if err != nil {
+			return err
+		}
+	}
+
+	events, err := s.Queries.GetMembershipTimeline(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tUSER ID\tNAME\tEVENT")
+	for _, e := range events {
+		if userID != 0 && e.UserID != userID {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", e.CreatedAt.UTC().Format(time.DateTime), e.UserID, e.FirstName.String, e.Event)
+	}
+	return tw.Flush()
+}
+
+func cliResults(ctx context.Context, s *Storage, w io.Writer, args []string) error {
+	chatID, err := parseID(args[0], "chat ID")
+	if err != nil {
+		return err
+	}
+
+	limit := int64(30)
+	if len(args) > 1 {
+		limit, err = parseID(args[1], "limit")
+		if err != nil {
+			return err
+		}
+	}
+
+	results, err := s.Queries.ListResults(ctx, db.ListResultsParams{
+		ChatID: chatID,
+		Limit:  limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tUSER ID\tNAME\tPLAYERS")
+	for _, r := range results {
+		name := r.FirstName.String
+		if r.WinnerName.Valid {
+			name = r.WinnerName.String
+		}
+		players := "-"
+		if r.Players > 0 {
+			players = strconv.FormatInt(r.Players, 10)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", r.PlayedDate, r.UserID, name, players)
+	}
+	return tw.Flush()
+}
+
+// cliSetResult corrects the winner of a rolled day the way /setwinner
+// does, moving the win points and resettling the bets of the main game.
+func cliSetResult(ctx context.Context, s *Storage, w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("set-result", flag.ContinueOnError)
+	fs.SetOutput(w)
+	game := fs.String("game", "", "command of a named game instead of the main game")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if args = fs.Args(); len(args) < 3 {
+		return errors.New("usage: set-result [--game <command>] <chat_id> <YYYY-MM-DD> <user_id>")
+	}
+
+	chatID, err := parseID(args[0], "chat ID")
+	if err != nil {
+		return err
+	}
+	date, err := parseDate(args[1])
+	if err != nil {
+		return err
+	}
+	userID, err := parseID(args[2], "user ID")
+	if err != nil {
+		return err
+	}
+
+	g := mainGame
+	if *game != "" {
+		g, err = s.Queries.GetGameByCommand(ctx, db.GetGameByCommandParams{
+			ChatID:  chatID,
+			Command: strings.ToLower(strings.TrimPrefix(*game, "/")),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no game %q in chat %d", *game, chatID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	member, err := s.Queries.GetParticipantByID(ctx, db.GetParticipantByIDParams{ChatID: chatID, UserID: userID})
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("user %d is not a member of chat %d", userID, chatID)
+	}
+	if err != nil {
+		return err
+	}
+
+	user := &User{ID: userID, FirstName: member.FirstName, Username: member.Username}
+	previous, ok, err := s.SetWinner(ctx, chatID, g.ID, date, user, cliAudit(chatID, AuditSetWinner,
+		auditState{"game": g.Command, "date": date}, auditState{"game": g.Command, "date": date, "winner": member.FirstName, "user_id": userID}))
+	switch {
+	case errors.Is(err, errAlreadyWinner):
+		return fmt.Errorf("user %d already won in chat %d on %s", userID, chatID, date)
+	case errors.Is(err, errIsLoser):
+		return fmt.Errorf("user %d is the loser in chat %d on %s", userID, chatID, date)
+	case err != nil:
+		return err
+	case !ok:
+		return fmt.Errorf("no result for chat %d on %s", chatID, date)
+	}
+
+	fmt.Fprintf(w, "Set winner for chat %d on %s to %s (%d) instead of %s\n", chatID, date, member.FirstName, userID, previous)
+	return nil
+}
+
+// cliDeleteResult resets a day's result the way /reset does: the result is
+// kept as a voided result and its points and bets are reversed.
+func cliDeleteResult(ctx context.Context, s *Storage, w io.Writer, args []string) error {
+	chatID, err := parseID(args[0], "chat ID")
+	if err != nil {
+		return err
+	}
+	date, err := parseDate(args[1])
+	if err != nil {
+		return err
+	}
+
+	// The operator is not held to the chat's reset limit.
+	voided, err := s.VoidResult(ctx, chatID, mainGameID, date, cliActorID, math.MaxInt64,
+		cliAudit(chatID, AuditReset, auditDay(mainGame, date, nil), nil))
+	if err != nil {
+		return err
+	}
+	if !voided {
+		return fmt.Errorf("no result for chat %d on %s", chatID, date)
+	}
+
+	fmt.Fprintf(w, "Reset result for chat %d on %s\n", chatID, date)
+	return nil
+}
+
+// cliLedger lists a chat's ledger entries, optionally of one user, with
+// the running balance of each user.
+func cliLedger(ctx context.Context, s *Storage, w io.Writer, args []string) error {
+	chatID, err := parseID(args[0], "chat ID")
+	if err != nil {
+		return err
+	}
+	var userID int64
+	if len(args) > 1 {
+		userID, err = parseID(args[1], "user ID")
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err := s.Queries.ListLedger(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	balances := make(map[int64]int64)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTIME\tUSER ID\tNAME\tAMOUNT\tREASON\tRESULT\tBALANCE")
+	for _, e := range entries {
+		balances[e.UserID] += e.Amount
+		if userID != 0 && e.UserID != userID {
+			continue
+		}
+		result := "-"
+		if e.ResultID.Valid {
+			result = strconv.FormatInt(e.ResultID.Int64, 10)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%+d\t%s\t%s\t%d\n", e.ID, e.CreatedAt.UTC().Format(time.DateTime),
+			e.UserID, e.FirstName.String, e.Amount, e.Reason, result, balances[e.UserID])
+	}
+	return tw.Flush()
+}
+
+// auditRecord is one line of export-audit. before and after are the JSON
+// states stored with the entry.
+type auditRecord struct {
+	ID      int64           `json:"id"`
+	Time    string          `json:"time"`
+	ActorID int64           `json:"actor_id"`
+	Actor   string          `json:"actor,omitempty"`
+	Action  string          `json:"action"`
+	Before  json.RawMessage `json:"before,omitempty"`
+	After   json.RawMessage `json:"after,omitempty"`
+}
+
+// cliExportAudit writes a chat's audit log as JSON lines, oldest first.
+func cliExportAudit(ctx context.Context, s *Storage, w io.Writer, args []string) error {
+	chatID, err := parseID(args[0], "chat ID")
+	if err != nil {
+		return err
+	}
+
+	entries, err := s.Queries.ListAudit(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		rec := auditRecord{
+			ID:      e.ID,
+			Time:    e.CreatedAt.UTC().Format(time.RFC3339),
+			ActorID: e.ActorID,
+			Actor:   e.FirstName.String,
+			Action:  e.Action,
+		}
+		if e.ActorID == cliActorID {
+			rec.Actor = "CLI"
+		}
+		if e.Before.Valid {
+			rec.Before = json.RawMessage(e.Before.String)
+		}
+		if e.After.Valid {
+			rec.After = json.RawMessage(e.After.String)
+		}
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// messageSetFile is the import format: a JSON array of sets, each holding
+// the steps sent in order with {placeholders} filled in (see template.go).
+// Sets without a chat_id are global.
+// Optional weight, dates ("12-01..12-31") and days ("sat,sun") follow the
+// /setrules syntax.
+type messageSetFile []struct {
+	ChatID   *int64    `json:"chat_id,omitempty"`
+	Weight   *int64    `json:"weight,omitempty"`
+	Dates    string    `json:"dates,omitempty"`
+	Days     string    `json:"days,omitempty"`
+	Messages []setStep `json:"messages"`
+}
+
+// setStep is either a plain string (a text line) or an object such as
+// {"type": "animation", "body": "<file_id>", "caption": "..."}.
+type setStep struct {
+	Type    string `json:"type"`
+	Body    string `json:"body"`
+	Caption string `json:"caption,omitempty"`
+}
+
+func (s *setStep) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*s = setStep{Type: StepText, Body: text}
+		return nil
+	}
+
+	type plain setStep
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*s = setStep(p)
+	if s.Type == "" {
+		s.Type = StepText
+	}
+	return nil
+}
+
+func cliImportSets(ctx context.Context, s *Storage, w io.Writer, args []string) error {
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	var sets messageSetFile
+	if err := json.Unmarshal(data, &sets); err != nil {
+		return fmt.Errorf("parse %s: %w", args[0], err)
+	}
+
+	rules := make([][]string, len(sets))
+	for i, set := range sets {
+		if len(set.Messages) == 0 {
+			return fmt.Errorf("set %d has no messages", i+1)
+		}
+		if set.Weight != nil {
+			rules[i] = append(rules[i], fmt.Sprintf("weight=%d", *set.Weight))
+		}
+		if set.Dates != "" {
+			rules[i] = append(rules[i], "dates="+set.Dates)
+		}
+		if set.Days != "" {
+			rules[i] = append(rules[i], "days="+set.Days)
+		}
+		if _, err := parseSetRules(db.MessageSet{Weight: 1}, rules[i]); err != nil {
+			return fmt.Errorf("set %d: %w", i+1, err)
+		}
+		for j, step := range set.Messages {
+			if err := validateStep(step.Type, step.Body, step.Caption); err != nil {
+				return fmt.Errorf("set %d step %d: %w", i+1, j+1, err)
+			}
+		}
+	}
+
+	err = s.InTx(ctx, func(q *db.Queries) error {
+		for i, set := range sets {
+			var chatID sql.NullInt64
+			if set.ChatID != nil {
+				chatID = sql.NullInt64{Int64: *set.ChatID, Valid: true}
+			}
+			setID, err := q.CreateMessageSet(ctx, db.CreateMessageSetParams{ChatID: chatID})
+			if err != nil {
+				return err
+			}
+			if len(rules[i]) > 0 {
+				params, err := parseSetRules(db.MessageSet{ID: setID, Weight: 1}, rules[i])
+				if err != nil {
+					return err
+				}
+				if err := q.SetMessageSetRules(ctx, params); err != nil {
+					return err
+				}
+			}
+			for pos, step := range set.Messages {
+				if err := q.AddSetMessage(ctx, db.AddSetMessageParams{
+					SetID:    setID,
+					Position: int64(pos + 1),
+					Kind:     step.Type,
+					Body:     step.Body,
+					Caption:  step.Caption,
+				}); err != nil {
+					return err
+				}
+			}
+			auditChatID := int64(globalAuditChatID)
+			if chatID.Valid {
+				auditChatID = chatID.Int64
+			}
+			after := auditState{"set": setID, "rules": strings.Join(rules[i], " "), "steps": len(set.Messages)}
+			if err := cliAudit(auditChatID, AuditImportSet, nil, after).record(ctx, q); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Imported %d message set(s)\n", len(sets))
+	return nil
+}
+
+func cliSetTranslation(ctx context.Context, s *Storage, w io.Writer, args []string) error {
+	key, value := args[0], args[1]
+	err := s.InTx(ctx, func(q *db.Queries) error {
+		var before auditState
+		previous, err := q.GetTranslation(ctx, key)
+		switch {
+		case err == nil:
+			before = auditState{key: previous}
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+		if err := q.SetTranslation(ctx, db.SetTranslationParams{Key: key, Value: value}); err != nil {
+			return err
+		}
+		return cliAudit(globalAuditChatID, AuditTranslate, before, auditState{key: value}).record(ctx, q)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Set %s\n", args[0])
+	return nil
+}
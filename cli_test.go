@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"telegram-chat-bot/db"
+)
+
+func setupCLI(t *testing.T) *Storage {
+	t.Helper()
+
+	storage, err := NewStorage(context.Background(), ":memory:")
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+	return storage
+}
+
+func TestCLIUnknownCommand(t *testing.T) {
+	var out bytes.Buffer
+	err := runCLI(context.Background(), ":memory:", []string{"bogus"}, &out)
+	if err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("expected unknown command error, got %v", err)
+	}
+	if !strings.Contains(out.String(), "import-sets") {
+		t.Errorf("expected usage listing, got: %s", out.String())
+	}
+}
+
+func TestCLIMissingArgs(t *testing.T) {
+	var out bytes.Buffer
+	err := runCLI(context.Background(), ":memory:", []string{"set-result", "100"}, &out)
+	if err == nil || !strings.Contains(err.Error(), "usage: set-result") {
+		t.Errorf("expected usage error, got %v", err)
+	}
+}
+
+func TestCLIParticipants(t *testing.T) {
+	storage := setupCLI(t)
+	ctx := context.Background()
+	var out bytes.Buffer
+
+	if err := cliAddParticipant(ctx, storage, &out, []string{"100", "1", "Alice", "@alice"}); err != nil {
+		t.Fatalf("add-participant: %v", err)
+	}
+
+	out.Reset()
+	if err := cliParticipants(ctx, storage, &out, []string{"100"}); err != nil {
+		t.Fatalf("participants: %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "Alice") || !strings.Contains(got, "alice") {
+		t.Errorf("expected Alice listed, got: %s", got)
+	}
+
+	out.Reset()
+	if err := cliChats(ctx, storage, &out, nil); err != nil {
+		t.Fatalf("chats: %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "100") {
+		t.Errorf("expected chat 100 listed, got: %s", got)
+	}
+
+	if err := cliRemoveParticipant(ctx, storage, &out, []string{"100", "1"}); err != nil {
+		t.Fatalf("remove-participant: %v", err)
+	}
+	if err := cliRemoveParticipant(ctx, storage, &out, []string{"100", "1"}); err == nil {
+		t.Error("expected error removing a missing participant")
+	}
+
+	// A chat with nobody left in the game is still listed, dormant or not.
+	if _, err := storage.Queries.MarkChatDormant(ctx, 200); err != nil {
+		t.Fatalf("MarkChatDormant: %v", err)
+	}
+	chats, err := storage.Queries.ListChats(ctx)
+	if err != nil {
+		t.Fatalf("ListChats: %v", err)
+	}
+	if len(chats) != 2 || chats[0].ChatID != 100 || chats[0].Participants != 0 || chats[0].DormantSince.Valid ||
+		chats[1].ChatID != 200 || chats[1].Participants != 0 || !chats[1].DormantSince.Valid {
+		t.Errorf("expected chats 100 and a dormant 200 with no participants, got %+v", chats)
+	}
+
+	out.Reset()
+	if err := cliTimeline(ctx, storage, &out, []string{"100", "1"}); err != nil {
+		t.Fatalf("timeline: %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "join") || !strings.Contains(got, "leave") {
+		t.Errorf("expected join and leave events, got: %s", got)
+	}
+}
+
+func TestCLIResults(t *testing.T) {
+	storage := setupCLI(t)
+	ctx := context.Background()
+	var out bytes.Buffer
+
+	for _, args := range [][]string{{"100", "1", "Alice"}, {"100", "2", "Bob"}} {
+		if err := cliAddParticipant(ctx, storage, &out, args); err != nil {
+			t.Fatalf("add-participant: %v", err)
+		}
+	}
+	if err := cliSetResult(ctx, storage, &out, []string{"100", "2026-01-15", "1"}); err == nil {
+		t.Error("expected error for a day without a result")
+	}
+
+	resultID, err := storage.Queries.SaveResult(ctx, db.SaveResultParams{
+		ChatID: 100, UserID: 2, PlayedDate: "2026-01-15", Rank: 1,
+		WinnerName: sql.NullString{String: "Bob", Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("SaveResult: %v", err)
+	}
+	if err := storage.Queries.AddLedgerEntry(ctx, db.AddLedgerEntryParams{
+		ChatID: 100, UserID: 2, Amount: winPoints, Reason: LedgerWin,
+		ResultID: sql.NullInt64{Int64: resultID, Valid: true},
+	}); err != nil {
+		t.Fatalf("AddLedgerEntry: %v", err)
+	}
+
+	if err := cliSetResult(ctx, storage, &out, []string{"100", "2026-01-15", "2"}); err == nil {
+		t.Error("expected error for the current winner")
+	}
+	if err := cliSetResult(ctx, storage, &out, []string{"100", "2026-01-15", "3"}); err == nil {
+		t.Error("expected error for an unknown user")
+	}
+	if err := cliSetResult(ctx, storage, &out, []string{"100", "2026-01-15", "1"}); err != nil {
+		t.Fatalf("set-result: %v", err)
+	}
+	for userID, want := range map[int64]int64{1: winPoints, 2: 0} {
+		if balance, err := storage.Queries.GetBalance(ctx, db.GetBalanceParams{ChatID: 100, UserID: userID}); err != nil || balance != want {
+			t.Errorf("user %d: expected balance %d, got %d (%v)", userID, want, balance, err)
+		}
+	}
+
+	out.Reset()
+	if err := cliResults(ctx, storage, &out, []string{"100"}); err != nil {
+		t.Fatalf("results: %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "2026-01-15") || !strings.Contains(got, "Alice") {
+		t.Errorf("expected overwritten result for Alice, got: %s", got)
+	}
+	if got := out.String(); !strings.Contains(got, "PLAYERS") {
+		t.Errorf("expected a players column, got: %s", got)
+	}
+
+	if err := cliSetResult(ctx, storage, &out, []string{"100", "15.01.2026", "1"}); err == nil {
+		t.Error("expected error for malformed date")
+	}
+
+	// --game targets a named game's result instead.
+	gameID, err := storage.Queries.CreateGame(ctx, db.CreateGameParams{ChatID: 100, Command: "loser", Title: "Loser"})
+	if err != nil {
+		t.Fatalf("CreateGame: %v", err)
+	}
+	if _, err := storage.Queries.SaveResult(ctx, db.SaveResultParams{
+		ChatID: 100, GameID: gameID, UserID: 1, PlayedDate: "2026-01-15", Rank: 1,
+	}); err != nil {
+		t.Fatalf("SaveResult: %v", err)
+	}
+	if err := cliSetResult(ctx, storage, &out, []string{"--game", "nope", "100", "2026-01-15", "2"}); err == nil {
+		t.Error("expected error for an unknown game")
+	}
+	if err := cliSetResult(ctx, storage, &out, []string{"--game", "loser", "100", "2026-01-15", "2"}); err != nil {
+		t.Fatalf("set-result --game: %v", err)
+	}
+	for _, tt := range []struct{ gameID, want int64 }{{mainGameID, 1}, {gameID, 2}} {
+		ids, err := storage.Queries.GetResultWinners(ctx, db.GetResultWinnersParams{
+			ChatID: 100, GameID: tt.gameID, PlayedDate: "2026-01-15",
+		})
+		if err != nil || len(ids) != 1 || ids[0] != tt.want {
+			t.Errorf("game %d: expected winner %d, got %v (%v)", tt.gameID, tt.want, ids, err)
+		}
+	}
+
+	if err := cliDeleteResult(ctx, storage, &out, []string{"100", "2026-01-15"}); err != nil {
+		t.Fatalf("delete-result: %v", err)
+	}
+	if rows, err := storage.Queries.GetTodayResults(ctx, db.GetTodayResultsParams{
+		ChatID: 100, PlayedDate: "2026-01-15",
+	}); err != nil || len(rows) != 0 {
+		t.Errorf("expected result to be reset, got %+v (%v)", rows, err)
+	}
+	var voided, resetBy int64
+	if err := storage.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM voided_results WHERE chat_id = 100 AND game_id = 0").Scan(&voided); err != nil || voided != 1 {
+		t.Errorf("expected the result to be kept as voided, got %d (%v)", voided, err)
+	}
+	if err := storage.db.QueryRowContext(ctx, "SELECT user_id FROM resets").Scan(&resetBy); err != nil || resetBy != cliActorID {
+		t.Errorf("expected the reset to be recorded for the CLI, got %d (%v)", resetBy, err)
+	}
+	entries, err := storage.Queries.ListAudit(ctx, 100)
+	if err != nil {
+		t.Fatalf("ListAudit: %v", err)
+	}
+	last := entries[len(entries)-1]
+	if last.ActorID != cliActorID || last.Action != AuditReset || last.Before.String != `{"date":"2026-01-15","game":"","winners":[1]}` {
+		t.Errorf("expected an audited reset, got %+v", last)
+	}
+	if err := cliDeleteResult(ctx, storage, &out, []string{"100", "2026-01-15"}); err == nil {
+		t.Error("expected error resetting a day without a result")
+	}
+}
+
+// TestCLISetResultPastDate checks that correcting an earlier day keeps the
+// later rolls of a history-based strategy verifiable.
+func TestCLISetResultPastDate(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 3, "Carol", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/set strategy deck"))
+	for day := 1; day <= 3; day++ {
+		env.handler.todayFunc = func() string { return fmt.Sprintf("2026-02-%02d", day) }
+		env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	}
+
+	first, err := env.storage.Queries.GetResultWinners(ctx, db.GetResultWinnersParams{
+		ChatID: 100, GameID: mainGameID, PlayedDate: "2026-02-01",
+	})
+	if err != nil || len(first) != 1 {
+		t.Fatalf("GetResultWinners: %v, %v", first, err)
+	}
+	var out bytes.Buffer
+	if err := cliSetResult(ctx, env.storage, &out, []string{"100", "2026-02-01", fmt.Sprint(first[0]%3 + 1)}); err != nil {
+		t.Fatalf("set-result: %v", err)
+	}
+
+	for _, date := range []string{"2026-02-02", "2026-02-03"} {
+		env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/verify "+date))
+		if got := env.sender.last().Text; !strings.Contains(got, "as announced.") {
+			t.Errorf("expected %s to verify, got: %s", date, got)
+		}
+	}
+}
+
+func TestCLILedger(t *testing.T) {
+	storage := setupCLI(t)
+	ctx := context.Background()
+	var out bytes.Buffer
+
+	for _, e := range []db.AddLedgerEntryParams{
+		{ChatID: 100, UserID: 1, Amount: 10, Reason: LedgerWin, ResultID: sql.NullInt64{Int64: 7, Valid: true}},
+		{ChatID: 100, UserID: 2, Amount: 1, Reason: LedgerAllowance, ResultID: sql.NullInt64{Int64: 7, Valid: true}},
+		{ChatID: 100, UserID: 1, Amount: -10, Reason: LedgerReversal, ResultID: sql.NullInt64{Int64: 7, Valid: true}},
+	} {
+		if err := storage.Queries.AddLedgerEntry(ctx, e); err != nil {
+			t.Fatalf("AddLedgerEntry: %v", err)
+		}
+	}
+
+	if err := cliLedger(ctx, storage, &out, []string{"100", "1"}); err != nil {
+		t.Fatalf("ledger: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 entries, got: %s", out.String())
+	}
+	if fields := strings.Fields(lines[2]); fields[len(fields)-1] != "0" || !strings.Contains(lines[2], "-10") {
+		t.Errorf("expected the reversal to leave 0, got: %s", lines[2])
+	}
+}
+
+func TestCLIImportSets(t *testing.T) {
+	storage := setupCLI(t)
+	ctx := context.Background()
+	var out bytes.Buffer
+
+	path := filepath.Join(t.TempDir(), "sets.json")
+	data := `[
+		{"messages": ["Spinning...", "Winner is %s!"]},
+		{"weight": 2, "days": "fri", "messages": [{"type": "dice", "body": "🎰"}, {"type": "animation", "body": "gif-id", "caption": "{mention}"}]}
+	]`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cliImportSets(ctx, storage, &out, []string{path}); err != nil {
+		t.Fatalf("import-sets: %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "Imported 2") {
+		t.Errorf("unexpected output: %s", got)
+	}
+
+	messages, err := storage.Queries.GetSetMessages(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetSetMessages: %v", err)
+	}
+	if len(messages) != 2 || messages[1].Body != "Winner is %s!" {
+		t.Errorf("unexpected set messages: %v", messages)
+	}
+
+	messages, err = storage.Queries.GetSetMessages(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetSetMessages: %v", err)
+	}
+	want := db.GetSetMessagesRow{Kind: StepAnimation, Body: "gif-id", Caption: "{mention}"}
+	if len(messages) != 2 || messages[0].Kind != StepDice || messages[1] != want {
+		t.Errorf("unexpected media steps: %+v", messages)
+	}
+
+	set, err := storage.Queries.GetMessageSet(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetMessageSet: %v", err)
+	}
+	if set.Weight != 2 || set.Weekdays != 1<<5 {
+		t.Errorf("expected imported rules, got %+v", set)
+	}
+}
+
+func TestCLIImportSetsRejectsInvalidStep(t *testing.T) {
+	storage := setupCLI(t)
+	ctx := context.Background()
+	var out bytes.Buffer
+
+	path := filepath.Join(t.TempDir(), "sets.json")
+	data := `[{"messages": ["Ok %s"]}, {"messages": [{"type": "dice", "body": "🍕"}]}]`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := cliImportSets(ctx, storage, &out, []string{path})
+	if err == nil || !strings.Contains(err.Error(), "set 2 step 1") {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if _, err := storage.Queries.GetMessageSet(ctx, 1); err == nil {
+		t.Error("expected nothing imported after a validation error")
+	}
+}
+
+func TestCLISetTranslation(t *testing.T) {
+	storage := setupCLI(t)
+	ctx := context.Background()
+	var out bytes.Buffer
+
+	if err := cliSetTranslation(ctx, storage, &out, []string{"join_success", "Hi"}); err != nil {
+		t.Fatalf("set-translation: %v", err)
+	}
+	if err := cliSetTranslation(ctx, storage, &out, []string{"join_success", "Hello"}); err != nil {
+		t.Fatalf("set-translation overwrite: %v", err)
+	}
+
+	tr, err := NewTranslator(ctx, storage.Queries)
+	if err != nil {
+		t.Fatalf("NewTranslator: %v", err)
+	}
+	if got := tr.Get(TrJoinSuccess); got != "Hello" {
+		t.Errorf("expected updated translation, got %q", got)
+	}
+}
+
+func TestCLIExportAudit(t *testing.T) {
+	storage := setupCLI(t)
+	ctx := context.Background()
+	var out bytes.Buffer
+
+	for _, e := range []db.AddAuditEntryParams{
+		{ChatID: 100, ActorID: 1, Action: AuditJoin, After: sql.NullString{String: `{"user_id":1}`, Valid: true}},
+		{ChatID: 100, ActorID: 1, Action: AuditReset, Before: sql.NullString{String: `{"winners":[1]}`, Valid: true}},
+		{ChatID: 200, ActorID: 2, Action: AuditJoin},
+	} {
+		if err := storage.Queries.AddAuditEntry(ctx, e); err != nil {
+			t.Fatalf("AddAuditEntry: %v", err)
+		}
+	}
+
+	if err := cliExportAudit(ctx, storage, &out, []string{"100"}); err != nil {
+		t.Fatalf("export-audit: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got: %s", out.String())
+	}
+	if !strings.Contains(lines[0], `"action":"join","after":{"user_id":1}}`) {
+		t.Errorf("unexpected first line: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"action":"reset","before":{"winners":[1]}}`) {
+		t.Errorf("unexpected second line: %s", lines[1])
+	}
+}
+
+func TestCLIAudit(t *testing.T) {
+	storage := setupCLI(t)
+	ctx := context.Background()
+	var out bytes.Buffer
+
+	if err := cliAddParticipant(ctx, storage, &out, []string{"100", "1", "Alice"}); err != nil {
+		t.Fatalf("add-participant: %v", err)
+	}
+	if err := cliRemoveParticipant(ctx, storage, &out, []string{"100", "1"}); err != nil {
+		t.Fatalf("remove-participant: %v", err)
+	}
+	if err := cliSetTranslation(ctx, storage, &out, []string{"join_success", "Hi"}); err != nil {
+		t.Fatalf("set-translation: %v", err)
+	}
+	if err := cliSetTranslation(ctx, storage, &out, []string{"join_success", "Hello"}); err != nil {
+		t.Fatalf("set-translation: %v", err)
+	}
+
+	export := func(chatID string) []string {
+		t.Helper()
+		out.Reset()
+		if err := cliExportAudit(ctx, storage, &out, []string{chatID}); err != nil {
+			t.Fatalf("export-audit: %v", err)
+		}
+		return strings.Split(strings.TrimSpace(out.String()), "\n")
+	}
+	lines := export("100")
+	if len(lines) != 2 ||
+		!strings.Contains(lines[0], `"actor_id":0,"actor":"CLI","action":"add","after":{"name":"Alice","user_id":1}}`) ||
+		!strings.Contains(lines[1], `"actor_id":0,"actor":"CLI","action":"kick","before":{"user_id":1}}`) {
+		t.Errorf("expected the participant changes recorded for the CLI, got:\n%s", strings.Join(lines, "\n"))
+	}
+	lines = export("0")
+	if len(lines) != 2 ||
+		!strings.Contains(lines[0], `"action":"translation","after":{"join_success":"Hi"}}`) ||
+		!strings.Contains(lines[1], `"action":"translation","before":{"join_success":"Hi"},"after":{"join_success":"Hello"}}`) {
+		t.Errorf("expected the translation changes recorded globally, got:\n%s", strings.Join(lines, "\n"))
+	}
+}
@@ -12,13 +12,160 @@ TRANSLATIONS = {
     "fallback_winner": "And the winner is... %s!",
     "stats_header": "<b>Hall of Fame:</b>",
     "stats_year_header": "<b>Hall of Fame (%d):</b>",
-    "stats_invalid_year": "Invalid year: %s",
     "stats_no_results": "No results for %d.",
     "stats_line": "%d. %s — %d win(s)",
     "participants_header": "<b>Players in the roulette:</b>",
     "reset_no_result": "Nothing to reset. The wheel hasn't been spun yet.",
     "reset_success": "The wheel has been reset. Spin again with /roll!",
     "unknown_user": "Player #%d",
+    "set_created": "Created message set #%d. Add lines with /addline %d followed by the text.",
+    "set_line_added": "Added line %d to set #%d.",
+    "set_addline_usage": "Usage: /addline &lt;set id&gt; &lt;text&gt;",
+    "set_unknown_placeholder": "Unknown placeholder {%s}. Available: %s",
+    "set_addmedia_usage": "Reply to a sticker, GIF or photo with /addmedia &lt;set id&gt; [caption]",
+    "set_invalid_dice": "Unsupported dice emoji. Use one of: %s",
+    "set_invalid_id": "Invalid set ID: %s",
+    "set_not_found": "Message set #%d not found.",
+    "set_deleted": "Deleted message set #%d.",
+    "set_empty": "Message set #%d has no lines yet.",
+    "sets_header": "<b>Message sets:</b>",
+    "sets_line": "#%d — %d line(s)",
+    "sets_global_line": "#%d — %d line(s) (global)",
+    "sets_none": "No message sets yet. Create one with /newset.",
+    "sets_global_off": "<i>Global sets are disabled in this chat.</i>",
+    "global_sets_usage": "Usage: /globalsets on|off",
+    "global_sets_enabled": "Global message sets are now enabled in this chat.",
+    "global_sets_disabled": "Global message sets are now disabled in this chat.",
+    "set_rules_usage": "Usage: /setrules &lt;set id&gt; [weight=N] [dates=MM-DD..MM-DD|any] [days=sat,sun|any]",
+    "set_rules_updated": "Set #%d rules: %s",
+    "set_rules_default": "default",
+    "settings_header": "<b>Settings:</b>",
+    "settings_line": "%s: <code>%s</code>",
+    "setting_unknown": "Unknown setting: %s",
+    "setting_invalid": "Invalid value for %s.",
+    "setting_updated": "%s is now <code>%s</code>.",
+    "verify_usage": "Usage: /verify [game] [YYYY-MM-DD]",
+    "verify_no_result": "No verifiable roll for %s.",
+    "verify_result": "🔍 Roll of %s\nCommitted hash: <code>%s</code>\nRevealed seed: <code>%s</code>\nDraw order (user IDs): %s\nStrategy: <code>%s</code>",
+    "verify_ok": "✅ The seed matches its commitment and picks %s, as announced.",
+    "verify_hash_mismatch": "❌ The revealed seed does not match the committed hash.",
+    "verify_malformed": "❌ The stored proof for this roll is malformed.",
+    "verify_winner_mismatch": "❌ The seed picks %s, but the recorded winner is %s.",
+    "verify_next": "🔒 Next roll is committed to <code>%s</code>.",
+    "stats_personal": "📊 Stats for %s\n\n🏆 Wins: %d (this year: %d, this month: %d)\n🎯 Win rate: %.1f%% over %d day(s) in the game\n🔥 Streak: %d current, %d longest\n📅 Last win: %s\n🥇 Rank: #%d",
+    "stats_never": "never",
+    "stats_unknown_player": "No player @%s in this chat.",
+    "stats_invalid_period": "Invalid period: %s. Use a year, month, week, YYYY-MM or YYYY-MM-DD..YYYY-MM-DD.",
+    "stats_month_header": "<b>Hall of Fame (%s):</b>",
+    "stats_week_header": "<b>Hall of Fame, week of %s:</b>",
+    "stats_range_header": "<b>Hall of Fame (%s – %s):</b>",
+    "stats_no_results_period": "No results for %s.",
+    "stats_former_player": "%s (left)",
+    "history_header": "<b>Roll history:</b>",
+    "history_period_header": "<b>Roll history (%s):</b>",
+    "history_line": "%s — %s",
+    "history_page": "Page %d of %d",
+    "history_newer": "« Newer",
+    "history_older": "Older »",
+    "history_empty": "No rolls yet.",
+    "history_usage": "Usage: /history [year|month|YYYY-MM]",
+    "chart_caption": "📊 Wins per player: %s",
+    "chart_all_time": "all time",
+    "chart_calendar_caption": "📅 Wins of %s over the last year",
+    "chart_no_data": "No draws to chart yet.",
+    "chart_usage": "Usage: /chart [month|week|YYYY|YYYY-MM|YYYY-MM-DD..YYYY-MM-DD|me|@username]",
+    "achievement_first_win": "🥇 First win",
+    "achievement_streak_3": "🔥 Three wins in a row",
+    "achievement_wins_10": "🔟 Ten wins",
+    "achievement_drought_100": "🌵 Won after 100 days without a win",
+    "achievement_anniversary": "🎂 Won on their join anniversary",
+    "achievement_awarded": "🏅 <b>%s</b> earned a badge: %s",
+    "achievements_header": "<b>Achievements:</b>",
+    "achievements_line": "%s — %s",
+    "achievements_empty": "No achievements yet.",
+    "game_unknown": "Unknown game %s. See /games.",
+    "games_empty": "No extra games yet. Admins can add one with /addgame.",
+    "games_header": "<b>Games:</b>",
+    "games_shared": "everyone who joined with /join",
+    "games_own": "%d player(s) of its own",
+    "games_line": "/%s — %s (%s)",
+    "addgame_usage": "Usage: /addgame &lt;command&gt; shared|own &lt;title&gt;",
+    "addgame_invalid_command": "/%s can't be used for a game. Use lowercase letters, digits and _, not an existing command.",
+    "addgame_exists": "There already is a game /%s.",
+    "addgame_created": "Created <b>%s</b>. Roll it with /%s and see its stats with /%sstats.",
+    "delgame_usage": "Usage: /delgame &lt;command&gt;",
+    "delgame_deleted": "Deleted <b>%s</b> with its results and message sets.",
+    "game_shared_list": "<b>%s</b> draws from everyone who joined with /join.",
+    "game_joined": "%s joined <b>%s</b>.",
+    "game_already_joined": "You're already playing <b>%s</b>.",
+    "game_left": "%s left <b>%s</b>.",
+    "game_not_joined": "You're not playing <b>%s</b>.",
+    "fallback_loser": "And today's loser is... {loser_mention}!",
+    "already_played_loser": "Today's loser is %s.",
+    "stats_losers_header": "<b>Losers:</b>",
+    "stats_loser_line": "%d. %s — %d loss(es)",
+    "verify_loser_ok": "✅ It then picks %s as the loser, as announced.",
+    "verify_loser_mismatch": "❌ The seed picks %s as the loser, but the recorded loser is %s.",
+    "verify_no_loser": "nobody",
+    "fallback_winners": "And today's winners are...\n{winners}",
+    "already_played_winners": "The wheel has already been spun today! Today's winners are:\n%s",
+    "winners_usage": "Usage: /winners [game] [1-10]",
+    "winners_show": "%s picks %d winner(s) a day.",
+    "winners_updated": "%s now picks %d winner(s) a day.",
+    "main_game": "The main game",
+    "balance": "💰 %s has %d point(s).",
+    "richest_header": "<b>Richest players:</b>",
+    "richest_line": "%d. %s — %d point(s)",
+    "richest_empty": "Nobody has any points yet.",
+    "bet_usage": "Usage: /bet @username amount",
+    "bet_exists": "You already placed a bet today.",
+    "bet_insufficient": "You only have %d point(s).",
+    "bets_closed": "Bets are closed, today's roll already happened.",
+    "bet_placed": "🎟 %s bet %d point(s) on %s, paying %d if they win today.",
+    "bets_header": "<b>Bets:</b>",
+    "bet_won": "✅ %s won %d point(s) on %s",
+    "bet_lost": "❌ %s lost %d point(s) on %s",
+    "bet_refunded": "↩️ %s got %d point(s) back for %s",
+    "duel_usage": "Usage: /duel @username",
+    "duel_self": "You can't duel yourself.",
+    "duel_not_playing": "Both players must be in the roulette to duel.",
+    "duel_challenge": "⚔️ %s challenges %s to a duel! Accept within %d minutes.",
+    "duel_accept": "Accept",
+    "duel_decline": "Decline",
+    "duel_not_yours": "Only the challenged player can answer this duel.",
+    "duel_closed": "This duel is already over.",
+    "duel_expired": "⌛ %s didn't answer the duel with %s in time.",
+    "duel_declined": "🏳️ %s declined the duel with %s.",
+    "duel_result": "🎲 %s rolled %d, %s rolled %d. %s wins the duel!",
+    "duels_header": "<b>Duel champions:</b>",
+    "duels_line": "%d. %s — %d win(s), %d loss(es)",
+    "duels_empty": "No duels fought yet. Challenge someone with /duel @username!",
+    "kick_usage": "Usage: /kick @username, or reply to the player's message with /kick",
+    "kick_success": "%s was removed from the roulette.",
+    "kick_not_playing": "%s isn't in the roulette.",
+    "add_usage": "Reply to someone's message with /add to enrol them in the roulette.",
+    "add_success": "%s is in the roulette now.",
+    "add_already": "%s is already in the roulette.",
+    "setwinner_usage": "Usage: /setwinner @username, or reply to the player's message with /setwinner",
+    "setwinner_no_result": "The wheel hasn't been spun today, so there is no result to correct.",
+    "setwinner_already": "%s already won today.",
+    "setwinner_success": "Today's result was corrected: the winner is %s instead of %s.",
+    "reset_limit": "This game's wheel can only be reset %d time(s) a day.",
+    "undo_nothing": "There is no reset to undo today.",
+    "undo_rolled_again": "The wheel was spun again after the reset. Reset that roll before undoing.",
+    "undo_success": "The reset was undone. Today's winner is %s again.",
+    "audit_usage": "Usage: /audit [1-%d]",
+    "audit_empty": "Nothing has been recorded in this chat yet.",
+    "audit_header": "<b>Audit log:</b>",
+    "audit_line": "%s — %s: %s %s",
+    "setwinner_loser": "%s lost today's draw and can't also win it.",
+    "verify_overridden": "⚠️ An admin replaced the drawn winner %s with %s.",
+    "balance_usage": "Usage: /balance [@username]",
+    "chart_title": "Wins: %s",
+    "chart_calendar_title": "Wins of %s",
+    "duel_pending": "%s and %s already have an open duel. Answer it first.",
+    "audit_cli": "CLI",
+    "bets_uniform_only": "Bets are only taken while the strategy is <code>uniform</code>, whose odds they pay.",
 }
 
 MESSAGE_SETS = {
@@ -26,17 +173,18 @@ MESSAGE_SETS = {
         "Spinning the wheel...",
         "Round and round it goes...",
         "Almost there...",
+        "Today's winner is {mention}! That's win number {wins}.",
     ],
     2: [
         "The roulette is starting!",
         "Who will it be today?",
         "Drumroll please...",
-        "And the chosen one is...",
+        "And the chosen one is... {mention}!",
     ],
     3: [
         "Let's find today's lucky winner!",
-        "Scanning participants...",
-        "Target acquired!",
+        "Scanning {count} participants...",
+        "Target acquired: {mention}! Better luck tomorrow, {random}.",
     ],
 }
 
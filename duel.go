@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"telegram-chat-bot/db"
+)
+
+// A duel is a one-off game between two players. The challenged player
+// answers with the buttons under the challenge; an accepted duel is decided
+// by a roll of a die each, rerolled on a tie.
+
+// Duel states stored in duels.status.
+const (
+	DuelPending  = "pending"
+	DuelAccepted = "accepted"
+	DuelDeclined = "declined"
+	DuelExpired  = "expired"
+)
+
+const (
+	duelTimeout = 5 * time.Minute
+	duelsLimit  = 10
+)
+
+// handleDuel challenges another player: /duel @username.
+func (h *Handler) handleDuel(ctx context.Context, msg *Message) error {
+	chatID := msg.Chat.ID
+	opponent, mention, err := h.targetUser(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if opponent == nil {
+		return h.sendTargetError(ctx, chatID, mention, TrDuelUsage)
+	}
+	if opponent.ID == msg.From.ID {
+		return h.send(ctx, chatID, h.tr.Get(TrDuelSelf))
+	}
+
+	for _, id := range []int64{msg.From.ID, opponent.ID} {
+		playing, err := h.isPlaying(ctx, chatID, id)
+		if err != nil {
+			return err
+		}
+		if !playing {
+			return h.send(ctx, chatID, h.tr.Get(TrDuelNotPlaying))
+		}
+	}
+
+	// A challenge nobody answered in time no longer stands in the way of
+	// a new one.
+	var id int64
+	err = h.storage.InTx(ctx, func(q *db.Queries) error {
+		if err := q.ExpireDuels(ctx, db.ExpireDuelsParams{
+			ChatID:         chatID,
+			TimeoutSeconds: int64(duelTimeout / time.Second),
+		}); err != nil {
+			return err
+		}
+		id, err = q.CreateDuel(ctx, db.CreateDuelParams{
+			ChatID:       chatID,
+			ChallengerID: msg.From.ID,
+			OpponentID:   opponent.ID,
+		})
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return h.send(ctx, chatID, h.tr.Getf(TrDuelPending, html.EscapeString(msg.From.FirstName),
+			html.EscapeString(opponent.FirstName)))
+	}
+	if err != nil {
+		return err
+	}
+
+	return h.bot.SendMessage(ctx, SendMessageRequest{
+		ChatID: chatID,
+		Text: h.tr.Getf(TrDuelChallenge, html.EscapeString(msg.From.FirstName),
+			html.EscapeString(opponent.FirstName), int(duelTimeout/time.Minute)),
+		ParseMode: "HTML",
+		ReplyMarkup: &InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{{
+			{Text: h.tr.Get(TrDuelAccept), CallbackData: fmt.Sprintf("duel:accept:%d", id)},
+			{Text: h.tr.Get(TrDuelDecline), CallbackData: fmt.Sprintf("duel:decline:%d", id)},
+		}}},
+	})
+}
+
+// isPlaying reports whether a user is currently in the chat's roulette.
+func (h *Handler) isPlaying(ctx context.Context, chatID, userID int64) (bool, error) {
+	m, err := h.storage.Queries.GetMembership(ctx, db.GetMembershipParams{ChatID: chatID, UserID: userID})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !m.LeftAt.Valid, nil
+}
+
+// handleDuelCallback answers a challenge. data is "<accept|decline>:<id>"
+// as set by handleDuel. It returns the text to show the presser, if any,
+// and edits the challenge into the outcome.
+func (h *Handler) handleDuelCallback(ctx context.Context, cq *CallbackQuery, data string) (string, error) {
+	choice, idArg, _ := strings.Cut(data, ":")
+	id, err := strconv.ParseInt(idArg, 10, 64)
+	if err != nil || (choice != "accept" && choice != "decline") {
+		return "", fmt.Errorf("invalid duel callback %q", data)
+	}
+
+	d, err := h.storage.Queries.GetDuel(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && d.ChatID != cq.Message.Chat.ID) {
+		return h.tr.Get(TrDuelClosed), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if cq.From.ID != d.OpponentID {
+		return h.tr.Get(TrDuelNotYours), nil
+	}
+	if d.Status != DuelPending {
+		return h.tr.Get(TrDuelClosed), nil
+	}
+
+	challenger := h.memberName(ctx, d.ChatID, d.ChallengerID)
+	opponent := h.memberName(ctx, d.ChatID, d.OpponentID)
+
+	params := db.ResolveDuelParams{ID: d.ID}
+	var text, answer string
+	switch {
+	case time.Since(d.CreatedAt) > duelTimeout:
+		params.Status = DuelExpired
+		text = h.tr.Getf(TrDuelExpired, opponent, challenger)
+		answer = h.tr.Get(TrDuelClosed)
+	case choice == "decline":
+		params.Status = DuelDeclined
+		text = h.tr.Getf(TrDuelDeclined, opponent, challenger)
+	default:
+		challengerRoll, opponentRoll := h.duelRolls()
+		winnerID, winner := d.ChallengerID, challenger
+		if opponentRoll > challengerRoll {
+			winnerID, winner = d.OpponentID, opponent
+		}
+		params.Status = DuelAccepted
+		params.ChallengerRoll = sql.NullInt64{Int64: int64(challengerRoll), Valid: true}
+		params.OpponentRoll = sql.NullInt64{Int64: int64(opponentRoll), Valid: true}
+		params.WinnerID = sql.NullInt64{Int64: winnerID, Valid: true}
+		text = h.tr.Getf(TrDuelResult, challenger, challengerRoll, opponent, opponentRoll, winner)
+	}
+
+	var resolved bool
+	err = h.storage.InTx(ctx, func(q *db.Queries) error {
+		res, err := q.ResolveDuel(ctx, params)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		resolved = n > 0
+		if err != nil || !resolved {
+			return err
+		}
+		after := auditState{"duel": d.ID, "status": params.Status}
+		if params.WinnerID.Valid {
+			after["winner_id"] = params.WinnerID.Int64
+		}
+		return newAudit(d.ChatID, cq.From.ID, AuditDuel, auditState{"duel": d.ID, "status": d.Status}, after).record(ctx, q)
+	})
+	if err != nil {
+		return "", err
+	}
+	if !resolved {
+		return h.tr.Get(TrDuelClosed), nil
+	}
+
+	return answer, h.bot.EditMessageText(ctx, EditMessageTextRequest{
+		ChatID:    cq.Message.Chat.ID,
+		MessageID: cq.Message.MessageID,
+		Text:      text,
+		ParseMode: "HTML",
+	})
+}
+
+// duelRolls rolls a die for each side until they differ.
+func (h *Handler) duelRolls() (challenger, opponent int) {
+	for challenger == opponent {
+		challenger, opponent = h.rng.IntN(6)+1, h.rng.IntN(6)+1
+	}
+	return challenger, opponent
+}
+
+// memberName returns the escaped first name of a chat member, or a
+// placeholder when the bot never saw them.
+func (h *Handler) memberName(ctx context.Context, chatID, userID int64) string {
+	m, err := h.storage.Queries.GetParticipantByID(ctx, db.GetParticipantByIDParams{ChatID: chatID, UserID: userID})
+	if err != nil {
+		return h.tr.Getf(TrUnknownUser, userID)
+	}
+	return html.EscapeString(m.FirstName)
+}
+
+func (h *Handler) handleDuels(ctx context.Context, msg *Message) error {
+	rows, err := h.storage.Queries.GetDuelStats(ctx, db.GetDuelStatsParams{
+		ChatID: msg.Chat.ID,
+		Limit:  duelsLimit,
+	})
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return h.send(ctx, msg.Chat.ID, h.tr.Get(TrDuelsEmpty))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(h.tr.Get(TrDuelsHeader))
+	sb.WriteString("\n\n")
+	for i, r := range rows {
+		name := h.leaderboardName(html.EscapeString(r.FirstName), false, r.Active)
+		sb.WriteString(h.tr.Getf(TrDuelsLine, i+1, name, r.Wins, r.Losses))
+		sb.WriteString("\n")
+	}
+	return h.send(ctx, msg.Chat.ID, sb.String())
+}
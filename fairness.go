@@ -0,0 +1,313 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	mathrand "math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"telegram-chat-bot/db"
+)
+
+// Rolls are provably fair. Each chat has a 32-byte seed committed in
+// roll_commitments before its next roll; only the SHA-256 hash is shown
+// until the roll. The roll seeds ChaCha8 with it, draws from the
+// participants ordered by user ID and stores seed, hash, order and strategy
+// with the result. A fresh seed is then committed for the following roll.
+
+const seedSize = 32
+
+var errInvalidProof = errors.New("invalid roll proof")
+
+func newSeed() (seed, hash string) {
+	var b [seedSize]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:]), seedHash(b[:])
+}
+
+func seedHash(seed []byte) string {
+	sum := sha256.Sum256(seed)
+	return hex.EncodeToString(sum[:])
+}
+
+// seededRand returns the deterministic RNG for a hex-encoded seed.
+func seededRand(seed string) (*mathrand.Rand, error) {
+	b, err := hex.DecodeString(seed)
+	if err != nil || len(b) != seedSize {
+		return nil, errInvalidProof
+	}
+	return mathrand.New(mathrand.NewChaCha8([seedSize]byte(b))), nil
+}
+
+// drawOrder returns the participants sorted by user ID, the order a fair
+// roll draws from.
+func drawOrder(participants []db.GetParticipantsRow) []db.GetParticipantsRow {
+	ordered := slices.Clone(participants)
+	slices.SortFunc(ordered, func(a, b db.GetParticipantsRow) int {
+		return cmp.Compare(a.UserID, b.UserID)
+	})
+	return ordered
+}
+
+func formatParticipantIDs(participants []db.GetParticipantsRow) string {
+	ids := make([]string, len(participants))
+	for i, p := range participants {
+		ids[i] = strconv.FormatInt(p.UserID, 10)
+	}
+	return strings.Join(ids, ",")
+}
+
+func parseParticipantIDs(s string) ([]db.GetParticipantsRow, error) {
+	var participants []db.GetParticipantsRow
+	for _, field := range strings.Split(s, ",") {
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, errInvalidProof
+		}
+		participants = append(participants, db.GetParticipantsRow{UserID: id})
+	}
+	return participants, nil
+}
+
+// strategySpec records the strategy of a roll along with its parameters,
+// e.g. "uniform" or "cooldown:3".
+func strategySpec(settings db.ChatSetting) string {
+	if settings.Strategy == StrategyCooldown {
+		return fmt.Sprintf("%s:%d", settings.Strategy, settings.CooldownDays)
+	}
+	return settings.Strategy
+}
+
+func parseStrategySpec(spec string) db.ChatSetting {
+	name, param, _ := strings.Cut(spec, ":")
+	days, _ := strconv.ParseInt(param, 10, 64)
+	return db.ChatSetting{Strategy: name, CooldownDays: days}
+}
+
+// historyBefore drops results on or after date, so a roll can be recomputed
+// with the history it was drawn with.
+func historyBefore(history []db.GetWinHistoryRow, date string) []db.GetWinHistoryRow {
+	return slices.DeleteFunc(slices.Clone(history), func(r db.GetWinHistoryRow) bool {
+		return r.PlayedDate >= date
+	})
+}
+
+// fairPick draws the winner from seed. participants must be in draw order.
+func fairPick(seed, spec string, participants []db.GetParticipantsRow, history []db.GetWinHistoryRow, date string) (db.GetParticipantsRow, error) {
+	winners, _, err := fairDraw(seed, spec, participants, history, date, 1, false)
+	if err != nil {
+		return db.GetParticipantsRow{}, err
+	}
+	return winners[0], nil
+}
+
+// fairDraw draws up to count distinct winners in rank order from seed, each
+// with the strategy among those not picked yet. Dual rolls with someone left
+// then draw a loser among the others with equal odds from the same
+// generator; loser is nil when none was drawn.
+func fairDraw(seed, spec string, participants []db.GetParticipantsRow, history []db.GetWinHistoryRow, date string, count int, dual bool) (winners []db.GetParticipantsRow, loser *db.GetParticipantsRow, err error) {
+	rng, err := seededRand(seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	strategy := strategyFor(parseStrategySpec(spec))
+	history = historyBefore(history, date)
+
+	rest := slices.Clone(participants)
+	for len(winners) < max(count, 1) && len(rest) > 0 {
+		winner := strategy.Pick(rng, rest, history, date)
+		winners = append(winners, winner)
+		rest = slices.DeleteFunc(rest, func(p db.GetParticipantsRow) bool {
+			return p.UserID == winner.UserID
+		})
+	}
+	if !dual || len(rest) == 0 {
+		return winners, nil, nil
+	}
+	return winners, &rest[rng.IntN(len(rest))], nil
+}
+
+// rollCommitment returns the seed committed for the chat's next roll,
+// committing one first if there is none yet.
+func (h *Handler) rollCommitment(ctx context.Context, chatID int64) (db.GetRollCommitmentRow, error) {
+	commitment, err := h.storage.Queries.GetRollCommitment(ctx, chatID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return commitment, err
+	}
+
+	seed, hash := newSeed()
+	if err := h.storage.Queries.SetRollCommitment(ctx, db.SetRollCommitmentParams{
+		ChatID:   chatID,
+		Seed:     seed,
+		SeedHash: hash,
+	}); err != nil {
+		return db.GetRollCommitmentRow{}, err
+	}
+	return db.GetRollCommitmentRow{Seed: seed, SeedHash: hash}, nil
+}
+
+// handleVerify checks the roll of a game, /verify [game] [YYYY-MM-DD],
+// defaulting to the main game's last roll.
+func (h *Handler) handleVerify(ctx context.Context, msg *Message) error {
+	chatID := msg.Chat.ID
+
+	g, date := mainGame, extractArgs(msg)
+	if first, rest, _ := strings.Cut(date, " "); first != "" {
+		named, ok, err := h.lookupGame(ctx, chatID, first)
+		if err != nil {
+			return err
+		}
+		if ok {
+			g, date = named, strings.TrimSpace(rest)
+		}
+	}
+
+	if date == "" {
+		last, err := h.storage.Queries.GetLastPlayedDate(ctx, db.GetLastPlayedDateParams{
+			ChatID: chatID,
+			GameID: g.ID,
+		})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		date = last
+		if date == "" {
+			date = h.todayFunc()
+		}
+	} else if _, err := time.Parse("2006-01-02", date); err != nil {
+		return h.send(ctx, chatID, h.tr.Get(TrVerifyUsage))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(titled(g, ""))
+	if err := h.writeProof(ctx, &sb, chatID, g.ID, date); err != nil {
+		return err
+	}
+
+	commitment, err := h.rollCommitment(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	sb.WriteString("\n\n")
+	sb.WriteString(h.tr.Getf(TrVerifyNext, commitment.SeedHash))
+
+	return h.send(ctx, chatID, sb.String())
+}
+
+// writeProof recomputes a game's roll of date and describes the outcome.
+func (h *Handler) writeProof(ctx context.Context, sb *strings.Builder, chatID, gameID int64, date string) error {
+	proof, err := h.storage.Queries.GetResultProof(ctx, db.GetResultProofParams{
+		ChatID:     chatID,
+		GameID:     gameID,
+		PlayedDate: date,
+	})
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !proof.Seed.Valid) {
+		sb.WriteString(h.tr.Getf(TrVerifyNoResult, date))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	sb.WriteString(h.tr.Getf(TrVerifyResult, date, proof.SeedHash.String, proof.Seed.String,
+		strings.ReplaceAll(proof.ParticipantIds.String, ",", ", "), proof.Strategy.String))
+	sb.WriteString("\n\n")
+
+	seed, err := hex.DecodeString(proof.Seed.String)
+	if err != nil || seedHash(seed) != proof.SeedHash.String {
+		sb.WriteString(h.tr.Get(TrVerifyHashMismatch))
+		return nil
+	}
+
+	participants, err := parseParticipantIDs(proof.ParticipantIds.String)
+	if err != nil {
+		sb.WriteString(h.tr.Get(TrVerifyMalformed))
+		return nil
+	}
+
+	history, err := h.storage.Queries.GetWinHistory(ctx, db.GetWinHistoryParams{
+		ChatID: chatID,
+		GameID: gameID,
+	})
+	if err != nil {
+		return err
+	}
+
+	recorded, err := h.storage.Queries.GetDrawnWinners(ctx, db.GetDrawnWinnersParams{
+		ChatID:     chatID,
+		GameID:     gameID,
+		PlayedDate: date,
+	})
+	if err != nil {
+		return err
+	}
+
+	picked, loser, err := fairDraw(proof.Seed.String, proof.Strategy.String, participants, history, date, len(recorded), proof.LoserID.Valid)
+	if err != nil {
+		sb.WriteString(h.tr.Get(TrVerifyMalformed))
+		return nil
+	}
+
+	snapshot, err := h.storage.Queries.GetResultParticipants(ctx, db.GetResultParticipantsParams{
+		ChatID:     chatID,
+		GameID:     gameID,
+		PlayedDate: date,
+	})
+	if err != nil {
+		return err
+	}
+	names := make(map[int64]string, len(snapshot))
+	for _, p := range snapshot {
+		names[p.UserID] = p.FirstName
+	}
+	name := func(userID int64) string {
+		if n, ok := names[userID]; ok {
+			return html.EscapeString(n)
+		}
+		// Someone set as the winner after the draw.
+		return h.memberName(ctx, chatID, userID)
+	}
+
+	if len(picked) != len(recorded) {
+		sb.WriteString(h.tr.Get(TrVerifyMalformed))
+		return nil
+	}
+	winners := make([]string, len(picked))
+	for i, p := range picked {
+		if p.UserID != recorded[i].DrawnID {
+			sb.WriteString(h.tr.Getf(TrVerifyWinnerMismatch, name(p.UserID), name(recorded[i].DrawnID)))
+			return nil
+		}
+		winners[i] = name(p.UserID)
+	}
+	if proof.LoserID.Valid && (loser == nil || loser.UserID != proof.LoserID.Int64) {
+		drawn := h.tr.Get(TrVerifyNoLoser)
+		if loser != nil {
+			drawn = name(loser.UserID)
+		}
+		sb.WriteString(h.tr.Getf(TrVerifyLoserMismatch, drawn, name(proof.LoserID.Int64)))
+		return nil
+	}
+	sb.WriteString(h.tr.Getf(TrVerifyOK, strings.Join(winners, ", ")))
+	if loser != nil {
+		sb.WriteString("\n")
+		sb.WriteString(h.tr.Getf(TrVerifyLoserOK, name(loser.UserID)))
+	}
+	for _, r := range recorded {
+		if r.UserID != r.DrawnID {
+			sb.WriteString("\n")
+			sb.WriteString(h.tr.Getf(TrVerifyOverridden, name(r.DrawnID), name(r.UserID)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"telegram-chat-bot/db"
+)
+
+func TestFairPickIsDeterministic(t *testing.T) {
+	seed, hash := newSeed()
+	raw, err := hex.DecodeString(seed)
+	if err != nil {
+		t.Fatalf("decode seed: %v", err)
+	}
+	if seedHash(raw) != hash {
+		t.Fatalf("hash %s does not match seed %s", hash, seed)
+	}
+
+	participants := drawOrder(testParticipants(5))
+	first, err := fairPick(seed, StrategyUniform, participants, nil, "2026-01-15")
+	if err != nil {
+		t.Fatalf("fairPick: %v", err)
+	}
+	for range 10 {
+		got, err := fairPick(seed, StrategyUniform, participants, nil, "2026-01-15")
+		if err != nil {
+			t.Fatalf("fairPick: %v", err)
+		}
+		if got.UserID != first.UserID {
+			t.Fatalf("same seed picked %d and %d", first.UserID, got.UserID)
+		}
+	}
+}
+
+func TestFairPickRejectsBadSeed(t *testing.T) {
+	if _, err := fairPick("abc", StrategyUniform, testParticipants(2), nil, "2026-01-15"); err == nil {
+		t.Error("expected an error for a short seed")
+	}
+}
+
+func TestFairDrawDual(t *testing.T) {
+	participants := drawOrder(testParticipants(3))
+	for range 50 {
+		seed, _ := newSeed()
+		winners, loser, err := fairDraw(seed, StrategyUniform, participants, nil, "2026-01-15", 1, true)
+		if err != nil {
+			t.Fatalf("fairDraw: %v", err)
+		}
+		if len(winners) != 1 || loser == nil || loser.UserID == winners[0].UserID {
+			t.Fatalf("winners %+v drawn with loser %+v", winners, loser)
+		}
+		single, err := fairPick(seed, StrategyUniform, participants, nil, "2026-01-15")
+		if err != nil || single.UserID != winners[0].UserID {
+			t.Fatalf("dual draw picked winner %d, single draw %d", winners[0].UserID, single.UserID)
+		}
+	}
+
+	seed, _ := newSeed()
+	if _, loser, err := fairDraw(seed, StrategyUniform, testParticipants(1), nil, "2026-01-15", 1, true); err != nil || loser != nil {
+		t.Errorf("single participant: loser %+v, err %v", loser, err)
+	}
+}
+
+func TestFairDrawSeveralWinners(t *testing.T) {
+	participants := drawOrder(testParticipants(4))
+	for range 50 {
+		seed, _ := newSeed()
+		winners, loser, err := fairDraw(seed, StrategyDeck, participants, nil, "2026-01-15", 3, true)
+		if err != nil {
+			t.Fatalf("fairDraw: %v", err)
+		}
+		seen := map[int64]bool{}
+		for _, w := range winners {
+			seen[w.UserID] = true
+		}
+		if len(winners) != 3 || len(seen) != 3 || loser == nil || seen[loser.UserID] {
+			t.Fatalf("expected 3 distinct winners and another loser, got %+v and %+v", winners, loser)
+		}
+		first, err := fairPick(seed, StrategyDeck, participants, nil, "2026-01-15")
+		if err != nil || first.UserID != winners[0].UserID {
+			t.Fatalf("rank 1 is %d, single draw %d", winners[0].UserID, first.UserID)
+		}
+	}
+
+	seed, _ := newSeed()
+	winners, loser, err := fairDraw(seed, StrategyUniform, testParticipants(2), nil, "2026-01-15", 5, true)
+	if err != nil || len(winners) != 2 || loser != nil {
+		t.Errorf("expected everyone to win and no loser, got %+v, %+v, %v", winners, loser, err)
+	}
+}
+
+func TestDrawOrderAndParticipantIDs(t *testing.T) {
+	participants := []db.GetParticipantsRow{{UserID: 30}, {UserID: 10}, {UserID: 20}}
+	ids := formatParticipantIDs(drawOrder(participants))
+	if ids != "10,20,30" {
+		t.Fatalf("formatParticipantIDs = %q", ids)
+	}
+
+	parsed, err := parseParticipantIDs(ids)
+	if err != nil {
+		t.Fatalf("parseParticipantIDs: %v", err)
+	}
+	if len(parsed) != 3 || parsed[0].UserID != 10 || parsed[2].UserID != 30 {
+		t.Errorf("unexpected participants: %+v", parsed)
+	}
+	if participants[0].UserID != 30 {
+		t.Error("drawOrder modified its input")
+	}
+}
+
+func TestStrategySpec(t *testing.T) {
+	settings := db.ChatSetting{Strategy: StrategyCooldown, CooldownDays: 5}
+	spec := strategySpec(settings)
+	if spec != "cooldown:5" {
+		t.Fatalf("strategySpec = %q", spec)
+	}
+	if got := parseStrategySpec(spec); got.Strategy != StrategyCooldown || got.CooldownDays != 5 {
+		t.Errorf("parseStrategySpec(%q) = %+v", spec, got)
+	}
+	if got := strategySpec(db.ChatSetting{Strategy: StrategyDeck, CooldownDays: 5}); got != "deck" {
+		t.Errorf("strategySpec = %q", got)
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"telegram-chat-bot/db"
+)
+
+// Named games are extra daily draws of a chat, each rolled with its own
+// command. The chat's main game is rolled with ROLL_COMMAND and is game 0.
+
+const mainGameID = 0
+
+var mainGame = db.Game{ID: mainGameID, Shared: true}
+
+var gameCommandPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// builtinCommands are the fixed commands of HandleUpdate, which games may
+// not take over.
+var builtinCommands = []string{
+	"join", "leave", "stats", "chart", "history", "achievements", "me",
+	"participants", "reset", "newset", "addline", "addmedia", "adddice",
+	"sets", "previewset", "delset", "globalsets", "setrules", "settings",
+	"verify", "set", "games", "addgame", "delgame", "winners",
+	"balance", "richest", "bet", "duel", "duels",
+	"kick", "add", "setwinner", "undo", "audit",
+}
+
+// maxWinners caps how many winners a game picks a day.
+const maxWinners = 10
+
+// titled prefixes text with the title of a named game.
+func titled(g db.Game, text string) string {
+	if g.Title == "" {
+		return text
+	}
+	return "<b>" + html.EscapeString(g.Title) + "</b>\n" + text
+}
+
+// lookupGame finds the game rolled with command, which has no leading
+// slash. The empty command is the main game.
+func (h *Handler) lookupGame(ctx context.Context, chatID int64, command string) (db.Game, bool, error) {
+	if command == "" {
+		return mainGame, true, nil
+	}
+	g, err := h.storage.Queries.GetGameByCommand(ctx, db.GetGameByCommandParams{
+		ChatID:  chatID,
+		Command: strings.ToLower(strings.TrimPrefix(command, "/")),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.Game{}, false, nil
+	}
+	if err != nil {
+		return db.Game{}, false, err
+	}
+	return g, true, nil
+}
+
+// handleGameCommand rolls a named game for /<command>, or shows its stats
+// for /<command>stats and "/<command> stats". It reports whether cmd
+// belongs to a game of the chat.
+func (h *Handler) handleGameCommand(ctx context.Context, msg *Message, cmd string) (bool, error) {
+	name := strings.TrimPrefix(cmd, "/")
+	g, ok, err := h.lookupGame(ctx, msg.Chat.ID, name)
+	if err != nil {
+		return true, err
+	}
+	if ok {
+		args := extractArgs(msg)
+		if sub, ok := strings.CutPrefix(args, "stats"); ok && (sub == "" || sub[0] == ' ') {
+			return true, h.handleStats(ctx, msg, g, strings.TrimSpace(sub))
+		}
+		return true, h.handleRoulette(ctx, msg, g)
+	}
+
+	base, ok := strings.CutSuffix(name, "stats")
+	if !ok || base == "" {
+		return false, nil
+	}
+	g, ok, err = h.lookupGame(ctx, msg.Chat.ID, base)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return true, h.handleStats(ctx, msg, g, extractArgs(msg))
+}
+
+// gameParticipants returns who a game draws from.
+func (h *Handler) gameParticipants(ctx context.Context, chatID int64, g db.Game) ([]db.GetParticipantsRow, error) {
+	if g.Shared {
+		return h.storage.Queries.GetParticipants(ctx, chatID)
+	}
+	rows, err := h.storage.Queries.GetGameParticipants(ctx, g.ID)
+	if err != nil {
+		return nil, err
+	}
+	participants := make([]db.GetParticipantsRow, len(rows))
+	for i, r := range rows {
+		participants[i] = db.GetParticipantsRow(r)
+	}
+	return participants, nil
+}
+
+// gameWinners returns how many winners a game picks a day.
+func (h *Handler) gameWinners(ctx context.Context, chatID, gameID int64) (int64, error) {
+	n, err := h.storage.Queries.GetGameWinners(ctx, db.GetGameWinnersParams{
+		ChatID: chatID,
+		GameID: gameID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return 1, nil
+	}
+	return n, err
+}
+
+// handleWinners shows or, for admins, changes how many winners a game picks
+// a day: /winners [game] [count].
+func (h *Handler) handleWinners(ctx context.Context, msg *Message) error {
+	chatID := msg.Chat.ID
+	fields := strings.Fields(extractArgs(msg))
+
+	count := int64(0)
+	if len(fields) > 0 {
+		if n, err := strconv.ParseInt(fields[len(fields)-1], 10, 64); err == nil {
+			if n < 1 || n > maxWinners {
+				return h.send(ctx, chatID, h.tr.Get(TrWinnersUsage))
+			}
+			count = n
+			fields = fields[:len(fields)-1]
+		}
+	}
+	if len(fields) > 1 {
+		return h.send(ctx, chatID, h.tr.Get(TrWinnersUsage))
+	}
+
+	command := strings.Join(fields, "")
+	g, ok, err := h.lookupGame(ctx, chatID, command)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return h.send(ctx, chatID, h.tr.Getf(TrGameUnknown, command))
+	}
+	title := h.tr.Get(TrMainGame)
+	if g.Title != "" {
+		title = "<b>" + html.EscapeString(g.Title) + "</b>"
+	}
+
+	if count == 0 {
+		n, err := h.gameWinners(ctx, chatID, g.ID)
+		if err != nil {
+			return err
+		}
+		return h.send(ctx, chatID, h.tr.Getf(TrWinnersShow, title, n))
+	}
+
+	if !h.canAdmin(msg.From.ID) {
+		return nil
+	}
+	previous, err := h.gameWinners(ctx, chatID, g.ID)
+	if err != nil {
+		return err
+	}
+	if err := h.storage.InTx(ctx, func(q *db.Queries) error {
+		if err := q.SetGameWinners(ctx, db.SetGameWinnersParams{
+			ChatID:  chatID,
+			GameID:  g.ID,
+			Winners: count,
+		}); err != nil {
+			return err
+		}
+		return newAudit(chatID, msg.From.ID, AuditWinners,
+			auditState{"game": g.Command, "winners": previous}, auditState{"game": g.Command, "winners": count}).record(ctx, q)
+	}); err != nil {
+		return err
+	}
+	return h.send(ctx, chatID, h.tr.Getf(TrWinnersUpdated, title, count))
+}
+
+func (h *Handler) handleGames(ctx context.Context, msg *Message) error {
+	games, err := h.storage.Queries.ListGames(ctx, msg.Chat.ID)
+	if err != nil {
+		return err
+	}
+	if len(games) == 0 {
+		return h.send(ctx, msg.Chat.ID, h.tr.Get(TrGamesEmpty))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(h.tr.Get(TrGamesHeader))
+	sb.WriteString("\n")
+	for _, g := range games {
+		players := h.tr.Get(TrGamesShared)
+		if !g.Shared {
+			players = h.tr.Getf(TrGamesOwn, g.Players)
+		}
+		sb.WriteString("\n")
+		sb.WriteString(h.tr.Getf(TrGamesLine, g.Command, html.EscapeString(g.Title), players))
+	}
+	return h.send(ctx, msg.Chat.ID, sb.String())
+}
+
+// handleAddGame creates a named game: /addgame <command> <shared|own> <title>.
+func (h *Handler) handleAddGame(ctx context.Context, msg *Message) error {
+	if !h.canAdmin(msg.From.ID) {
+		return nil
+	}
+
+	chatID := msg.Chat.ID
+	fields := strings.Fields(extractArgs(msg))
+	if len(fields) < 3 || (fields[1] != "shared" && fields[1] != "own") {
+		return h.send(ctx, chatID, h.tr.Get(TrAddGameUsage))
+	}
+	command := strings.ToLower(strings.TrimPrefix(fields[0], "/"))
+	title := strings.Join(fields[2:], " ")
+
+	if !gameCommandPattern.MatchString(command) ||
+		slices.Contains(builtinCommands, command) ||
+		strings.HasSuffix(command, "stats") ||
+		strings.HasPrefix("/"+command, h.rollCmd) {
+		return h.send(ctx, chatID, h.tr.Getf(TrAddGameInvalidCommand, command))
+	}
+
+	if _, ok, err := h.lookupGame(ctx, chatID, command); err != nil {
+		return err
+	} else if ok {
+		return h.send(ctx, chatID, h.tr.Getf(TrAddGameExists, command))
+	}
+
+	if err := h.storage.InTx(ctx, func(q *db.Queries) error {
+		if _, err := q.CreateGame(ctx, db.CreateGameParams{
+			ChatID:  chatID,
+			Command: command,
+			Title:   title,
+			Shared:  fields[1] == "shared",
+		}); err != nil {
+			return err
+		}
+		return newAudit(chatID, msg.From.ID, AuditAddGame, nil, auditGame(command, title, fields[1] == "shared")).record(ctx, q)
+	}); err != nil {
+		return err
+	}
+	return h.send(ctx, chatID, h.tr.Getf(TrAddGameCreated, html.EscapeString(title), command, command))
+}
+
+// handleDeleteGame removes a named game with its results and message sets.
+func (h *Handler) handleDeleteGame(ctx context.Context, msg *Message) error {
+	if !h.canAdmin(msg.From.ID) {
+		return nil
+	}
+
+	chatID := msg.Chat.ID
+	command := extractArgs(msg)
+	if command == "" {
+		return h.send(ctx, chatID, h.tr.Get(TrDelGameUsage))
+	}
+	g, ok, err := h.lookupGame(ctx, chatID, command)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return h.send(ctx, chatID, h.tr.Getf(TrGameUnknown, command))
+	}
+
+	audit := newAudit(chatID, msg.From.ID, AuditDelGame, auditGame(g.Command, g.Title, g.Shared), nil)
+	if err := h.storage.DeleteGame(ctx, g, audit); err != nil {
+		return err
+	}
+	return h.send(ctx, chatID, h.tr.Getf(TrDelGameDeleted, html.EscapeString(g.Title)))
+}
+
+// joinGame adds the sender to the own participant list of a named game.
+func (h *Handler) joinGame(ctx context.Context, msg *Message, command string) error {
+	chatID := msg.Chat.ID
+	g, ok, err := h.lookupGame(ctx, chatID, command)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return h.send(ctx, chatID, h.tr.Getf(TrGameUnknown, command))
+	}
+	if g.Shared {
+		return h.send(ctx, chatID, h.tr.Getf(TrGameSharedList, html.EscapeString(g.Title)))
+	}
+
+	joined, err := h.storage.JoinNamedGame(ctx, g, msg.From,
+		newAudit(chatID, msg.From.ID, AuditJoin, nil, auditState{"game": g.Command, "user_id": msg.From.ID, "name": msg.From.FirstName}))
+	if err != nil {
+		return err
+	}
+	if !joined {
+		return h.send(ctx, chatID, h.tr.Getf(TrGameAlreadyJoined, html.EscapeString(g.Title)))
+	}
+	return h.send(ctx, chatID, h.tr.Getf(TrGameJoined, html.EscapeString(msg.From.FirstName), html.EscapeString(g.Title)))
+}
+
+// leaveGame removes the sender from the own participant list of a named
+// game. Their results are kept.
+func (h *Handler) leaveGame(ctx context.Context, msg *Message, command string) error {
+	chatID := msg.Chat.ID
+	g, ok, err := h.lookupGame(ctx, chatID, command)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return h.send(ctx, chatID, h.tr.Getf(TrGameUnknown, command))
+	}
+	if g.Shared {
+		return h.send(ctx, chatID, h.tr.Getf(TrGameSharedList, html.EscapeString(g.Title)))
+	}
+
+	var left bool
+	err = h.storage.InTx(ctx, func(q *db.Queries) error {
+		res, err := q.RemoveGameParticipant(ctx, db.RemoveGameParticipantParams{
+			GameID: g.ID,
+			UserID: msg.From.ID,
+		})
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		left = n > 0
+		if err != nil || !left {
+			return err
+		}
+		return newAudit(chatID, msg.From.ID, AuditLeave,
+			auditState{"game": g.Command, "user_id": msg.From.ID, "name": msg.From.FirstName}, nil).record(ctx, q)
+	})
+	if err != nil {
+		return err
+	}
+	if !left {
+		return h.send(ctx, chatID, h.tr.Getf(TrGameNotJoined, html.EscapeString(g.Title)))
+	}
+	return h.send(ctx, chatID, h.tr.Getf(TrGameLeft, html.EscapeString(msg.From.FirstName), html.EscapeString(g.Title)))
+}
@@ -5,19 +5,40 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"html"
 	"log"
 	"math/rand/v2"
-	"strconv"
+	"slices"
 	"strings"
 	"time"
+	"unicode/utf16"
 
 	"telegram-chat-bot/db"
 )
 
 type MessageSender interface {
 	SendMessage(ctx context.Context, req SendMessageRequest) error
+	SendSticker(ctx context.Context, req SendStickerRequest) error
+	SendAnimation(ctx context.Context, req SendAnimationRequest) error
+	SendPhoto(ctx context.Context, req SendPhotoRequest) error
+	SendPhotoUpload(ctx context.Context, req SendPhotoUploadRequest) error
+	SendDice(ctx context.Context, req SendDiceRequest) error
+	EditMessageText(ctx context.Context, req EditMessageTextRequest) error
+	AnswerCallbackQuery(ctx context.Context, req AnswerCallbackQueryRequest) error
 }
 
+// Step kinds stored in set_messages.kind. Media steps keep the Telegram
+// file_id in body and an optional caption; dice steps keep the emoji.
+const (
+	StepText      = "text"
+	StepSticker   = "sticker"
+	StepAnimation = "animation"
+	StepPhoto     = "photo"
+	StepDice      = "dice"
+)
+
+var diceEmojis = []string{"🎲", "🎯", "🏀", "⚽", "🎳", "🎰"}
+
 type Handler struct {
 	bot       MessageSender
 	storage   *Storage
@@ -27,6 +48,8 @@ type Handler struct {
 	adminIDs  map[int64]struct{}
 	chatIDs   map[int64]struct{}
 	todayFunc func() string
+	stepDelay time.Duration
+	rng       *rand.Rand
 }
 
 func NewHandler(bot MessageSender, storage *Storage, tr *Translator, botName, rollCmd string, adminIDs, chatIDs []int64, loc *time.Location) *Handler {
@@ -47,10 +70,20 @@ func NewHandler(bot MessageSender, storage *Storage, tr *Translator, botName, ro
 		adminIDs:  admins,
 		chatIDs:   chats,
 		todayFunc: func() string { return time.Now().In(loc).Format("2006-01-02") },
+		stepDelay: 2 * time.Second,
+		rng:       rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
 	}
 }
 
 func (h *Handler) HandleUpdate(ctx context.Context, update Update) {
+	if update.CallbackQuery != nil {
+		h.handleCallback(ctx, update.CallbackQuery)
+		return
+	}
+	if update.ChatMember != nil || update.MyChatMember != nil {
+		h.handleMembership(ctx, update)
+		return
+	}
 	if update.Message == nil || update.Message.From == nil {
 		return
 	}
@@ -72,24 +105,94 @@ func (h *Handler) HandleUpdate(ctx context.Context, update Update) {
 		suffix := cmd[len(h.rollCmd):]
 		args := extractArgs(msg)
 		if strings.HasPrefix(suffix, "stats") {
-			err = h.handleStats(ctx, msg, args)
+			err = h.handleStats(ctx, msg, mainGame, args)
 		} else if sub, ok := strings.CutPrefix(args, "stats"); ok && (sub == "" || sub[0] == ' ') {
-			err = h.handleStats(ctx, msg, strings.TrimSpace(sub))
+			err = h.handleStats(ctx, msg, mainGame, strings.TrimSpace(sub))
 		} else {
-			err = h.handleRoulette(ctx, msg)
+			err = h.handleRoulette(ctx, msg, mainGame)
 		}
 	} else {
 		switch cmd {
 		case "/join":
-			err = h.handleJoin(ctx, msg)
+			if args := extractArgs(msg); args != "" {
+				err = h.joinGame(ctx, msg, args)
+			} else {
+				err = h.handleJoin(ctx, msg)
+			}
 		case "/leave":
-			err = h.handleLeave(ctx, msg)
+			if args := extractArgs(msg); args != "" {
+				err = h.leaveGame(ctx, msg, args)
+			} else {
+				err = h.handleLeave(ctx, msg)
+			}
 		case "/stats":
-			err = h.handleStats(ctx, msg, extractArgs(msg))
+			err = h.handleStats(ctx, msg, mainGame, extractArgs(msg))
+		case "/chart":
+			err = h.handleChart(ctx, msg)
+		case "/history":
+			err = h.handleHistory(ctx, msg)
+		case "/achievements":
+			err = h.handleAchievements(ctx, msg)
+		case "/me":
+			err = h.handleMe(ctx, msg)
 		case "/participants":
 			err = h.handleParticipants(ctx, msg)
 		case "/reset":
 			err = h.handleReset(ctx, msg)
+		case "/newset":
+			err = h.handleNewSet(ctx, msg)
+		case "/addline":
+			err = h.handleAddLine(ctx, msg)
+		case "/addmedia":
+			err = h.handleAddMedia(ctx, msg)
+		case "/adddice":
+			err = h.handleAddDice(ctx, msg)
+		case "/sets":
+			err = h.handleSets(ctx, msg)
+		case "/previewset":
+			err = h.handlePreviewSet(ctx, msg)
+		case "/delset":
+			err = h.handleDeleteSet(ctx, msg)
+		case "/globalsets":
+			err = h.handleGlobalSets(ctx, msg)
+		case "/setrules":
+			err = h.handleSetRules(ctx, msg)
+		case "/settings":
+			err = h.handleSettings(ctx, msg)
+		case "/verify":
+			err = h.handleVerify(ctx, msg)
+		case "/set":
+			err = h.handleSet(ctx, msg)
+		case "/games":
+			err = h.handleGames(ctx, msg)
+		case "/addgame":
+			err = h.handleAddGame(ctx, msg)
+		case "/delgame":
+			err = h.handleDeleteGame(ctx, msg)
+		case "/winners":
+			err = h.handleWinners(ctx, msg)
+		case "/bet":
+			err = h.handleBet(ctx, msg)
+		case "/balance":
+			err = h.handleBalance(ctx, msg)
+		case "/richest":
+			err = h.handleRichest(ctx, msg)
+		case "/duel":
+			err = h.handleDuel(ctx, msg)
+		case "/duels":
+			err = h.handleDuels(ctx, msg)
+		case "/kick":
+			err = h.handleKick(ctx, msg)
+		case "/add":
+			err = h.handleAdd(ctx, msg)
+		case "/setwinner":
+			err = h.handleSetWinner(ctx, msg)
+		case "/undo":
+			err = h.handleUndo(ctx, msg)
+		case "/audit":
+			err = h.handleAudit(ctx, msg)
+		default:
+			_, err = h.handleGameCommand(ctx, msg, cmd)
 		}
 	}
 
@@ -98,6 +201,40 @@ func (h *Handler) HandleUpdate(ctx context.Context, update Update) {
 	}
 }
 
+// handleCallback dispatches inline keyboard presses by the prefix of their
+// callback data and always answers the query so the client stops waiting.
+func (h *Handler) handleCallback(ctx context.Context, cq *CallbackQuery) {
+	if cq.Message == nil {
+		return
+	}
+	if len(h.chatIDs) > 0 {
+		if _, ok := h.chatIDs[cq.Message.Chat.ID]; !ok {
+			return
+		}
+	}
+
+	action, data, _ := strings.Cut(cq.Data, ":")
+
+	var answer string
+	var err error
+	switch action {
+	case "history":
+		err = h.handleHistoryPage(ctx, cq.Message, data)
+	case "duel":
+		answer, err = h.handleDuelCallback(ctx, cq, data)
+	}
+	if err != nil {
+		log.Printf("Error handling callback %s: %v", action, err)
+	}
+
+	if err := h.bot.AnswerCallbackQuery(ctx, AnswerCallbackQueryRequest{
+		CallbackQueryID: cq.ID,
+		Text:            answer,
+	}); err != nil {
+		log.Printf("Error answering callback %s: %v", action, err)
+	}
+}
+
 func extractCommand(msg *Message, botName string) string {
 	if len(msg.Entities) == 0 {
 		return ""
@@ -136,12 +273,12 @@ func (h *Handler) send(ctx context.Context, chatID int64, text string) error {
 
 func (h *Handler) handleJoin(ctx context.Context, msg *Message) error {
 	user := msg.From
-	err := h.storage.Queries.AddParticipant(ctx, db.AddParticipantParams{
+	err := h.storage.JoinGame(ctx, db.AddParticipantParams{
 		ChatID:    msg.Chat.ID,
 		UserID:    user.ID,
 		FirstName: user.FirstName,
 		Username:  user.Username,
-	})
+	}, newAudit(msg.Chat.ID, user.ID, AuditJoin, nil, auditUser(user)))
 	if err != nil {
 		return err
 	}
@@ -151,21 +288,13 @@ func (h *Handler) handleJoin(ctx context.Context, msg *Message) error {
 
 func (h *Handler) handleLeave(ctx context.Context, msg *Message) error {
 	user := msg.From
-	result, err := h.storage.Queries.RemoveParticipant(ctx, db.RemoveParticipantParams{
-		ChatID: msg.Chat.ID,
-		UserID: user.ID,
-	})
-	if err != nil {
-		return err
-	}
-
-	rows, err := result.RowsAffected()
+	left, err := h.storage.LeaveGame(ctx, msg.Chat.ID, user.ID, newAudit(msg.Chat.ID, user.ID, AuditLeave, auditUser(user), nil))
 	if err != nil {
 		return err
 	}
 
 	var text string
-	if rows > 0 {
+	if left {
 		text = h.tr.Getf(TrLeaveSuccess, user.FirstName)
 	} else {
 		text = h.tr.Get(TrLeaveNotInGame)
@@ -173,80 +302,282 @@ func (h *Handler) handleLeave(ctx context.Context, msg *Message) error {
 	return h.send(ctx, msg.Chat.ID, text)
 }
 
-func (h *Handler) handleRoulette(ctx context.Context, msg *Message) error {
+// handleRoulette draws today's result of a game, or shows it when the game
+// was already rolled. A dormant chat is never drawn: the bot can't announce
+// the result there.
+func (h *Handler) handleRoulette(ctx context.Context, msg *Message, g db.Game) error {
 	chatID := msg.Chat.ID
 	date := h.todayFunc()
 
-	existing, err := h.storage.Queries.GetTodayResult(ctx, db.GetTodayResultParams{
+	dormant, err := h.isDormant(ctx, chatID)
+	if err != nil || dormant {
+		return err
+	}
+
+	existing, err := h.storage.Queries.GetTodayResults(ctx, db.GetTodayResultsParams{
 		ChatID:     chatID,
+		GameID:     g.ID,
 		PlayedDate: date,
 	})
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+	if err != nil {
 		return err
 	}
-	if err == nil {
-		return h.showExistingResult(ctx, msg, existing)
+	if len(existing) > 0 {
+		return h.showExistingResult(ctx, msg, g, existing)
 	}
 
-	participants, err := h.storage.Queries.GetParticipants(ctx, chatID)
+	participants, err := h.gameParticipants(ctx, chatID, g)
 	if err != nil {
 		return err
 	}
 
 	if len(participants) == 0 {
-		return h.send(ctx, chatID, h.tr.Get(TrNoParticipants))
+		return h.send(ctx, chatID, titled(g, h.tr.Get(TrNoParticipants)))
+	}
+
+	settings, err := h.chatSettings(ctx, chatID)
+	if err != nil {
+		return err
 	}
 
-	winner := participants[rand.IntN(len(participants))]
+	history, err := h.storage.Queries.GetWinHistory(ctx, db.GetWinHistoryParams{
+		ChatID: chatID,
+		GameID: g.ID,
+	})
+	if err != nil {
+		return err
+	}
 
-	if err := h.storage.Queries.SaveResult(ctx, db.SaveResultParams{
-		ChatID:     chatID,
-		UserID:     winner.UserID,
-		PlayedDate: date,
+	count, err := h.gameWinners(ctx, chatID, g.ID)
+	if err != nil {
+		return err
+	}
+
+	commitment, err := h.rollCommitment(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	participants = drawOrder(participants)
+	spec := strategySpec(settings)
+	winners, loser, err := fairDraw(commitment.Seed, spec, participants, history, date, int(count), settings.DrawMode == DrawDual)
+	if err != nil {
+		return err
+	}
+
+	setID, err := h.pickMessageSet(ctx, settings, g.ID, date)
+	if err != nil {
+		return err
+	}
+
+	var loserID sql.NullInt64
+	var loserName sql.NullString
+	if loser != nil {
+		loserID = sql.NullInt64{Int64: loser.UserID, Valid: true}
+		loserName = sql.NullString{String: loser.FirstName, Valid: true}
+	}
+
+	var bets []betOutcome
+	if err := h.storage.InTx(ctx, func(q *db.Queries) error {
+		resultID, err := q.SaveResult(ctx, db.SaveResultParams{
+			ChatID:         chatID,
+			GameID:         g.ID,
+			UserID:         winners[0].UserID,
+			PlayedDate:     date,
+			Rank:           1,
+			SetID:          setID,
+			Seed:           sql.NullString{String: commitment.Seed, Valid: true},
+			SeedHash:       sql.NullString{String: commitment.SeedHash, Valid: true},
+			ParticipantIds: sql.NullString{String: formatParticipantIDs(participants), Valid: true},
+			Strategy:       sql.NullString{String: spec, Valid: true},
+			WinnerName:     sql.NullString{String: winners[0].FirstName, Valid: true},
+			LoserID:        loserID,
+			LoserName:      loserName,
+		})
+		if err != nil {
+			return err
+		}
+		resultIDs := []int64{resultID}
+		for i, w := range winners[1:] {
+			id, err := q.SaveResult(ctx, db.SaveResultParams{
+				ChatID:     chatID,
+				GameID:     g.ID,
+				UserID:     w.UserID,
+				PlayedDate: date,
+				Rank:       int64(i + 2),
+				WinnerName: sql.NullString{String: w.FirstName, Valid: true},
+			})
+			if err != nil {
+				return err
+			}
+			resultIDs = append(resultIDs, id)
+		}
+		// Points and bets are about the main game only.
+		if g.ID == mainGameID {
+			if err := creditRoll(ctx, q, chatID, winners, participants, resultIDs); err != nil {
+				return err
+			}
+			if bets, err = settleBets(ctx, q, chatID, date, settings.Strategy, winners, participants, resultID); err != nil {
+				return err
+			}
+		}
+		for i, p := range participants {
+			if err := q.AddResultParticipant(ctx, db.AddResultParticipantParams{
+				ResultID:  resultID,
+				Position:  int64(i),
+				UserID:    p.UserID,
+				FirstName: p.FirstName,
+			}); err != nil {
+				return err
+			}
+		}
+		seed, hash := newSeed()
+		if err := q.SetRollCommitment(ctx, db.SetRollCommitmentParams{ChatID: chatID, Seed: seed, SeedHash: hash}); err != nil {
+			return err
+		}
+		winnerIDs := make([]int64, len(winners))
+		for i, w := range winners {
+			winnerIDs[i] = w.UserID
+		}
+		return newAudit(chatID, msg.From.ID, AuditRoll, nil, auditDay(g, date, winnerIDs)).record(ctx, q)
 	}); err != nil {
-		existing, err2 := h.storage.Queries.GetTodayResult(ctx, db.GetTodayResultParams{
+		existing, err2 := h.storage.Queries.GetTodayResults(ctx, db.GetTodayResultsParams{
 			ChatID:     chatID,
+			GameID:     g.ID,
 			PlayedDate: date,
 		})
+		if err2 == nil && len(existing) == 0 {
+			err2 = sql.ErrNoRows
+		}
 		if err2 != nil {
 			return fmt.Errorf("save result: %w; fetch existing: %w", err, err2)
 		}
-		return h.showExistingResult(ctx, msg, existing)
+		return h.showExistingResult(ctx, msg, g, existing)
 	}
 
-	winnerTag := fmt.Sprintf(`<a href="tg://user?id=%d"><b>%s</b></a>`, winner.UserID, winner.FirstName)
-
-	setID, err := h.storage.Queries.GetRandomMessageSetID(ctx)
+	vars, err := h.templateVars(ctx, chatID, g.ID, winners, loser, participants, date)
 	if err != nil {
-		text := h.tr.Getf(TrFallbackWinner, winnerTag)
-		return h.send(ctx, chatID, text)
+		return err
+	}
+
+	if err := h.announceWinner(ctx, chatID, g, setID, vars); err != nil {
+		return err
+	}
+	if len(bets) > 0 {
+		if err := h.sendBetSummary(ctx, chatID, bets); err != nil {
+			return err
+		}
+	}
+
+	// Badges are about the main game only.
+	if g.ID != mainGameID {
+		return nil
+	}
+	for _, w := range winners {
+		if err := h.awardAchievements(ctx, chatID, w, date); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// announceWinner plays the chosen message set, or the fallback announcement
+// when there is none.
+func (h *Handler) announceWinner(ctx context.Context, chatID int64, g db.Game, setID sql.NullInt64, vars templateVars) error {
+	if !setID.Valid {
+		return h.send(ctx, chatID, titled(g, h.fallbackAnnouncement(vars)))
 	}
 
-	messages, err := h.storage.Queries.GetSetMessages(ctx, setID)
+	messages, err := h.storage.Queries.GetSetMessages(ctx, setID.Int64)
 	if err != nil {
-		log.Printf("Error fetching message set %d: %v", setID, err)
-		text := h.tr.Getf(TrFallbackWinner, winnerTag)
-		return h.send(ctx, chatID, text)
+		log.Printf("Error fetching message set %d: %v", setID.Int64, err)
+		return h.send(ctx, chatID, titled(g, h.fallbackAnnouncement(vars)))
 	}
 
-	h.sendAnnouncement(ctx, chatID, messages, winnerTag)
+	h.sendAnnouncement(ctx, chatID, messages, vars)
 
 	return nil
 }
 
-func (h *Handler) sendAnnouncement(ctx context.Context, chatID int64, messages []string, winnerTag string) {
-	for i, body := range messages {
-		text := body
-		if i == len(messages)-1 {
-			text = fmt.Sprintf(body, winnerTag)
+// fallbackAnnouncement names the winners, and the loser of a dual roll.
+func (h *Handler) fallbackAnnouncement(vars templateVars) string {
+	text := h.tr.Getf(TrFallbackWinner, vars.Mention)
+	if len(vars.Winners) > 1 {
+		text = renderTemplate(h.tr.Get(TrFallbackWinners), vars)
+	}
+	if vars.LoserMention != "" {
+		text += "\n" + renderTemplate(h.tr.Get(TrFallbackLoser), vars)
+	}
+	return text
+}
+
+func mentionTag(userID int64, name string) string {
+	return fmt.Sprintf(`<a href="tg://user?id=%d"><b>%s</b></a>`, userID, html.EscapeString(name))
+}
+
+// templateVars collects the placeholder values for announcing winners, in
+// rank order, and the loser if one was drawn.
+func (h *Handler) templateVars(ctx context.Context, chatID, gameID int64, winners []db.GetParticipantsRow, loser *db.GetParticipantsRow, participants []db.GetParticipantsRow, date string) (templateVars, error) {
+	winner := winners[0]
+	dates, err := h.storage.Queries.GetUserWinDates(ctx, db.GetUserWinDatesParams{
+		ChatID: chatID,
+		GameID: gameID,
+		UserID: winner.UserID,
+	})
+	if err != nil {
+		return templateVars{}, err
+	}
+
+	random := winner.FirstName
+	var others []db.GetParticipantsRow
+	for _, p := range participants {
+		if !slices.ContainsFunc(winners, func(w db.GetParticipantsRow) bool { return w.UserID == p.UserID }) {
+			others = append(others, p)
 		}
+	}
+	if len(others) > 0 {
+		random = others[h.rng.IntN(len(others))].FirstName
+	}
+
+	vars := templateVars{
+		Winner:  html.EscapeString(winner.FirstName),
+		Mention: mentionTag(winner.UserID, winner.FirstName),
+		Count:   len(participants),
+		Wins:    len(dates),
+		Streak:  winStreak(dates, date),
+		Random:  html.EscapeString(random),
+		Date:    date,
+	}
+	for _, w := range winners {
+		vars.Winners = append(vars.Winners, mentionTag(w.UserID, w.FirstName))
+	}
+	if loser != nil {
+		vars.Loser = html.EscapeString(loser.FirstName)
+		vars.LoserMention = mentionTag(loser.UserID, loser.FirstName)
+	}
+	return vars, nil
+}
+
+// sendAnnouncement plays a message set. Sets that never name the winner, all
+// winners of a game with several, or the loser of a dual roll, are followed
+// by the fallback announcement.
+func (h *Handler) sendAnnouncement(ctx context.Context, chatID int64, steps []db.GetSetMessagesRow, vars templateVars) {
+	if len(vars.Winners) > 1 && !mentionsAllWinners(steps) {
+		steps = append(steps, db.GetSetMessagesRow{Kind: StepText, Body: h.tr.Get(TrFallbackWinners)})
+	} else if !mentionsWinner(steps) {
+		steps = append(steps, db.GetSetMessagesRow{Kind: StepText, Body: h.tr.Get(TrFallbackWinner)})
+	}
+	if vars.LoserMention != "" && !mentionsLoser(steps) {
+		steps = append(steps, db.GetSetMessagesRow{Kind: StepText, Body: h.tr.Get(TrFallbackLoser)})
+	}
 
-		if err := h.send(ctx, chatID, text); err != nil {
+	for i, step := range steps {
+		if err := h.sendStep(ctx, chatID, step, vars); err != nil {
 			log.Printf("Error sending sequence message: %v", err)
 		}
-		if i < len(messages)-1 {
+		if i < len(steps)-1 {
 			select {
-			case <-time.After(2 * time.Second):
+			case <-time.After(h.stepDelay):
 			case <-ctx.Done():
 				return
 			}
@@ -254,57 +585,197 @@ func (h *Handler) sendAnnouncement(ctx context.Context, chatID int64, messages [
 	}
 }
 
-func (h *Handler) showExistingResult(ctx context.Context, msg *Message, result db.GetTodayResultRow) error {
-	p, err := h.storage.Queries.GetParticipantByID(ctx, db.GetParticipantByIDParams{
-		ChatID: result.ChatID,
-		UserID: result.UserID,
-	})
+func (h *Handler) sendStep(ctx context.Context, chatID int64, step db.GetSetMessagesRow, vars templateVars) error {
+	switch step.Kind {
+	case StepSticker:
+		return h.bot.SendSticker(ctx, SendStickerRequest{
+			ChatID:  chatID,
+			Sticker: step.Body,
+		})
+	case StepAnimation:
+		return h.bot.SendAnimation(ctx, SendAnimationRequest{
+			ChatID:    chatID,
+			Animation: step.Body,
+			Caption:   renderTemplate(step.Caption, vars),
+			ParseMode: "HTML",
+		})
+	case StepPhoto:
+		return h.bot.SendPhoto(ctx, SendPhotoRequest{
+			ChatID:    chatID,
+			Photo:     step.Body,
+			Caption:   renderTemplate(step.Caption, vars),
+			ParseMode: "HTML",
+		})
+	case StepDice:
+		return h.bot.SendDice(ctx, SendDiceRequest{
+			ChatID: chatID,
+			Emoji:  step.Body,
+		})
+	default:
+		return h.send(ctx, chatID, renderTemplate(step.Body, vars))
+	}
+}
 
-	var name string
-	if errors.Is(err, sql.ErrNoRows) {
-		name = h.tr.Getf(TrUnknownUser, result.UserID)
-	} else if err != nil {
-		return err
-	} else {
-		name = p.FirstName
+// validateStep checks a message set step before it is stored.
+func validateStep(kind, body, caption string) error {
+	switch kind {
+	case StepText:
+		if body == "" {
+			return errors.New("text step has no body")
+		}
+		if name := validateTemplate(body); name != "" {
+			return templateError(name)
+		}
+	case StepSticker, StepAnimation, StepPhoto:
+		if body == "" {
+			return fmt.Errorf("%s step has no file_id", kind)
+		}
+		if name := validateTemplate(caption); name != "" {
+			return templateError(name)
+		}
+	case StepDice:
+		if !slices.Contains(diceEmojis, body) {
+			return fmt.Errorf("unsupported dice emoji %q, use one of %s", body, strings.Join(diceEmojis, " "))
+		}
+	default:
+		return fmt.Errorf("unknown step type %q", kind)
 	}
+	return nil
+}
 
-	text := h.tr.Getf(TrAlreadyPlayed, "<b>"+name+"</b>")
-	return h.send(ctx, msg.Chat.ID, text)
+// showExistingResult repeats today's winners of a game in rank order.
+func (h *Handler) showExistingResult(ctx context.Context, msg *Message, g db.Game, results []db.GetTodayResultsRow) error {
+	names := make([]string, len(results))
+	for i, result := range results {
+		name := result.WinnerName.String
+		if !result.WinnerName.Valid {
+			p, err := h.storage.Queries.GetParticipantByID(ctx, db.GetParticipantByIDParams{
+				ChatID: result.ChatID,
+				UserID: result.UserID,
+			})
+			if errors.Is(err, sql.ErrNoRows) {
+				name = h.tr.Getf(TrUnknownUser, result.UserID)
+			} else if err != nil {
+				return err
+			} else {
+				name = p.FirstName
+			}
+		}
+		names[i] = "<b>" + html.EscapeString(name) + "</b>"
+	}
+
+	text := h.tr.Getf(TrAlreadyPlayed, names[0])
+	if len(names) > 1 {
+		for i := range names {
+			names[i] = fmt.Sprintf("%d. %s", i+1, names[i])
+		}
+		text = h.tr.Getf(TrAlreadyPlayedWinners, strings.Join(names, "\n"))
+	}
+	if results[0].LoserName.Valid {
+		text += "\n" + h.tr.Getf(TrAlreadyPlayedLoser, "<b>"+html.EscapeString(results[0].LoserName.String)+"</b>")
+	}
+	return h.send(ctx, msg.Chat.ID, titled(g, text))
 }
 
 func extractArgs(msg *Message) string {
 	if len(msg.Entities) == 0 {
 		return ""
 	}
-	runes := []rune(msg.Text)
-	rest := runes[msg.Entities[0].Length:]
-	return strings.TrimSpace(string(rest))
+	units := utf16.Encode([]rune(msg.Text))
+	end := msg.Entities[0].Offset + msg.Entities[0].Length
+	if end > len(units) {
+		return ""
+	}
+	return strings.TrimSpace(string(utf16.Decode(units[end:])))
+}
+
+// entityText returns the text an entity covers. Telegram counts entity
+// offsets and lengths in UTF-16 code units.
+func entityText(text string, e MessageEntity) string {
+	units := utf16.Encode([]rune(text))
+	if e.Offset < 0 || e.Length < 0 || e.Offset+e.Length > len(units) {
+		return ""
+	}
+	return string(utf16.Decode(units[e.Offset : e.Offset+e.Length]))
+}
+
+// targetUser resolves who a command is about: the first user mentioned
+// after the command, or else the author of the message it replies to. A
+// text_mention carries the user itself; a @username mention is looked up
+// among the chat's players. mention is the mentioned text, or the author's
+// name for a reply, and user is nil when it names nobody known.
+func (h *Handler) targetUser(ctx context.Context, msg *Message) (user *User, mention string, err error) {
+	for _, e := range msg.Entities {
+		switch e.Type {
+		case "text_mention":
+			if e.User != nil {
+				return e.User, entityText(msg.Text, e), nil
+			}
+		case "mention":
+			username, ok := usernameArg(entityText(msg.Text, e))
+			if !ok {
+				continue
+			}
+			mention = "@" + username
+			p, err := h.storage.Queries.GetParticipantByUsername(ctx, db.GetParticipantByUsernameParams{
+				ChatID:   msg.Chat.ID,
+				Username: username,
+			})
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, mention, nil
+			}
+			if err != nil {
+				return nil, mention, err
+			}
+			return &User{ID: p.UserID, FirstName: p.FirstName, Username: username}, mention, nil
+		}
+	}
+	if r := msg.ReplyToMessage; r != nil && r.From != nil && !r.From.IsBot {
+		return r.From, r.From.FirstName, nil
+	}
+	return nil, "", nil
 }
 
-func (h *Handler) todayWinnerID(ctx context.Context, chatID int64) int64 {
-	result, err := h.storage.Queries.GetTodayResult(ctx, db.GetTodayResultParams{
+// usernameArg returns the username of a "@username" argument. A bare "@"
+// names nobody.
+func usernameArg(arg string) (string, bool) {
+	username, ok := strings.CutPrefix(arg, "@")
+	return username, ok && username != ""
+}
+
+// todayWinnerIDs returns who won a game today, in rank order.
+func (h *Handler) todayWinnerIDs(ctx context.Context, chatID, gameID int64) []int64 {
+	ids, err := h.storage.Queries.GetResultWinners(ctx, db.GetResultWinnersParams{
 		ChatID:     chatID,
+		GameID:     gameID,
 		PlayedDate: h.todayFunc(),
 	})
 	if err != nil {
-		return 0
+		return nil
 	}
-	return result.UserID
+	return ids
 }
 
-func (h *Handler) handleStats(ctx context.Context, msg *Message, arg string) error {
+// handleStats shows the leaderboard of a game. Personal stats with
+// @username are about the main game.
+func (h *Handler) handleStats(ctx context.Context, msg *Message, g db.Game, arg string) error {
 	if arg == "" {
 		arg = h.todayFunc()[:4]
 	}
 	if arg == "all" {
-		return h.handleStatsAll(ctx, msg)
+		return h.handleStatsAll(ctx, msg, g)
 	}
-	return h.handleStatsByYear(ctx, msg, arg)
+	if _, ok := usernameArg(arg); ok {
+		return h.handleStatsUser(ctx, msg, arg)
+	}
+	return h.handleStatsPeriod(ctx, msg, g, arg)
 }
 
-func (h *Handler) handleStatsAll(ctx context.Context, msg *Message) error {
-	stats, err := h.storage.Queries.GetStats(ctx, msg.Chat.ID)
+func (h *Handler) handleStatsAll(ctx context.Context, msg *Message, g db.Game) error {
+	stats, err := h.storage.Queries.GetStats(ctx, db.GetStatsParams{
+		GameID: g.ID,
+		ChatID: msg.Chat.ID,
+	})
 	if err != nil {
 		return err
 	}
@@ -313,107 +784,129 @@ func (h *Handler) handleStatsAll(ctx context.Context, msg *Message) error {
 		return h.send(ctx, msg.Chat.ID, h.tr.Get(TrNoParticipants))
 	}
 
-	winnerID := h.todayWinnerID(ctx, msg.Chat.ID)
+	winnerIDs := h.todayWinnerIDs(ctx, msg.Chat.ID, g.ID)
 
 	var sb strings.Builder
-	sb.WriteString(h.tr.Get(TrStatsHeader))
+	sb.WriteString(titled(g, h.tr.Get(TrStatsHeader)))
 	sb.WriteString("\n\n")
 	for i, s := range stats {
-		name := s.FirstName
-		if s.UserID == winnerID {
-			name = "👑 " + s.FirstName
-		}
+		name := h.leaderboardName(s.FirstName, slices.Contains(winnerIDs, s.UserID), s.Active)
 		sb.WriteString(h.tr.Getf(TrStatsLine, i+1, name, s.Wins))
 		sb.WriteString("\n")
 	}
+	if err := h.writeLoserStats(ctx, &sb, msg.Chat.ID, g.ID, "0000-01-01", "9999-12-31"); err != nil {
+		return err
+	}
 
 	return h.send(ctx, msg.Chat.ID, sb.String())
 }
 
-func (h *Handler) handleStatsByYear(ctx context.Context, msg *Message, arg string) error {
-	year, err := strconv.Atoi(arg)
-	if err != nil || year < 2000 || year > 2100 {
-		return h.send(ctx, msg.Chat.ID, h.tr.Getf(TrStatsInvalidYear, arg))
+func (h *Handler) isAdmin(userID int64) bool {
+	_, ok := h.adminIDs[userID]
+	return ok
+}
+
+// canAdmin reports whether userID may run admin commands. Without
+// ADMIN_IDS everyone can.
+func (h *Handler) canAdmin(userID int64) bool {
+	return len(h.adminIDs) == 0 || h.isAdmin(userID)
+}
+
+func (h *Handler) handleReset(ctx context.Context, msg *Message) error {
+	if !h.canAdmin(msg.From.ID) {
+		return nil
 	}
 
-	from := fmt.Sprintf("%d-01-01", year)
-	to := fmt.Sprintf("%d-01-01", year+1)
+	chatID := msg.Chat.ID
+	date := h.todayFunc()
 
-	stats, err := h.storage.Queries.GetStatsByYear(ctx, db.GetStatsByYearParams{
-		ChatID:       msg.Chat.ID,
-		PlayedDate:   from,
-		PlayedDate_2: to,
-	})
+	command := extractArgs(msg)
+	g, ok, err := h.lookupGame(ctx, chatID, command)
 	if err != nil {
 		return err
 	}
-
-	if len(stats) == 0 {
-		return h.send(ctx, msg.Chat.ID, h.tr.Getf(TrStatsNoResults, year))
+	if !ok {
+		return h.send(ctx, chatID, h.tr.Getf(TrGameUnknown, command))
 	}
 
-	winnerID := h.todayWinnerID(ctx, msg.Chat.ID)
+	settings, err := h.chatSettings(ctx, chatID)
+	if err != nil {
+		return err
+	}
 
-	var sb strings.Builder
-	sb.WriteString(h.tr.Getf(TrStatsYearHeader, year))
-	sb.WriteString("\n\n")
-	for i, s := range stats {
-		name := s.FirstName
-		if s.UserID == winnerID {
-			name = "👑 " + s.FirstName
-		}
-		sb.WriteString(h.tr.Getf(TrStatsLine, i+1, name, s.Wins))
-		sb.WriteString("\n")
+	voided, err := h.storage.VoidResult(ctx, chatID, g.ID, date, msg.From.ID, settings.ResetLimit,
+		newAudit(chatID, msg.From.ID, AuditReset, auditDay(g, date, nil), nil))
+	if errors.Is(err, errResetLimit) {
+		return h.send(ctx, chatID, h.tr.Getf(TrResetLimit, settings.ResetLimit))
+	}
+	if err != nil {
+		return err
 	}
 
-	return h.send(ctx, msg.Chat.ID, sb.String())
-}
+	if !voided {
+		return h.send(ctx, chatID, titled(g, h.tr.Get(TrResetNoResult)))
+	}
 
-func (h *Handler) isAdmin(userID int64) bool {
-	_, ok := h.adminIDs[userID]
-	return ok
+	return h.send(ctx, chatID, titled(g, h.tr.Get(TrResetSuccess)))
 }
 
-func (h *Handler) handleReset(ctx context.Context, msg *Message) error {
-	if len(h.adminIDs) > 0 && !h.isAdmin(msg.From.ID) {
+// handleUndo restores the results of today's latest reset of a game.
+func (h *Handler) handleUndo(ctx context.Context, msg *Message) error {
+	if !h.canAdmin(msg.From.ID) {
 		return nil
 	}
 
 	chatID := msg.Chat.ID
-	date := h.todayFunc()
-
-	result, err := h.storage.Queries.DeleteTodayResult(ctx, db.DeleteTodayResultParams{
-		ChatID:     chatID,
-		PlayedDate: date,
-	})
+	command := extractArgs(msg)
+	g, ok, err := h.lookupGame(ctx, chatID, command)
 	if err != nil {
 		return err
 	}
+	if !ok {
+		return h.send(ctx, chatID, h.tr.Getf(TrGameUnknown, command))
+	}
 
-	rows, err := result.RowsAffected()
+	date := h.todayFunc()
+	restored, err := h.storage.RestoreResult(ctx, chatID, g.ID, date, msg.From.ID,
+		newAudit(chatID, msg.From.ID, AuditUndo, nil, auditDay(g, date, nil)))
+	if errors.Is(err, errRolledAgain) {
+		return h.send(ctx, chatID, titled(g, h.tr.Get(TrUndoRolledAgain)))
+	}
 	if err != nil {
 		return err
 	}
-
-	if rows == 0 {
-		return h.send(ctx, chatID, h.tr.Get(TrResetNoResult))
+	if len(restored) == 0 {
+		return h.send(ctx, chatID, titled(g, h.tr.Get(TrUndoNothing)))
 	}
 
-	return h.send(ctx, chatID, h.tr.Get(TrResetSuccess))
+	names := make([]string, len(restored))
+	for i, r := range restored {
+		names[i] = html.EscapeString(r.WinnerName.String)
+	}
+	return h.send(ctx, chatID, titled(g, h.tr.Getf(TrUndoSuccess, strings.Join(names, ", "))))
 }
 
 func (h *Handler) handleParticipants(ctx context.Context, msg *Message) error {
-	participants, err := h.storage.Queries.GetParticipants(ctx, msg.Chat.ID)
+	command := extractArgs(msg)
+	g, ok, err := h.lookupGame(ctx, msg.Chat.ID, command)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return h.send(ctx, msg.Chat.ID, h.tr.Getf(TrGameUnknown, command))
+	}
+
+	participants, err := h.gameParticipants(ctx, msg.Chat.ID, g)
 	if err != nil {
 		return err
 	}
 
 	if len(participants) == 0 {
-		return h.send(ctx, msg.Chat.ID, h.tr.Get(TrNoParticipants))
+		return h.send(ctx, msg.Chat.ID, titled(g, h.tr.Get(TrNoParticipants)))
 	}
 
 	var sb strings.Builder
-	sb.WriteString(h.tr.Get(TrParticipantsHeader))
+	sb.WriteString(titled(g, h.tr.Get(TrParticipantsHeader)))
 	sb.WriteString("\n\n")
 	for i, p := range participants {
 		fmt.Fprintf(&sb, "%d. %s\n", i+1, p.FirstName)
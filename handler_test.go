@@ -1,7 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -11,6 +16,9 @@ import (
 
 type fakeSender struct {
 	messages []SendMessageRequest
+	media    []any
+	edits    []EditMessageTextRequest
+	answers  []AnswerCallbackQueryRequest
 }
 
 func (f *fakeSender) SendMessage(_ context.Context, req SendMessageRequest) error {
@@ -18,11 +26,68 @@ func (f *fakeSender) SendMessage(_ context.Context, req SendMessageRequest) erro
 	return nil
 }
 
+func (f *fakeSender) SendSticker(_ context.Context, req SendStickerRequest) error {
+	f.media = append(f.media, req)
+	return nil
+}
+
+func (f *fakeSender) SendAnimation(_ context.Context, req SendAnimationRequest) error {
+	f.media = append(f.media, req)
+	return nil
+}
+
+func (f *fakeSender) SendPhoto(_ context.Context, req SendPhotoRequest) error {
+	f.media = append(f.media, req)
+	return nil
+}
+
+func (f *fakeSender) SendPhotoUpload(_ context.Context, req SendPhotoUploadRequest) error {
+	f.media = append(f.media, req)
+	return nil
+}
+
+func (f *fakeSender) SendDice(_ context.Context, req SendDiceRequest) error {
+	f.media = append(f.media, req)
+	return nil
+}
+
+func (f *fakeSender) EditMessageText(_ context.Context, req EditMessageTextRequest) error {
+	f.edits = append(f.edits, req)
+	return nil
+}
+
+func (f *fakeSender) AnswerCallbackQuery(_ context.Context, req AnswerCallbackQueryRequest) error {
+	f.answers = append(f.answers, req)
+	return nil
+}
+
 func (f *fakeSender) last() SendMessageRequest {
 	return f.messages[len(f.messages)-1]
 }
 
-func (f *fakeSender) reset() { f.messages = nil }
+// announcement returns the messages sent except badge announcements, which
+// follow a player's first wins.
+func (f *fakeSender) announcement() []SendMessageRequest {
+	var msgs []SendMessageRequest
+	for _, m := range f.messages {
+		if !strings.HasPrefix(m.Text, "🏅") {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+func (f *fakeSender) lastAnnouncement() SendMessageRequest {
+	msgs := f.announcement()
+	return msgs[len(msgs)-1]
+}
+
+func (f *fakeSender) reset() {
+	f.messages = nil
+	f.media = nil
+	f.edits = nil
+	f.answers = nil
+}
 
 type testEnv struct {
 	handler *Handler
@@ -43,21 +108,168 @@ func setup(t *testing.T) *testEnv {
 	t.Cleanup(func() { storage.Close() })
 
 	translations := map[string]string{
-		"join_success":        "Welcome to the roulette! You're in the game now.",
-		"leave_success":       "%s has left the roulette.",
-		"leave_not_in_game":   "You're not in the game yet.",
-		"no_participants":     "No players registered yet. Use /join to enter the roulette!",
-		"already_played":      "The wheel has already been spun today! Today's winner is %s!",
-		"fallback_winner":     "And the winner is... %s!",
-		"stats_header":        "<b>Hall of Fame:</b>",
-		"stats_year_header":   "<b>Hall of Fame (%d):</b>",
-		"stats_invalid_year":  "Invalid year: %s",
-		"stats_no_results":    "No results for %d.",
-		"stats_line":          "%d. %s — %d win(s)",
-		"participants_header": "<b>Players in the roulette:</b>",
-		"reset_no_result":     "Nothing to reset. The wheel hasn't been spun yet.",
-		"reset_success":       "The wheel has been reset. Spin again with /roll!",
-		"unknown_user":        "Player #%d",
+		"join_success":            "Welcome to the roulette! You're in the game now.",
+		"leave_success":           "%s has left the roulette.",
+		"leave_not_in_game":       "You're not in the game yet.",
+		"no_participants":         "No players registered yet. Use /join to enter the roulette!",
+		"already_played":          "The wheel has already been spun today! Today's winner is %s!",
+		"fallback_winner":         "And the winner is... %s!",
+		"stats_header":            "<b>Hall of Fame:</b>",
+		"stats_year_header":       "<b>Hall of Fame (%d):</b>",
+		"stats_no_results":        "No results for %d.",
+		"stats_line":              "%d. %s — %d win(s)",
+		"participants_header":     "<b>Players in the roulette:</b>",
+		"reset_no_result":         "Nothing to reset. The wheel hasn't been spun yet.",
+		"reset_success":           "The wheel has been reset. Spin again with /roll!",
+		"unknown_user":            "Player #%d",
+		"set_created":             "Created message set #%d. Add lines with /addline %d followed by the text.",
+		"set_line_added":          "Added line %d to set #%d.",
+		"set_addline_usage":       "Usage: /addline &lt;set id&gt; &lt;text&gt;",
+		"set_unknown_placeholder": "Unknown placeholder {%s}. Available: %s",
+		"set_addmedia_usage":      "Reply to a sticker, GIF or photo with /addmedia &lt;set id&gt; [caption]",
+		"set_invalid_dice":        "Unsupported dice emoji. Use one of: %s",
+		"set_invalid_id":          "Invalid set ID: %s",
+		"set_not_found":           "Message set #%d not found.",
+		"set_deleted":             "Deleted message set #%d.",
+		"set_empty":               "Message set #%d has no lines yet.",
+		"sets_header":             "<b>Message sets:</b>",
+		"sets_line":               "#%d — %d line(s)",
+		"sets_global_line":        "#%d — %d line(s) (global)",
+		"sets_none":               "No message sets yet. Create one with /newset.",
+		"sets_global_off":         "<i>Global sets are disabled in this chat.</i>",
+		"global_sets_usage":       "Usage: /globalsets on|off",
+		"global_sets_enabled":     "Global message sets are now enabled in this chat.",
+		"global_sets_disabled":    "Global message sets are now disabled in this chat.",
+		"set_rules_usage":         "Usage: /setrules &lt;set id&gt; [weight=N] [dates=MM-DD..MM-DD|any] [days=sat,sun|any]",
+		"set_rules_updated":       "Set #%d rules: %s",
+		"set_rules_default":       "default",
+		"settings_header":         "<b>Settings:</b>",
+		"settings_line":           "%s: <code>%s</code>",
+		"setting_unknown":         "Unknown setting: %s",
+		"setting_invalid":         "Invalid value for %s.",
+		"setting_updated":         "%s is now <code>%s</code>.",
+		"verify_usage":            "Usage: /verify [game] [YYYY-MM-DD]",
+		"verify_no_result":        "No verifiable roll for %s.",
+		"verify_result":           "🔍 Roll of %s\nCommitted hash: <code>%s</code>\nRevealed seed: <code>%s</code>\nDraw order (user IDs): %s\nStrategy: <code>%s</code>",
+		"verify_ok":               "✅ The seed matches its commitment and picks %s, as announced.",
+		"verify_hash_mismatch":    "❌ The revealed seed does not match the committed hash.",
+		"verify_malformed":        "❌ The stored proof for this roll is malformed.",
+		"verify_winner_mismatch":  "❌ The seed picks %s, but the recorded winner is %s.",
+		"verify_next":             "🔒 Next roll is committed to <code>%s</code>.",
+		"stats_personal":          "📊 Stats for %s\n\n🏆 Wins: %d (this year: %d, this month: %d)\n🎯 Win rate: %.1f%% over %d day(s) in the game\n🔥 Streak: %d current, %d longest\n📅 Last win: %s\n🥇 Rank: #%d",
+		"stats_never":             "never",
+		"stats_unknown_player":    "No player @%s in this chat.",
+		"stats_invalid_period":    "Invalid period: %s. Use a year, month, week, YYYY-MM or YYYY-MM-DD..YYYY-MM-DD.",
+		"stats_month_header":      "<b>Hall of Fame (%s):</b>",
+		"stats_week_header":       "<b>Hall of Fame, week of %s:</b>",
+		"stats_range_header":      "<b>Hall of Fame (%s – %s):</b>",
+		"stats_no_results_period": "No results for %s.",
+		"stats_former_player":     "%s (left)",
+		"history_header":          "<b>Roll history:</b>",
+		"history_period_header":   "<b>Roll history (%s):</b>",
+		"history_line":            "%s — %s",
+		"history_page":            "Page %d of %d",
+		"history_newer":           "« Newer",
+		"history_older":           "Older »",
+		"history_empty":           "No rolls yet.",
+		"history_usage":           "Usage: /history [year|month|YYYY-MM]",
+		"chart_caption":           "📊 Wins per player: %s",
+		"chart_all_time":          "all time",
+		"chart_calendar_caption":  "📅 Wins of %s over the last year",
+		"chart_no_data":           "No draws to chart yet.",
+		"chart_usage":             "Usage: /chart [month|week|YYYY|YYYY-MM|YYYY-MM-DD..YYYY-MM-DD|me|@username]",
+		"achievement_first_win":   "🥇 First win",
+		"achievement_streak_3":    "🔥 Three wins in a row",
+		"achievement_wins_10":     "🔟 Ten wins",
+		"achievement_drought_100": "🌵 Won after 100 days without a win",
+		"achievement_anniversary": "🎂 Won on their join anniversary",
+		"achievement_awarded":     "🏅 <b>%s</b> earned a badge: %s",
+		"achievements_header":     "<b>Achievements:</b>",
+		"achievements_line":       "%s — %s",
+		"achievements_empty":      "No achievements yet.",
+		"game_unknown":            "Unknown game %s. See /games.",
+		"games_empty":             "No extra games yet. Admins can add one with /addgame.",
+		"games_header":            "<b>Games:</b>",
+		"games_shared":            "everyone who joined with /join",
+		"games_own":               "%d player(s) of its own",
+		"games_line":              "/%s — %s (%s)",
+		"addgame_usage":           "Usage: /addgame &lt;command&gt; shared|own &lt;title&gt;",
+		"addgame_invalid_command": "/%s can't be used for a game. Use lowercase letters, digits and _, not an existing command.",
+		"addgame_exists":          "There already is a game /%s.",
+		"addgame_created":         "Created <b>%s</b>. Roll it with /%s and see its stats with /%sstats.",
+		"delgame_usage":           "Usage: /delgame &lt;command&gt;",
+		"delgame_deleted":         "Deleted <b>%s</b> with its results and message sets.",
+		"game_shared_list":        "<b>%s</b> draws from everyone who joined with /join.",
+		"game_joined":             "%s joined <b>%s</b>.",
+		"game_already_joined":     "You're already playing <b>%s</b>.",
+		"game_left":               "%s left <b>%s</b>.",
+		"game_not_joined":         "You're not playing <b>%s</b>.",
+		"fallback_loser":          "And today's loser is... {loser_mention}!",
+		"already_played_loser":    "Today's loser is %s.",
+		"stats_losers_header":     "<b>Losers:</b>",
+		"stats_loser_line":        "%d. %s — %d loss(es)",
+		"verify_loser_ok":         "✅ It then picks %s as the loser, as announced.",
+		"verify_loser_mismatch":   "❌ The seed picks %s as the loser, but the recorded loser is %s.",
+		"verify_no_loser":         "nobody",
+		"fallback_winners":        "And today's winners are...\n{winners}",
+		"already_played_winners":  "The wheel has already been spun today! Today's winners are:\n%s",
+		"winners_usage":           "Usage: /winners [game] [1-10]",
+		"winners_show":            "%s picks %d winner(s) a day.",
+		"winners_updated":         "%s now picks %d winner(s) a day.",
+		"main_game":               "The main game",
+		"balance":                 "💰 %s has %d point(s).",
+		"richest_header":          "<b>Richest players:</b>",
+		"richest_line":            "%d. %s — %d point(s)",
+		"richest_empty":           "Nobody has any points yet.",
+		"bet_usage":               "Usage: /bet @username amount",
+		"bet_exists":              "You already placed a bet today.",
+		"bet_insufficient":        "You only have %d point(s).",
+		"bets_closed":             "Bets are closed, today's roll already happened.",
+		"bet_placed":              "🎟 %s bet %d point(s) on %s, paying %d if they win today.",
+		"bets_header":             "<b>Bets:</b>",
+		"bet_won":                 "✅ %s won %d point(s) on %s",
+		"bet_lost":                "❌ %s lost %d point(s) on %s",
+		"bet_refunded":            "↩️ %s got %d point(s) back for %s",
+		"duel_usage":              "Usage: /duel @username",
+		"duel_self":               "You can't duel yourself.",
+		"duel_not_playing":        "Both players must be in the roulette to duel.",
+		"duel_challenge":          "⚔️ %s challenges %s to a duel! Accept within %d minutes.",
+		"duel_accept":             "Accept",
+		"duel_decline":            "Decline",
+		"duel_not_yours":          "Only the challenged player can answer this duel.",
+		"duel_closed":             "This duel is already over.",
+		"duel_expired":            "⌛ %s didn't answer the duel with %s in time.",
+		"duel_declined":           "🏳️ %s declined the duel with %s.",
+		"duel_result":             "🎲 %s rolled %d, %s rolled %d. %s wins the duel!",
+		"duels_header":            "<b>Duel champions:</b>",
+		"duels_line":              "%d. %s — %d win(s), %d loss(es)",
+		"duels_empty":             "No duels fought yet. Challenge someone with /duel @username!",
+		"kick_usage":              "Usage: /kick @username, or reply to the player's message with /kick",
+		"kick_success":            "%s was removed from the roulette.",
+		"kick_not_playing":        "%s isn't in the roulette.",
+		"add_usage":               "Reply to someone's message with /add to enrol them in the roulette.",
+		"add_success":             "%s is in the roulette now.",
+		"add_already":             "%s is already in the roulette.",
+		"setwinner_usage":         "Usage: /setwinner @username, or reply to the player's message with /setwinner",
+		"setwinner_no_result":     "The wheel hasn't been spun today, so there is no result to correct.",
+		"setwinner_already":       "%s already won today.",
+		"setwinner_success":       "Today's result was corrected: the winner is %s instead of %s.",
+		"reset_limit":             "This game's wheel can only be reset %d time(s) a day.",
+		"undo_nothing":            "There is no reset to undo today.",
+		"undo_rolled_again":       "The wheel was spun again after the reset. Reset that roll before undoing.",
+		"undo_success":            "The reset was undone. Today's winner is %s again.",
+		"audit_usage":             "Usage: /audit [1-%d]",
+		"audit_empty":             "Nothing has been recorded in this chat yet.",
+		"audit_header":            "<b>Audit log:</b>",
+		"audit_line":              "%s — %s: %s %s",
+		"setwinner_loser":         "%s lost today's draw and can't also win it.",
+		"verify_overridden":       "⚠️ An admin replaced the drawn winner %s with %s.",
+		"balance_usage":           "Usage: /balance [@username]",
+		"chart_title":             "Wins: %s",
+		"chart_calendar_title":    "Wins of %s",
+		"duel_pending":            "%s and %s already have an open duel. Answer it first.",
+		"audit_cli":               "CLI",
+		"bets_uniform_only":       "Bets are only taken while the strategy is <code>uniform</code>, whose odds they pay.",
 	}
 	for k, v := range translations {
 		if _, err := storage.db.ExecContext(ctx,
@@ -74,6 +286,8 @@ func setup(t *testing.T) *testEnv {
 	sender := &fakeSender{}
 	handler := NewHandler(sender, storage, tr, "testbot", "roll", nil, nil, time.UTC)
 	handler.todayFunc = func() string { return testDate }
+	handler.stepDelay = 0
+	handler.rng = rand.New(rand.NewPCG(1, 2))
 
 	return &testEnv{handler: handler, sender: sender, storage: storage}
 }
@@ -190,21 +404,231 @@ func TestRoulette(t *testing.T) {
 
 	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
 
-	if len(env.sender.messages) != 1 {
-		t.Fatalf("expected 1 message, got %d", len(env.sender.messages))
+	if len(env.sender.messages) != 2 {
+		t.Fatalf("expected winner and badge messages, got %d", len(env.sender.messages))
 	}
-	if got := env.sender.last().Text; !strings.Contains(got, "winner") || !strings.Contains(got, "Alice") {
+	if got := env.sender.messages[0].Text; !strings.Contains(got, "winner") || !strings.Contains(got, "Alice") {
 		t.Errorf("expected fallback winner message with Alice, got: %s", got)
 	}
+	if got := env.sender.last().Text; got != "🏅 <b>Alice</b> earned a badge: 🥇 First win" {
+		t.Errorf("expected first win badge, got: %s", got)
+	}
+
+	rows, err := env.storage.Queries.GetTodayResults(ctx, db.GetTodayResultsParams{
+		ChatID: 100, PlayedDate: testDate,
+	})
+	if err != nil {
+		t.Fatalf("GetTodayResults: %v", err)
+	}
+	if len(rows) != 1 || rows[0].UserID != 1 {
+		t.Errorf("expected winner user_id=1, got %+v", rows)
+	}
+}
+
+func TestRouletteDeckStrategy(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 3, "Carol", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/set strategy deck"))
+	if got := env.sender.last().Text; got != "strategy is now <code>deck</code>." {
+		t.Fatalf("unexpected reply: %s", got)
+	}
+
+	for day := 1; day <= 6; day++ {
+		env.handler.todayFunc = func() string { return fmt.Sprintf("2026-02-%02d", day) }
+		env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	}
+
+	history, err := env.storage.Queries.GetWinHistory(ctx, db.GetWinHistoryParams{ChatID: 100})
+	if err != nil {
+		t.Fatalf("GetWinHistory: %v", err)
+	}
+	for _, round := range [][]db.GetWinHistoryRow{history[:3], history[3:]} {
+		seen := map[int64]bool{}
+		for _, r := range round {
+			if seen[r.UserID] {
+				t.Fatalf("user %d won twice in one round: %+v", r.UserID, history)
+			}
+			seen[r.UserID] = true
+		}
+	}
+}
+
+func TestSetStrategyInvalid(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/set strategy rigged"))
+	if got := env.sender.last().Text; got != "Invalid value for strategy." {
+		t.Errorf("unexpected reply: %s", got)
+	}
+}
+
+func TestVerifyRoll(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 3, "Carol", "/join"))
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/verify"))
+	got := env.sender.last().Text
+	if !strings.HasPrefix(got, "No verifiable roll for "+testDate) {
+		t.Fatalf("unexpected reply before the roll: %s", got)
+	}
+	_, commitment, ok := strings.Cut(got, "committed to <code>")
+	if !ok {
+		t.Fatalf("expected a commitment, got: %s", got)
+	}
+	commitment, _, _ = strings.Cut(commitment, "</code>")
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/verify "+testDate))
+	got = env.sender.last().Text
+	if !strings.Contains(got, "Committed hash: <code>"+commitment+"</code>") {
+		t.Errorf("expected the roll to use the earlier commitment %s, got: %s", commitment, got)
+	}
+	if !strings.Contains(got, "Draw order (user IDs): 1, 2, 3") || !strings.Contains(got, "✅") {
+		t.Errorf("expected a successful verification, got: %s", got)
+	}
+	if strings.Contains(got, "committed to <code>"+commitment+"</code>") {
+		t.Errorf("expected a fresh commitment after the roll, got: %s", got)
+	}
+
+	if _, err := env.storage.db.ExecContext(ctx,
+		"UPDATE results SET user_id = CASE user_id WHEN 1 THEN 2 ELSE 1 END"); err != nil {
+		t.Fatalf("tamper result: %v", err)
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/verify"))
+	if got := env.sender.last().Text; !strings.Contains(got, "❌ The seed picks") {
+		t.Errorf("expected a winner mismatch, got: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/verify yesterday"))
+	if got := env.sender.last().Text; got != "Usage: /verify [game] [YYYY-MM-DD]" {
+		t.Errorf("unexpected reply: %s", got)
+	}
+}
+
+// TestVerifyAfterSetWinner checks that a history-based strategy keeps
+// replaying the drawn winners once an earlier day's winner was replaced.
+func TestVerifyAfterSetWinner(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/set strategy deck"))
+
+	env.handler.todayFunc = func() string { return "2026-02-01" }
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	drawn := env.handler.todayWinnerIDs(ctx, 100, mainGameID)
+	if len(drawn) != 1 {
+		t.Fatalf("expected one winner, got %v", drawn)
+	}
+	other := &User{ID: 3 - drawn[0], FirstName: "Other"}
+	if _, ok, err := env.storage.SetWinner(ctx, 100, mainGameID, "2026-02-01", other,
+		newAudit(100, 1, AuditSetWinner, auditState{"date": "2026-02-01"}, auditState{"user_id": other.ID})); err != nil || !ok {
+		t.Fatalf("SetWinner: %v, %v", ok, err)
+	}
+
+	// The deck still holds whoever wasn't drawn, even though they were
+	// made the winner.
+	env.handler.todayFunc = func() string { return "2026-02-02" }
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	if winners := env.handler.todayWinnerIDs(ctx, 100, mainGameID); !slices.Equal(winners, []int64{other.ID}) {
+		t.Errorf("expected %d to be drawn from the deck, got %v", other.ID, winners)
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/verify 2026-02-02"))
+	if got := env.sender.last().Text; !strings.Contains(got, "as announced.") {
+		t.Errorf("expected the later roll to verify, got: %s", got)
+	}
+}
+
+func TestRouletteSnapshotsParticipants(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+
+	snapshot, err := env.storage.Queries.GetResultParticipants(ctx, db.GetResultParticipantsParams{
+		ChatID: 100, PlayedDate: testDate,
+	})
+	if err != nil {
+		t.Fatalf("GetResultParticipants: %v", err)
+	}
+	if len(snapshot) != 2 || snapshot[0].FirstName != "Alice" || snapshot[1].FirstName != "Bob" {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
 
-	row, err := env.storage.Queries.GetTodayResult(ctx, db.GetTodayResultParams{
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/reset"))
+	snapshot, err = env.storage.Queries.GetResultParticipants(ctx, db.GetResultParticipantsParams{
 		ChatID: 100, PlayedDate: testDate,
 	})
+	if err != nil || len(snapshot) != 0 {
+		t.Errorf("expected the snapshot to be deleted with the result, got %+v, %v", snapshot, err)
+	}
+}
+
+func TestLeaveAndRejoinKeepsMembership(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
+	if _, err := env.storage.db.ExecContext(ctx,
+		"UPDATE participants SET joined_at = CASE user_id WHEN 1 THEN '2025-06-01 10:00:00' ELSE '2025-07-01 10:00:00' END"); err != nil {
+		t.Fatalf("set joined_at: %v", err)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/leave"))
+	ps, err := env.storage.Queries.GetParticipants(ctx, 100)
+	if err != nil {
+		t.Fatalf("GetParticipants: %v", err)
+	}
+	if len(ps) != 1 || ps[0].UserID != 2 {
+		t.Fatalf("expected only Bob to be active, got %+v", ps)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/leave"))
+	if got := env.sender.last().Text; got != "You're not in the game yet." {
+		t.Errorf("unexpected reply to a second /leave: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	ps, err = env.storage.Queries.GetParticipants(ctx, 100)
+	if err != nil {
+		t.Fatalf("GetParticipants: %v", err)
+	}
+	if len(ps) != 2 || ps[0].UserID != 1 {
+		t.Fatalf("expected Alice to keep her place, got %+v", ps)
+	}
+
+	m, err := env.storage.Queries.GetMembership(ctx, db.GetMembershipParams{ChatID: 100, UserID: 1})
+	if err != nil {
+		t.Fatalf("GetMembership: %v", err)
+	}
+	if m.JoinedAt.Format("2006-01-02") != "2025-06-01" || m.LeftAt.Valid || !m.RejoinedAt.Valid {
+		t.Errorf("unexpected membership after rejoin: %+v", m)
+	}
+
+	events, err := env.storage.Queries.GetMembershipTimeline(ctx, 100)
 	if err != nil {
-		t.Fatalf("GetTodayResult: %v", err)
+		t.Fatalf("GetMembershipTimeline: %v", err)
 	}
-	if row.UserID != 1 {
-		t.Errorf("expected winner user_id=1, got %d", row.UserID)
+	var got []string
+	for _, e := range events {
+		got = append(got, fmt.Sprintf("%s:%s", e.FirstName.String, e.Event))
+	}
+	want := "Alice:join Bob:join Alice:leave Alice:rejoin"
+	if strings.Join(got, " ") != want {
+		t.Errorf("timeline = %v, want %s", got, want)
 	}
 }
 
@@ -264,278 +688,431 @@ func TestRouletteWithMessageSet(t *testing.T) {
 
 	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
 
-	if len(env.sender.messages) != 2 {
-		t.Fatalf("expected 2 messages (announcement sequence), got %d", len(env.sender.messages))
+	if len(env.sender.announcement()) != 2 {
+		t.Fatalf("expected 2 messages (announcement sequence), got %d", len(env.sender.announcement()))
 	}
-	if got := env.sender.messages[0].Text; got != "Spinning..." {
+	if got := env.sender.announcement()[0].Text; got != "Spinning..." {
 		t.Errorf("first message: %s", got)
 	}
-	if got := env.sender.messages[1].Text; !strings.Contains(got, "Alice") {
+	if got := env.sender.announcement()[1].Text; !strings.Contains(got, "Alice") {
 		t.Errorf("last message should contain winner name, got: %s", got)
 	}
 }
 
-func TestParticipants(t *testing.T) {
+func TestMessageSetManagedFromChat(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
-	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
-	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/newset"))
+	if got := env.sender.last().Text; !strings.Contains(got, "Created message set #1") {
+		t.Fatalf("expected set created, got: %s", got)
+	}
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/participants"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/addline 1 Spinning..."))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/addline 1 Winner is %s!"))
+	if got := env.sender.last().Text; got != "Added line 2 to set #1." {
+		t.Errorf("unexpected addline reply: %s", got)
+	}
 
-	if len(env.sender.messages) != 1 {
-		t.Fatalf("expected 1 message, got %d", len(env.sender.messages))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/sets"))
+	if got := env.sender.last().Text; !strings.Contains(got, "#1 — 2 line(s)") {
+		t.Errorf("expected set listed, got: %s", got)
 	}
-	got := env.sender.last().Text
-	if !strings.Contains(got, "Alice") || !strings.Contains(got, "Bob") {
-		t.Errorf("expected both participants listed, got: %s", got)
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+
+	if len(env.sender.announcement()) != 2 {
+		t.Fatalf("expected 2 messages from chat set, got %d", len(env.sender.announcement()))
 	}
-	if !strings.Contains(got, "1. Alice") || !strings.Contains(got, "2. Bob") {
-		t.Errorf("expected numbered list, got: %s", got)
+	if got := env.sender.announcement()[1].Text; !strings.Contains(got, "Winner is") || !strings.Contains(got, "Alice") {
+		t.Errorf("unexpected announcement: %s", got)
 	}
 }
 
-func TestParticipantsEmpty(t *testing.T) {
+func TestMessageSetPlaceholders(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/participants"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	for _, date := range []string{"2026-01-13", "2026-01-14"} {
+		if _, err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
+			ChatID: 100, UserID: 1, PlayedDate: date,
+		}); err != nil {
+			t.Fatalf("SaveResult: %v", err)
+		}
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/newset"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/addline 1 {count} player(s), 100% luck on {date}"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/addline 1 {winner} wins ({wins} total, {streak} in a row)"))
+	env.sender.reset()
 
-	if got := env.sender.last().Text; !strings.Contains(got, "No players") {
-		t.Errorf("expected no-participants message, got: %s", got)
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+
+	if len(env.sender.announcement()) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(env.sender.announcement()))
+	}
+	if got := env.sender.announcement()[0].Text; got != "1 player(s), 100% luck on "+testDate {
+		t.Errorf("first line: %s", got)
+	}
+	if got := env.sender.announcement()[1].Text; got != "Alice wins (3 total, 3 in a row)" {
+		t.Errorf("second line: %s", got)
 	}
 }
 
-func TestStats(t *testing.T) {
+func TestMessageSetWithoutWinnerLine(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
 	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
-	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/newset"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/addline 1 Spinning..."))
+	env.sender.reset()
 
-	err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
-		ChatID: 100, UserID: 1, PlayedDate: "2026-06-01",
-	})
-	if err != nil {
-		t.Fatalf("SaveResult: %v", err)
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+
+	if len(env.sender.announcement()) != 2 {
+		t.Fatalf("expected set line plus fallback, got %d messages", len(env.sender.announcement()))
 	}
+	if got := env.sender.lastAnnouncement().Text; !strings.HasPrefix(got, "And the winner is") || !strings.Contains(got, "tg://user?id=1") {
+		t.Errorf("expected fallback announcement, got: %s", got)
+	}
+}
 
-	env.sender.reset()
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats"))
+func TestAddLineRejectsUnknownPlaceholder(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
 
-	if len(env.sender.messages) != 1 {
-		t.Fatalf("expected 1 message, got %d", len(env.sender.messages))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/newset"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/addline 1 Hello {champion}"))
+
+	if got := env.sender.last().Text; !strings.Contains(got, "Unknown placeholder {champion}") {
+		t.Errorf("expected placeholder error, got: %s", got)
 	}
-	got := env.sender.last().Text
-	if !strings.Contains(got, "2026") {
-		t.Errorf("expected year in header, got: %s", got)
+	messages, err := env.storage.Queries.GetSetMessages(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetSetMessages: %v", err)
 	}
-	if !strings.Contains(got, "Alice") || !strings.Contains(got, "1 win(s)") {
-		t.Errorf("expected Alice with 1 win, got: %s", got)
+	if len(messages) != 0 {
+		t.Errorf("expected invalid line not to be stored, got %v", messages)
 	}
 }
 
-func TestStatsAll(t *testing.T) {
+func TestMessageSetMediaSteps(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
-	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/newset"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/adddice 1"))
 
-	err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
-		ChatID: 100, UserID: 1, PlayedDate: "2025-06-01",
-	})
-	if err != nil {
-		t.Fatalf("SaveResult: %v", err)
+	addSticker := commandMsg(100, 1, "Alice", "/addmedia 1 ignored")
+	addSticker.Message.ReplyToMessage = &Message{Sticker: &Sticker{FileID: "sticker-id"}}
+	env.handler.HandleUpdate(ctx, addSticker)
+
+	addGIF := commandMsg(100, 1, "Alice", "/addmedia 1 And it's {mention}!")
+	addGIF.Message.ReplyToMessage = &Message{Animation: &Animation{FileID: "gif-id"}}
+	env.handler.HandleUpdate(ctx, addGIF)
+	if got := env.sender.last().Text; got != "Added line 3 to set #1." {
+		t.Fatalf("unexpected reply: %s", got)
 	}
 
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
 	env.sender.reset()
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats all"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
 
-	if len(env.sender.messages) != 1 {
-		t.Fatalf("expected 1 message, got %d", len(env.sender.messages))
+	if len(env.sender.announcement()) != 0 {
+		t.Errorf("expected no text messages, got %d", len(env.sender.announcement()))
 	}
-	got := env.sender.last().Text
-	if !strings.Contains(got, "Hall of Fame") {
-		t.Errorf("expected stats header, got: %s", got)
+	if len(env.sender.media) != 3 {
+		t.Fatalf("expected 3 media steps, got %d", len(env.sender.media))
 	}
-	if !strings.Contains(got, "Alice") || !strings.Contains(got, "1 win(s)") {
-		t.Errorf("expected Alice with 1 win, got: %s", got)
+	if got, ok := env.sender.media[0].(SendDiceRequest); !ok || got.Emoji != "🎲" {
+		t.Errorf("expected default dice first, got %+v", env.sender.media[0])
 	}
-	if !strings.Contains(got, "Bob") || !strings.Contains(got, "0 win(s)") {
-		t.Errorf("expected Bob with 0 wins, got: %s", got)
+	if got, ok := env.sender.media[1].(SendStickerRequest); !ok || got.Sticker != "sticker-id" {
+		t.Errorf("expected sticker second, got %+v", env.sender.media[1])
+	}
+	got, ok := env.sender.media[2].(SendAnimationRequest)
+	if !ok || got.Animation != "gif-id" || !strings.Contains(got.Caption, "tg://user?id=1") {
+		t.Errorf("expected GIF with rendered caption, got %+v", env.sender.media[2])
 	}
 }
 
-func TestStatsWithTodayWinnerCrown(t *testing.T) {
+func TestMessageSetMediaInvalid(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
-	err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
-		ChatID: 100, UserID: 1, PlayedDate: testDate,
-	})
-	if err != nil {
-		t.Fatalf("SaveResult: %v", err)
-	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/newset"))
 
-	env.sender.reset()
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/addmedia 1"))
+	if got := env.sender.last().Text; !strings.Contains(got, "Reply to a sticker") {
+		t.Errorf("expected addmedia usage, got: %s", got)
+	}
 
-	got := env.sender.last().Text
-	if !strings.Contains(got, "👑") {
-		t.Errorf("expected crown emoji for today's winner, got: %s", got)
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/adddice 1 🍕"))
+	if got := env.sender.last().Text; !strings.Contains(got, "Unsupported dice emoji") {
+		t.Errorf("expected dice error, got: %s", got)
 	}
 }
 
-func TestStatsByYear(t *testing.T) {
-	env := setup(t)
+func addChatSet(t *testing.T, env *testEnv, chatID int64, lines ...string) int64 {
+	t.Helper()
 	ctx := context.Background()
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
-	err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
-		ChatID: 100, UserID: 1, PlayedDate: "2025-06-01",
-	})
+	setID, err := env.storage.Queries.CreateMessageSet(ctx, db.CreateMessageSetParams{ChatID: sql.NullInt64{Int64: chatID, Valid: true}})
 	if err != nil {
-		t.Fatalf("SaveResult: %v", err)
-	}
-
-	env.sender.reset()
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats 2025"))
-
-	got := env.sender.last().Text
-	if !strings.Contains(got, "2025") {
-		t.Errorf("expected year in header, got: %s", got)
+		t.Fatalf("CreateMessageSet: %v", err)
 	}
-	if !strings.Contains(got, "Alice") {
-		t.Errorf("expected Alice in stats, got: %s", got)
+	for i, body := range lines {
+		if err := env.storage.Queries.AddSetMessage(ctx, db.AddSetMessageParams{
+			SetID: setID, Position: int64(i + 1), Kind: StepText, Body: body,
+		}); err != nil {
+			t.Fatalf("AddSetMessage: %v", err)
+		}
 	}
+	return setID
 }
 
-func TestStatsByYearNoResults(t *testing.T) {
+func TestMessageSetRules(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
-	env.sender.reset()
+	addChatSet(t, env, 100, "Regular {mention}")
+	addChatSet(t, env, 100, "Ho ho ho {mention}")
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats 2020"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/setrules 2 dates=12-20..01-06 weight=10"))
+	if got := env.sender.last().Text; got != "Set #2 rules: weight=10 dates=12-20..01-06" {
+		t.Errorf("unexpected reply: %s", got)
+	}
 
-	got := env.sender.last().Text
-	if !strings.Contains(got, "No results for 2020") {
-		t.Errorf("expected no-results message, got: %s", got)
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/setrules 2 days=xyz"))
+	if got := env.sender.last().Text; !strings.HasPrefix(got, "Usage: /setrules") {
+		t.Errorf("expected usage, got: %s", got)
 	}
-}
 
-func TestStatsInvalidYear(t *testing.T) {
-	env := setup(t)
-	ctx := context.Background()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/sets"))
+	if got := env.sender.last().Text; !strings.Contains(got, "#2 — 1 line(s) · weight=10 dates=12-20..01-06") {
+		t.Errorf("expected rules in set list, got: %s", got)
+	}
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats abc"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	if got := env.sender.lastAnnouncement().Text; !strings.HasPrefix(got, "Regular") {
+		t.Errorf("expected out-of-season set to be skipped, got: %s", got)
+	}
 
-	got := env.sender.last().Text
-	if !strings.Contains(got, "Invalid year") {
-		t.Errorf("expected invalid-year message, got: %s", got)
+	env.handler.todayFunc = func() string { return "2026-12-24" }
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	if got := env.sender.lastAnnouncement().Text; !strings.HasPrefix(got, "Ho ho ho") {
+		t.Errorf("expected holiday set to be picked, got: %s", got)
 	}
 }
 
-func TestStatsViaRollCommand(t *testing.T) {
+func TestMessageSetNotRepeated(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
+	addChatSet(t, env, 100, "First {mention}")
+	addChatSet(t, env, 100, "Second {mention}")
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/set setrepeat 1"))
+	if got := env.sender.last().Text; got != "setrepeat is now <code>1</code>." {
+		t.Errorf("unexpected reply: %s", got)
+	}
 	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
-	env.sender.reset()
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll stats"))
+	var previous string
+	for day := 1; day <= 6; day++ {
+		env.handler.todayFunc = func() string { return fmt.Sprintf("2026-02-%02d", day) }
+		env.sender.reset()
+		env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
 
-	got := env.sender.last().Text
-	if !strings.Contains(got, "2026") {
-		t.Errorf("expected year-filtered stats via /roll stats, got: %s", got)
+		got, _, _ := strings.Cut(env.sender.last().Text, " ")
+		if got == previous {
+			t.Fatalf("set %q repeated on day %d", got, day)
+		}
+		previous = got
+	}
+
+	row, err := env.storage.Queries.GetRecentSetIDs(ctx, db.GetRecentSetIDsParams{ChatID: 100, Limit: 1})
+	if err != nil || len(row) != 1 || !row[0].Valid {
+		t.Errorf("expected set recorded on result, got %v (err %v)", row, err)
 	}
 }
 
-func TestStatsViaRollCommandWithYear(t *testing.T) {
+func TestSettingsCommands(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
-	err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
-		ChatID: 100, UserID: 1, PlayedDate: "2025-03-01",
-	})
-	if err != nil {
-		t.Fatalf("SaveResult: %v", err)
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/settings"))
+	got := env.sender.last().Text
+	if !strings.Contains(got, "globalsets: <code>on</code>") || !strings.Contains(got, "setrepeat: <code>3</code>") {
+		t.Errorf("expected default settings, got: %s", got)
 	}
 
-	env.sender.reset()
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll stats 2025"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/set setrepeat 99"))
+	if got := env.sender.last().Text; got != "Invalid value for setrepeat." {
+		t.Errorf("unexpected reply: %s", got)
+	}
 
-	got := env.sender.last().Text
-	if !strings.Contains(got, "2025") || !strings.Contains(got, "Alice") {
-		t.Errorf("expected yearly stats via /roll stats 2025, got: %s", got)
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/set colour blue"))
+	if got := env.sender.last().Text; got != "Unknown setting: colour" {
+		t.Errorf("unexpected reply: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/set globalsets off"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/settings"))
+	if got := env.sender.last().Text; !strings.Contains(got, "globalsets: <code>off</code>") {
+		t.Errorf("expected updated setting, got: %s", got)
 	}
 }
 
-func TestStatsViaRollCommandNoSpace(t *testing.T) {
+func TestMessageSetOtherChatNotVisible(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
+	env.handler.HandleUpdate(ctx, commandMsg(200, 1, "Alice", "/newset"))
+	env.handler.HandleUpdate(ctx, commandMsg(200, 1, "Alice", "/addline 1 Winner is %s!"))
+	env.sender.reset()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/addline 1 Hijacked %s"))
+	if got := env.sender.last().Text; got != "Message set #1 not found." {
+		t.Errorf("expected not-found reply, got: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/delset 1"))
+	if got := env.sender.last().Text; got != "Message set #1 not found." {
+		t.Errorf("expected not-found reply, got: %s", got)
+	}
+
 	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
 	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	if got := env.sender.lastAnnouncement().Text; !strings.HasPrefix(got, "And the winner is") {
+		t.Errorf("expected fallback winner message, got: %s", got)
+	}
+}
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/rollstats"))
+func TestMessageSetDelete(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
 
-	got := env.sender.last().Text
-	if !strings.Contains(got, "2026") {
-		t.Errorf("expected year-filtered stats via /rollstats, got: %s", got)
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/newset"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/addline 1 Winner is %s!"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/delset 1"))
+
+	if got := env.sender.last().Text; got != "Deleted message set #1." {
+		t.Errorf("unexpected reply: %s", got)
+	}
+	if _, err := env.storage.Queries.GetMessageSet(ctx, 1); err == nil {
+		t.Error("expected set to be deleted")
+	}
+	messages, err := env.storage.Queries.GetSetMessages(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetSetMessages: %v", err)
+	}
+	if len(messages) != 0 {
+		t.Errorf("expected set lines to be deleted, got %v", messages)
 	}
 }
 
-func TestStatsViaRollCommandNoSpaceWithYear(t *testing.T) {
+func TestGlobalSetsToggle(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
+	if _, err := env.storage.db.ExecContext(ctx, "INSERT INTO message_sets (id) VALUES (1)"); err != nil {
+		t.Fatalf("insert message_sets: %v", err)
+	}
+	if _, err := env.storage.db.ExecContext(ctx,
+		"INSERT INTO set_messages (set_id, position, body) VALUES (1, 1, 'Global pick: %s')"); err != nil {
+		t.Fatalf("insert set_messages: %v", err)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/sets"))
+	if got := env.sender.last().Text; !strings.Contains(got, "(global)") {
+		t.Errorf("expected global set listed, got: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/globalsets off"))
+	if got := env.sender.last().Text; !strings.Contains(got, "disabled") {
+		t.Errorf("unexpected reply: %s", got)
+	}
+
 	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
-	err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
-		ChatID: 100, UserID: 1, PlayedDate: "2025-03-01",
-	})
-	if err != nil {
-		t.Fatalf("SaveResult: %v", err)
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	if got := env.sender.lastAnnouncement().Text; !strings.HasPrefix(got, "And the winner is") {
+		t.Errorf("expected fallback with global sets off, got: %s", got)
 	}
 
+	env.handler.HandleUpdate(ctx, commandMsg(200, 1, "Alice", "/join"))
 	env.sender.reset()
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/rollstats 2025"))
+	env.handler.HandleUpdate(ctx, commandMsg(200, 1, "Alice", "/roll"))
+	if got := env.sender.lastAnnouncement().Text; !strings.HasPrefix(got, "Global pick") {
+		t.Errorf("expected global set in other chat, got: %s", got)
+	}
+}
 
-	got := env.sender.last().Text
-	if !strings.Contains(got, "2025") || !strings.Contains(got, "Alice") {
-		t.Errorf("expected yearly stats via /rollstats 2025, got: %s", got)
+func TestMessageSetCommandsRequireAdmin(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler = NewHandler(env.sender, env.storage, env.handler.tr, "testbot", "roll", []int64{99}, nil, time.UTC)
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/newset"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/globalsets off"))
+
+	if len(env.sender.messages) != 0 {
+		t.Errorf("expected no reply for non-admin, got %d messages", len(env.sender.messages))
+	}
+	if _, err := env.storage.Queries.GetMessageSet(ctx, 1); err == nil {
+		t.Error("expected no set to be created")
 	}
 }
 
-func TestRollWithSuffixFallsBackToRoulette(t *testing.T) {
+func TestParticipants(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
 	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
 	env.sender.reset()
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/rollxyz"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/participants"))
 
 	if len(env.sender.messages) != 1 {
 		t.Fatalf("expected 1 message, got %d", len(env.sender.messages))
 	}
-	if got := env.sender.last().Text; !strings.Contains(got, "winner") || !strings.Contains(got, "Alice") {
-		t.Errorf("expected roulette winner message with Alice, got: %s", got)
+	got := env.sender.last().Text
+	if !strings.Contains(got, "Alice") || !strings.Contains(got, "Bob") {
+		t.Errorf("expected both participants listed, got: %s", got)
+	}
+	if !strings.Contains(got, "1. Alice") || !strings.Contains(got, "2. Bob") {
+		t.Errorf("expected numbered list, got: %s", got)
 	}
 }
 
-func TestRollstatsSuffixFallsBackToStats(t *testing.T) {
+func TestParticipantsEmpty(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/participants"))
+
+	if got := env.sender.last().Text; !strings.Contains(got, "No players") {
+		t.Errorf("expected no-participants message, got: %s", got)
+	}
+}
+
+func TestStats(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
 	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
-	err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
+
+	_, err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
 		ChatID: 100, UserID: 1, PlayedDate: "2026-06-01",
 	})
 	if err != nil {
@@ -543,135 +1120,440 @@ func TestRollstatsSuffixFallsBackToStats(t *testing.T) {
 	}
 
 	env.sender.reset()
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/rollstatsall"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats"))
 
 	if len(env.sender.messages) != 1 {
 		t.Fatalf("expected 1 message, got %d", len(env.sender.messages))
 	}
 	got := env.sender.last().Text
 	if !strings.Contains(got, "2026") {
-		t.Errorf("expected current-year stats, got: %s", got)
+		t.Errorf("expected year in header, got: %s", got)
 	}
-	if !strings.Contains(got, "Alice") {
-		t.Errorf("expected Alice in stats, got: %s", got)
+	if !strings.Contains(got, "Alice") || !strings.Contains(got, "1 win(s)") {
+		t.Errorf("expected Alice with 1 win, got: %s", got)
 	}
 }
 
-func TestResetAsAdmin(t *testing.T) {
+func TestStatsAll(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
-	env.handler = NewHandler(env.sender, env.storage, env.handler.tr, "testbot", "roll", []int64{1}, nil, time.UTC)
-	env.handler.todayFunc = func() string { return testDate }
-
 	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
-	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/reset"))
+	_, err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
+		ChatID: 100, UserID: 1, PlayedDate: "2025-06-01",
+	})
+	if err != nil {
+		t.Fatalf("SaveResult: %v", err)
+	}
+
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats all"))
 
 	if len(env.sender.messages) != 1 {
 		t.Fatalf("expected 1 message, got %d", len(env.sender.messages))
 	}
-	if got := env.sender.last().Text; !strings.Contains(got, "has been reset") {
-		t.Errorf("expected reset-success message, got: %s", got)
+	got := env.sender.last().Text
+	if !strings.Contains(got, "Hall of Fame") {
+		t.Errorf("expected stats header, got: %s", got)
 	}
-
-	_, err := env.storage.Queries.GetTodayResult(ctx, db.GetTodayResultParams{
-		ChatID: 100, PlayedDate: testDate,
-	})
-	if err == nil {
-		t.Error("expected result to be deleted after reset")
+	if !strings.Contains(got, "Alice") || !strings.Contains(got, "1 win(s)") {
+		t.Errorf("expected Alice with 1 win, got: %s", got)
+	}
+	if !strings.Contains(got, "Bob") || !strings.Contains(got, "0 win(s)") {
+		t.Errorf("expected Bob with 0 wins, got: %s", got)
 	}
 }
 
-func TestResetAsNonAdmin(t *testing.T) {
+func TestStatsWithTodayWinnerCrown(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
-	env.handler = NewHandler(env.sender, env.storage, env.handler.tr, "testbot", "roll", []int64{99}, nil, time.UTC)
-	env.handler.todayFunc = func() string { return testDate }
-
 	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
-	env.sender.reset()
+	_, err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
+		ChatID: 100, UserID: 1, PlayedDate: testDate,
+	})
+	if err != nil {
+		t.Fatalf("SaveResult: %v", err)
+	}
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/reset"))
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats"))
 
-	if len(env.sender.messages) != 0 {
-		t.Errorf("expected no reply for non-admin reset, got %d messages", len(env.sender.messages))
+	got := env.sender.last().Text
+	if !strings.Contains(got, "👑") {
+		t.Errorf("expected crown emoji for today's winner, got: %s", got)
 	}
 }
 
-func TestResetNoAdminRestriction(t *testing.T) {
+func TestStatsByYear(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
 	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
-	env.sender.reset()
+	_, err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
+		ChatID: 100, UserID: 1, PlayedDate: "2025-06-01",
+	})
+	if err != nil {
+		t.Fatalf("SaveResult: %v", err)
+	}
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/reset"))
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats 2025"))
 
-	if len(env.sender.messages) != 1 {
-		t.Fatalf("expected 1 message, got %d", len(env.sender.messages))
+	got := env.sender.last().Text
+	if !strings.Contains(got, "2025") {
+		t.Errorf("expected year in header, got: %s", got)
 	}
-	if got := env.sender.last().Text; !strings.Contains(got, "has been reset") {
-		t.Errorf("expected reset-success message, got: %s", got)
+	if !strings.Contains(got, "Alice") {
+		t.Errorf("expected Alice in stats, got: %s", got)
 	}
 }
 
-func TestResetNothingToReset(t *testing.T) {
+func TestStatsByYearNoResults(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/reset"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.sender.reset()
 
-	if got := env.sender.last().Text; !strings.Contains(got, "Nothing to reset") {
-		t.Errorf("expected nothing-to-reset message, got: %s", got)
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats 2020"))
+
+	got := env.sender.last().Text
+	if !strings.Contains(got, "No results for 2020") {
+		t.Errorf("expected no-results message, got: %s", got)
 	}
 }
 
-func TestChatIDWhitelistAllowed(t *testing.T) {
+func TestStatsKeepFormerPlayers(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
-	env.handler = NewHandler(env.sender, env.storage, env.handler.tr, "testbot", "roll", nil, []int64{100}, time.UTC)
-	env.handler.todayFunc = func() string { return testDate }
-
 	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 3, "Carol", "/join"))
+	for date, userID := range map[string]int64{"2026-01-10": 2, "2026-01-11": 2, "2026-01-12": 1} {
+		if _, err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
+			ChatID: 100, UserID: userID, PlayedDate: date,
+		}); err != nil {
+			t.Fatalf("SaveResult: %v", err)
+		}
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/leave"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 3, "Carol", "/leave"))
 
-	if len(env.sender.messages) != 1 {
-		t.Fatalf("expected 1 message for whitelisted chat, got %d", len(env.sender.messages))
+	for _, arg := range []string{"all", "2026"} {
+		env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats "+arg))
+		got := env.sender.last().Text
+		if !strings.Contains(got, "1. Bob (left) — 2 win(s)") || !strings.Contains(got, "2. Alice — 1 win(s)") {
+			t.Errorf("/stats %s: expected Bob marked as a former player, got: %s", arg, got)
+		}
+		if strings.Contains(got, "Carol") {
+			t.Errorf("/stats %s: expected former players without wins to be hidden, got: %s", arg, got)
+		}
+	}
+
+	// Rejoining clears the mark.
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats all"))
+	if got := env.sender.last().Text; strings.Contains(got, "(left)") {
+		t.Errorf("expected Bob to be active again, got: %s", got)
 	}
 }
 
-func TestChatIDWhitelistBlocked(t *testing.T) {
+func TestStatsInvalidPeriod(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
-	env.handler = NewHandler(env.sender, env.storage, env.handler.tr, "testbot", "roll", nil, []int64{200}, time.UTC)
-	env.handler.todayFunc = func() string { return testDate }
-
-	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	for _, arg := range []string{"abc", "1999", "2026-13", "2026-03-01..2026-01-01"} {
+		env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats "+arg))
 
-	if len(env.sender.messages) != 0 {
-		t.Errorf("expected no reply for non-whitelisted chat, got %d messages", len(env.sender.messages))
+		got := env.sender.last().Text
+		if !strings.HasPrefix(got, "Invalid period: "+arg+".") {
+			t.Errorf("expected invalid-period message for %q, got: %s", arg, got)
+		}
 	}
 }
 
-func TestChatIDWhitelistEmpty(t *testing.T) {
+func TestStatsPeriods(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
 	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
+	for date, userID := range map[string]int64{
+		"2025-12-31": 2,
+		"2026-01-05": 2,
+		"2026-01-11": 2,
+		"2026-01-12": 1,
+		"2026-01-14": 1,
+		"2026-02-01": 2,
+	} {
+		if _, err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
+			ChatID: 100, UserID: userID, PlayedDate: date,
+		}); err != nil {
+			t.Fatalf("SaveResult: %v", err)
+		}
+	}
 
-	if len(env.sender.messages) != 1 {
-		t.Fatalf("expected 1 message when no whitelist is set, got %d", len(env.sender.messages))
+	tests := []struct {
+		arg, header, first string
+	}{
+		{"week", "Hall of Fame, week of 2026-01-12:", "Alice — 2 win(s)"},
+		{"month", "Hall of Fame (2026-01):", "Alice — 2 win(s)"},
+		{"2025-12", "Hall of Fame (2025-12):", "Bob — 1 win(s)"},
+		{"2026-01-01..2026-02-01", "Hall of Fame (2026-01-01 – 2026-02-01):", "Bob — 3 win(s)"},
+		{"2026", "Hall of Fame (2026):", "Bob — 3 win(s)"},
+	}
+	for _, tt := range tests {
+		env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats "+tt.arg))
+		got := env.sender.last().Text
+		if !strings.Contains(got, tt.header) {
+			t.Errorf("/stats %s: expected header %q, got: %s", tt.arg, tt.header, got)
+		}
+		if _, body, _ := strings.Cut(got, "\n\n"); !strings.HasPrefix(body, "1. "+tt.first) {
+			t.Errorf("/stats %s: expected %q first, got: %s", tt.arg, tt.first, got)
+		}
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats 2025-11"))
+	if got := env.sender.last().Text; got != "No results for 2025-11." {
+		t.Errorf("unexpected reply: %s", got)
 	}
 }
 
-func TestCommandForDifferentBot(t *testing.T) {
+func TestStatsViaRollCommand(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.sender.reset()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll stats"))
+
+	got := env.sender.last().Text
+	if !strings.Contains(got, "2026") {
+		t.Errorf("expected year-filtered stats via /roll stats, got: %s", got)
+	}
+}
+
+func TestStatsViaRollCommandWithYear(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	_, err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
+		ChatID: 100, UserID: 1, PlayedDate: "2025-03-01",
+	})
+	if err != nil {
+		t.Fatalf("SaveResult: %v", err)
+	}
+
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll stats 2025"))
+
+	got := env.sender.last().Text
+	if !strings.Contains(got, "2025") || !strings.Contains(got, "Alice") {
+		t.Errorf("expected yearly stats via /roll stats 2025, got: %s", got)
+	}
+}
+
+func TestStatsViaRollCommandNoSpace(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.sender.reset()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/rollstats"))
+
+	got := env.sender.last().Text
+	if !strings.Contains(got, "2026") {
+		t.Errorf("expected year-filtered stats via /rollstats, got: %s", got)
+	}
+}
+
+func TestStatsViaRollCommandNoSpaceWithYear(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	_, err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
+		ChatID: 100, UserID: 1, PlayedDate: "2025-03-01",
+	})
+	if err != nil {
+		t.Fatalf("SaveResult: %v", err)
+	}
+
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/rollstats 2025"))
+
+	got := env.sender.last().Text
+	if !strings.Contains(got, "2025") || !strings.Contains(got, "Alice") {
+		t.Errorf("expected yearly stats via /rollstats 2025, got: %s", got)
+	}
+}
+
+func TestRollWithSuffixFallsBackToRoulette(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.sender.reset()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/rollxyz"))
+
+	if len(env.sender.announcement()) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(env.sender.announcement()))
+	}
+	if got := env.sender.lastAnnouncement().Text; !strings.Contains(got, "winner") || !strings.Contains(got, "Alice") {
+		t.Errorf("expected roulette winner message with Alice, got: %s", got)
+	}
+}
+
+func TestRollstatsSuffixFallsBackToStats(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	_, err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
+		ChatID: 100, UserID: 1, PlayedDate: "2026-06-01",
+	})
+	if err != nil {
+		t.Fatalf("SaveResult: %v", err)
+	}
+
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/rollstatsall"))
+
+	if len(env.sender.messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(env.sender.messages))
+	}
+	got := env.sender.last().Text
+	if !strings.Contains(got, "2026") {
+		t.Errorf("expected current-year stats, got: %s", got)
+	}
+	if !strings.Contains(got, "Alice") {
+		t.Errorf("expected Alice in stats, got: %s", got)
+	}
+}
+
+func TestResetAsAdmin(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler = NewHandler(env.sender, env.storage, env.handler.tr, "testbot", "roll", []int64{1}, nil, time.UTC)
+	env.handler.todayFunc = func() string { return testDate }
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	env.sender.reset()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/reset"))
+
+	if len(env.sender.messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(env.sender.messages))
+	}
+	if got := env.sender.last().Text; !strings.Contains(got, "has been reset") {
+		t.Errorf("expected reset-success message, got: %s", got)
+	}
+
+	rows, err := env.storage.Queries.GetTodayResults(ctx, db.GetTodayResultsParams{
+		ChatID: 100, PlayedDate: testDate,
+	})
+	if err != nil || len(rows) != 0 {
+		t.Errorf("expected result to be deleted after reset, got %+v (%v)", rows, err)
+	}
+}
+
+func TestResetAsNonAdmin(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler = NewHandler(env.sender, env.storage, env.handler.tr, "testbot", "roll", []int64{99}, nil, time.UTC)
+	env.handler.todayFunc = func() string { return testDate }
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	env.sender.reset()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/reset"))
+
+	if len(env.sender.messages) != 0 {
+		t.Errorf("expected no reply for non-admin reset, got %d messages", len(env.sender.messages))
+	}
+}
+
+func TestResetNoAdminRestriction(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	env.sender.reset()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/reset"))
+
+	if len(env.sender.messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(env.sender.messages))
+	}
+	if got := env.sender.last().Text; !strings.Contains(got, "has been reset") {
+		t.Errorf("expected reset-success message, got: %s", got)
+	}
+}
+
+func TestResetNothingToReset(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/reset"))
+
+	if got := env.sender.last().Text; !strings.Contains(got, "Nothing to reset") {
+		t.Errorf("expected nothing-to-reset message, got: %s", got)
+	}
+}
+
+func TestChatIDWhitelistAllowed(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler = NewHandler(env.sender, env.storage, env.handler.tr, "testbot", "roll", nil, []int64{100}, time.UTC)
+	env.handler.todayFunc = func() string { return testDate }
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+
+	if len(env.sender.messages) != 1 {
+		t.Fatalf("expected 1 message for whitelisted chat, got %d", len(env.sender.messages))
+	}
+}
+
+func TestChatIDWhitelistBlocked(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler = NewHandler(env.sender, env.storage, env.handler.tr, "testbot", "roll", nil, []int64{200}, time.UTC)
+	env.handler.todayFunc = func() string { return testDate }
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+
+	if len(env.sender.messages) != 0 {
+		t.Errorf("expected no reply for non-whitelisted chat, got %d messages", len(env.sender.messages))
+	}
+}
+
+func TestChatIDWhitelistEmpty(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+
+	if len(env.sender.messages) != 1 {
+		t.Fatalf("expected 1 message when no whitelist is set, got %d", len(env.sender.messages))
+	}
+}
+
+func TestCommandForDifferentBot(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
@@ -803,8 +1685,8 @@ func TestRouletteShowsExistingWinnerEvenAfterLeave(t *testing.T) {
 	if !strings.Contains(got, "already been spun") {
 		t.Errorf("expected already-played message, got: %s", got)
 	}
-	if !strings.Contains(got, "Player #1") {
-		t.Errorf("expected unknown user fallback, got: %s", got)
+	if !strings.Contains(got, "<b>Alice</b>") {
+		t.Errorf("expected the winner's name from the draw, got: %s", got)
 	}
 }
 
@@ -928,3 +1810,1136 @@ func TestExtractArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestPersonalStats(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsgUsername(100, 1, "Alice", "alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsgUsername(100, 2, "Bob", "bob", "/join"))
+	if _, err := env.storage.db.ExecContext(ctx, "UPDATE participants SET joined_at = '2026-01-01 12:00:00'"); err != nil {
+		t.Fatalf("set joined_at: %v", err)
+	}
+	wins := map[string]int64{
+		"2025-12-20": 2,
+		"2026-01-10": 1, "2026-01-11": 1, "2026-01-12": 1,
+		"2026-01-13": 2,
+		"2026-01-14": 1, "2026-01-15": 1,
+	}
+	for date, userID := range wins {
+		if _, err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
+			ChatID: 100, UserID: userID, PlayedDate: date,
+		}); err != nil {
+			t.Fatalf("SaveResult: %v", err)
+		}
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/me"))
+	got := env.sender.last().Text
+	for _, want := range []string{
+		"Wins: 5 (this year: 5, this month: 5)",
+		"Win rate: 33.3% over 15 day(s)",
+		"Streak: 2 current, 3 longest",
+		"Last win: 2026-01-15",
+		"Rank: #1",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in /me, got: %s", want, got)
+		}
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats @Bob"))
+	got = env.sender.last().Text
+	for _, want := range []string{
+		"tg://user?id=2",
+		"Wins: 2 (this year: 1, this month: 1)",
+		"Streak: 0 current, 1 longest",
+		"Last win: 2026-01-13",
+		"Rank: #2",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in /stats @Bob, got: %s", want, got)
+		}
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats @carol"))
+	if got := env.sender.last().Text; got != "No player @carol in this chat." {
+		t.Errorf("unexpected reply: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 3, "Carol", "/me"))
+	if got := env.sender.last().Text; got != "You're not in the game yet." {
+		t.Errorf("unexpected reply: %s", got)
+	}
+}
+
+func TestHistoryPagination(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	for day := 1; day <= 25; day++ {
+		if _, err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
+			ChatID: 100, UserID: 1, PlayedDate: fmt.Sprintf("2026-01-%02d", day),
+			WinnerName: sql.NullString{String: "Alice", Valid: true},
+		}); err != nil {
+			t.Fatalf("SaveResult: %v", err)
+		}
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/history"))
+	first := env.sender.last()
+	if !strings.HasPrefix(first.Text, "<b>Roll history:</b>\n\n2026-01-25 — Alice\n") || !strings.HasSuffix(first.Text, "Page 1 of 3") {
+		t.Fatalf("unexpected first page: %s", first.Text)
+	}
+	if first.ReplyMarkup == nil || len(first.ReplyMarkup.InlineKeyboard[0]) != 1 {
+		t.Fatalf("expected only an older button, got %+v", first.ReplyMarkup)
+	}
+	older := first.ReplyMarkup.InlineKeyboard[0][0]
+
+	press := func(data string) EditMessageTextRequest {
+		t.Helper()
+		env.handler.HandleUpdate(ctx, Update{CallbackQuery: &CallbackQuery{
+			ID:      "cb",
+			From:    User{ID: 2, FirstName: "Bob"},
+			Message: &Message{MessageID: 42, Chat: Chat{ID: 100}},
+			Data:    data,
+		}})
+		if len(env.sender.edits) == 0 {
+			t.Fatalf("expected the message to be edited for %q", data)
+		}
+		return env.sender.edits[len(env.sender.edits)-1]
+	}
+
+	second := press(older.CallbackData)
+	if second.MessageID != 42 || !strings.Contains(second.Text, "2026-01-15 — Alice") || !strings.HasSuffix(second.Text, "Page 2 of 3") {
+		t.Errorf("unexpected second page: %+v", second)
+	}
+	if len(second.ReplyMarkup.InlineKeyboard[0]) != 2 {
+		t.Errorf("expected newer and older buttons, got %+v", second.ReplyMarkup)
+	}
+	if len(env.sender.answers) != 1 || env.sender.answers[0].CallbackQueryID != "cb" {
+		t.Errorf("expected the callback to be answered, got %+v", env.sender.answers)
+	}
+
+	last := press("history:99:")
+	if !strings.Contains(last.Text, "2026-01-01 — Alice") || !strings.HasSuffix(last.Text, "Page 3 of 3") {
+		t.Errorf("expected out-of-range pages to clamp, got: %s", last.Text)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/history 2026-01"))
+	if got := env.sender.last(); !strings.HasPrefix(got.Text, "<b>Roll history (2026-01):</b>") ||
+		!strings.HasSuffix(got.ReplyMarkup.InlineKeyboard[0][0].CallbackData, ":2026-01") {
+		t.Errorf("unexpected month history: %+v", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/history 2025"))
+	if got := env.sender.last(); got.Text != "No rolls yet." || got.ReplyMarkup != nil {
+		t.Errorf("unexpected empty history: %+v", got)
+	}
+}
+
+func TestChart(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/chart"))
+	if got := env.sender.last(); got.Text != "No draws to chart yet." {
+		t.Errorf("expected no data message, got: %s", got.Text)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	env.sender.reset()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/chart month"))
+	if len(env.sender.media) != 1 {
+		t.Fatalf("expected one photo, got %d", len(env.sender.media))
+	}
+	photo, ok := env.sender.media[0].(SendPhotoUploadRequest)
+	if !ok || photo.ChatID != 100 || photo.Caption != "📊 Wins per player: 2026-01" {
+		t.Errorf("unexpected chart: %+v", env.sender.media[0])
+	}
+	if !bytes.HasPrefix(photo.Photo, []byte("\x89PNG")) {
+		t.Errorf("expected a PNG upload")
+	}
+
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/chart me"))
+	if len(env.sender.media) != 1 {
+		t.Fatalf("expected one photo, got %d", len(env.sender.media))
+	}
+	if photo := env.sender.media[0].(SendPhotoUploadRequest); photo.Caption != "📅 Wins of Alice over the last year" {
+		t.Errorf("unexpected calendar caption: %s", photo.Caption)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/chart @nobody"))
+	if got := env.sender.last(); !strings.Contains(got.Text, "nobody") {
+		t.Errorf("expected unknown player message, got: %s", got.Text)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/chart someday"))
+	if got := env.sender.last(); !strings.HasPrefix(got.Text, "Usage: /chart") {
+		t.Errorf("expected usage, got: %s", got.Text)
+	}
+}
+
+func TestAchievements(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/achievements"))
+	if got := env.sender.last().Text; got != "No achievements yet." {
+		t.Errorf("unexpected empty list: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	for _, date := range []string{"2026-01-13", "2026-01-14"} {
+		if _, err := env.storage.Queries.SaveResult(ctx, db.SaveResultParams{
+			ChatID: 100, UserID: 1, PlayedDate: date,
+		}); err != nil {
+			t.Fatalf("SaveResult: %v", err)
+		}
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	if got := env.sender.last().Text; got != "🏅 <b>Alice</b> earned a badge: 🔥 Three wins in a row" {
+		t.Errorf("expected streak badge, got: %s", got)
+	}
+
+	// A longer streak does not award the badge again.
+	env.handler.todayFunc = func() string { return "2026-01-16" }
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	if len(env.sender.messages) != len(env.sender.announcement()) {
+		t.Errorf("expected no badge announcement, got: %s", env.sender.last().Text)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/achievements"))
+	if got := env.sender.last().Text; got != "<b>Achievements:</b>\n\n<b>Alice</b>\n🔥 Three wins in a row — 2026-01-15" {
+		t.Errorf("unexpected achievements: %s", got)
+	}
+}
+
+func TestNamedGames(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/games"))
+	if got := env.sender.last().Text; !strings.HasPrefix(got, "No extra games yet.") {
+		t.Errorf("unexpected empty games list: %s", got)
+	}
+
+	for _, cmd := range []string{"/addgame stats own Stats", "/addgame rollx own Roll", "/addgame Bad-Name own X"} {
+		env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", cmd))
+		if got := env.sender.last().Text; !strings.Contains(got, "can't be used for a game") {
+			t.Errorf("expected %q to be rejected, got: %s", cmd, got)
+		}
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/addgame loser own Loser of the day"))
+	if got := env.sender.last().Text; got != "Created <b>Loser of the day</b>. Roll it with /loser and see its stats with /loserstats." {
+		t.Errorf("unexpected reply: %s", got)
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/addgame loser shared Again"))
+	if got := env.sender.last().Text; got != "There already is a game /loser." {
+		t.Errorf("expected duplicate to be rejected, got: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join loser"))
+	if got := env.sender.last().Text; got != "Bob joined <b>Loser of the day</b>." {
+		t.Errorf("unexpected join reply: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/games"))
+	if got := env.sender.last().Text; got != "<b>Games:</b>\n\n/loser — Loser of the day (1 player(s) of its own)" {
+		t.Errorf("unexpected games list: %s", got)
+	}
+
+	// An own game's leaderboard lists its own players, not the main game's.
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/loserstats all"))
+	if got := env.sender.last().Text; !strings.Contains(got, "1. Bob — 0 win(s)") || strings.Contains(got, "Alice") {
+		t.Errorf("expected only Bob before the first roll, got: %s", got)
+	}
+
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/loser"))
+	if got := env.sender.last().Text; !strings.HasPrefix(got, "<b>Loser of the day</b>\nAnd the winner is") || !strings.Contains(got, "tg://user?id=2") {
+		t.Errorf("expected Bob to lose, got: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	if got := env.sender.lastAnnouncement().Text; !strings.Contains(got, "tg://user?id=1") {
+		t.Errorf("expected Alice to win the main game on the same day, got: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/loser"))
+	if got := env.sender.last().Text; !strings.HasPrefix(got, "<b>Loser of the day</b>\nThe wheel has already been spun today") {
+		t.Errorf("expected the existing result, got: %s", got)
+	}
+
+	for _, arg := range []string{"all", "2026"} {
+		env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/loserstats "+arg))
+		if got := env.sender.last().Text; !strings.Contains(got, "👑 Bob — 1") || strings.Contains(got, "Alice") {
+			t.Errorf("/loserstats %s: unexpected game stats: %s", arg, got)
+		}
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats all"))
+	if got := env.sender.last().Text; !strings.Contains(got, "Alice") || strings.Contains(got, "Bob") {
+		t.Errorf("expected main stats without Bob, got: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/reset loser"))
+	if got := env.sender.last().Text; !strings.HasPrefix(got, "<b>Loser of the day</b>\nThe wheel has been reset") {
+		t.Errorf("unexpected reset reply: %s", got)
+	}
+	if rows, err := env.storage.Queries.GetTodayResults(ctx, db.GetTodayResultsParams{ChatID: 100, PlayedDate: testDate}); err != nil || len(rows) != 1 {
+		t.Errorf("expected the main result to survive: %v", err)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/leave loser"))
+	if got := env.sender.last().Text; got != "Bob left <b>Loser of the day</b>." {
+		t.Errorf("unexpected leave reply: %s", got)
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/loserstats all"))
+	if got := env.sender.last().Text; strings.Contains(got, "Bob") {
+		t.Errorf("expected a former player without wins to be hidden, got: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/delgame loser"))
+	if got := env.sender.last().Text; got != "Deleted <b>Loser of the day</b> with its results and message sets." {
+		t.Errorf("unexpected delete reply: %s", got)
+	}
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/loser"))
+	if len(env.sender.messages) != 0 {
+		t.Errorf("expected deleted game to be ignored, got: %s", env.sender.last().Text)
+	}
+}
+
+func TestDualMode(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/set mode dual"))
+	if got := env.sender.last().Text; !strings.Contains(got, "dual") {
+		t.Fatalf("unexpected reply: %s", got)
+	}
+
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	got := env.sender.lastAnnouncement().Text
+	if !strings.Contains(got, "And the winner is") || !strings.Contains(got, "And today's loser is") {
+		t.Fatalf("expected winner and loser, got: %s", got)
+	}
+
+	proof, err := env.storage.Queries.GetResultProof(ctx, db.GetResultProofParams{ChatID: 100, PlayedDate: testDate})
+	if err != nil {
+		t.Fatalf("GetResultProof: %v", err)
+	}
+	if !proof.LoserID.Valid || proof.LoserID.Int64 == proof.UserID {
+		t.Fatalf("expected a loser other than winner %d, got %+v", proof.UserID, proof.LoserID)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	if got := env.sender.last().Text; !strings.Contains(got, "Today's loser is") {
+		t.Errorf("expected the existing loser, got: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/verify"))
+	if got := env.sender.last().Text; !strings.Contains(got, "as the loser, as announced") {
+		t.Errorf("expected the loser to verify, got: %s", got)
+	}
+
+	loser := &User{ID: proof.LoserID.Int64, FirstName: map[int64]string{1: "Alice", 2: "Bob"}[proof.LoserID.Int64]}
+	u := commandMsg(100, 1, "Alice", "/setwinner")
+	u.Message.ReplyToMessage = &Message{From: loser, Chat: Chat{ID: 100}, Text: "hi"}
+	env.handler.HandleUpdate(ctx, u)
+	if got, want := env.sender.last().Text, loser.FirstName+" lost today's draw and can't also win it."; got != want {
+		t.Errorf("expected the loser to be refused as winner, got: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats all"))
+	got = env.sender.last().Text
+	_, losers, ok := strings.Cut(got, "<b>Losers:</b>\n\n")
+	if !ok || strings.Count(losers, "loss(es)") != 1 {
+		t.Errorf("expected one loser, got: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/stats 2026"))
+	if got := env.sender.last().Text; !strings.Contains(got, "— 1 loss(es)") {
+		t.Errorf("expected losers in period stats, got: %s", got)
+	}
+}
+
+func TestSeveralWinners(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	for i, name := range []string{"Alice", "Bob", "Carol"} {
+		env.handler.HandleUpdate(ctx, commandMsg(100, int64(i+1), name, "/join"))
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/winners"))
+	if got := env.sender.last().Text; got != "The main game picks 1 winner(s) a day." {
+		t.Errorf("unexpected reply: %s", got)
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/winners 11"))
+	if got := env.sender.last().Text; got != "Usage: /winners [game] [1-10]" {
+		t.Errorf("expected usage, got: %s", got)
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/winners 2"))
+	if got := env.sender.last().Text; got != "The main game now picks 2 winner(s) a day." {
+		t.Errorf("unexpected reply: %s", got)
+	}
+
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	if got := env.sender.messages[0].Text; !strings.HasPrefix(got, "And today's winners are...\n1. ") || !strings.Contains(got, "\n2. ") {
+		t.Errorf("expected both winners in order, got: %s", got)
+	}
+
+	rows, err := env.storage.Queries.GetTodayResults(ctx, db.GetTodayResultsParams{ChatID: 100, PlayedDate: testDate})
+	if err != nil {
+		t.Fatalf("GetTodayResults: %v", err)
+	}
+	if len(rows) != 2 || rows[0].UserID == rows[1].UserID {
+		t.Fatalf("expected 2 distinct winners, got %+v", rows)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	want := "Today's winners are:\n1. <b>" + rows[0].WinnerName.String + "</b>\n2. <b>" + rows[1].WinnerName.String + "</b>"
+	if got := env.sender.last().Text; !strings.HasSuffix(got, want) {
+		t.Errorf("expected the ranked winners, got: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/verify"))
+	if got := env.sender.last().Text; !strings.Contains(got, "✅") {
+		t.Errorf("expected the roll to verify, got: %s", got)
+	}
+}
+
+func TestPoints(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/richest"))
+	if got := env.sender.last().Text; got != "Nobody has any points yet." {
+		t.Errorf("unexpected empty ranking: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+
+	rows, err := env.storage.Queries.GetTodayResults(ctx, db.GetTodayResultsParams{ChatID: 100, PlayedDate: testDate})
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("GetTodayResults: %+v, %v", rows, err)
+	}
+	winner, loser := "Alice", "Bob"
+	if rows[0].UserID == 2 {
+		winner, loser = loser, winner
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/richest"))
+	want := "<b>Richest players:</b>\n\n1. " + winner + " — 11 point(s)\n2. " + loser + " — 1 point(s)\n"
+	if got := env.sender.last().Text; got != want {
+		t.Errorf("unexpected ranking: %q", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/reset"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/balance"))
+	if got := env.sender.last().Text; got != "💰 Bob has 0 point(s)." {
+		t.Errorf("expected the reset to reverse the payout, got: %s", got)
+	}
+
+	entries, err := env.storage.Queries.ListLedger(ctx, 100)
+	if err != nil {
+		t.Fatalf("ListLedger: %v", err)
+	}
+	if len(entries) != 5 || entries[3].Reason != LedgerReversal || !entries[3].ResultID.Valid {
+		t.Errorf("expected 3 payouts and 2 reversals, got %+v", entries)
+	}
+	if _, err := env.storage.db.ExecContext(ctx, "UPDATE ledger SET amount = 100"); err == nil {
+		t.Error("expected ledger entries to be immutable")
+	}
+}
+
+func TestBets(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsgUsername(100, 1, "Alice", "alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsgUsername(100, 2, "Bob", "bob", "/join"))
+	for _, userID := range []int64{1, 2} {
+		if err := env.storage.Queries.AddLedgerEntry(ctx, db.AddLedgerEntryParams{
+			ChatID: 100, UserID: userID, Amount: 20, Reason: LedgerAllowance,
+		}); err != nil {
+			t.Fatalf("AddLedgerEntry: %v", err)
+		}
+	}
+
+	// Former players can't be bet on, nor matched by a bare "@" when they
+	// have no username.
+	env.handler.HandleUpdate(ctx, commandMsgUsername(100, 4, "Dave", "dave", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 5, "Eve", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsgUsername(100, 4, "Dave", "dave", "/leave"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 5, "Eve", "/leave"))
+
+	for _, tt := range []struct{ cmd, want string }{
+		{"/bet", "Usage: /bet @username amount"},
+		{"/bet @bob -1", "Usage: /bet @username amount"},
+		{"/bet @ 5", "Usage: /bet @username amount"},
+		{"/bet @dave 1", "Dave isn't in the roulette."},
+		{"/balance @", "Usage: /balance [@username]"},
+		{"/stats @", "Invalid period: @"},
+		{"/chart @", "Usage: /chart"},
+		{"/bet @carol 1", "carol"},
+		{"/bet @bob 50", "You only have 20 point(s)."},
+		{"/bet @bob 5", "🎟 Alice bet 5 point(s) on Bob, paying 10 if they win today."},
+		{"/bet @alice 1", "You already placed a bet today."},
+	} {
+		env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", tt.cmd))
+		if got := env.sender.last().Text; !strings.Contains(got, tt.want) {
+			t.Errorf("%s: expected %q, got: %s", tt.cmd, tt.want, got)
+		}
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/bet @alice 5"))
+
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	var summary string
+	for _, m := range env.sender.messages {
+		if strings.HasPrefix(m.Text, "<b>Bets:</b>") {
+			summary = m.Text
+		}
+	}
+	if !strings.Contains(summary, "won 10 point(s)") || !strings.Contains(summary, "lost 5 point(s)") {
+		t.Errorf("expected one winning and one losing bet, got: %q", summary)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/balance"))
+	bob := env.sender.last().Text
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/balance"))
+	alice := env.sender.last().Text
+	// Both staked 5 on each other and got the allowance; one won the roll
+	// and the other the bet, 10 each.
+	if alice != "💰 Alice has 26 point(s)." || bob != "💰 Bob has 26 point(s)." {
+		t.Errorf("unexpected balances: %s / %s", alice, bob)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/bet @alice 1"))
+	if got := env.sender.last().Text; got != "You already placed a bet today." {
+		t.Errorf("unexpected reply: %s", got)
+	}
+	env.handler.HandleUpdate(ctx, commandMsgUsername(100, 3, "Carol", "carol", "/join"))
+	if err := env.storage.Queries.AddLedgerEntry(ctx, db.AddLedgerEntryParams{
+		ChatID: 100, UserID: 3, Amount: 5, Reason: LedgerAllowance,
+	}); err != nil {
+		t.Fatalf("AddLedgerEntry: %v", err)
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 3, "Carol", "/bet @bob 1"))
+	if got := env.sender.last().Text; got != "Bets are closed, today's roll already happened." {
+		t.Errorf("expected bets to be closed after the roll, got: %s", got)
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/reset"))
+	open, err := env.storage.Queries.ListOpenBets(ctx, db.ListOpenBetsParams{ChatID: 100, BetDate: testDate})
+	if err != nil || len(open) != 2 {
+		t.Errorf("expected the reset to reopen both bets, got %+v, %v", open, err)
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/balance"))
+	if got := env.sender.last().Text; got != "💰 Bob has 15 point(s)." {
+		t.Errorf("expected only the stake to stay taken, got: %s", got)
+	}
+
+	// Other strategies don't draw at the uniform odds bets pay: no new bets
+	// are taken and the open ones are refunded by the roll.
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/set strategy deck"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 3, "Carol", "/bet @bob 1"))
+	if got := env.sender.last().Text; got != "Bets are only taken while the strategy is <code>uniform</code>, whose odds they pay." {
+		t.Errorf("expected bets to be refused, got: %s", got)
+	}
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	summary = ""
+	for _, m := range env.sender.messages {
+		if strings.HasPrefix(m.Text, "<b>Bets:</b>") {
+			summary = m.Text
+		}
+	}
+	if strings.Count(summary, "got 5 point(s) back") != 2 {
+		t.Errorf("expected both bets to be refunded, got: %q", summary)
+	}
+}
+
+func TestDuel(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsgUsername(100, 1, "Alice", "alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsgUsername(100, 2, "Bob", "bob", "/join"))
+
+	challenge := func(userID int64, name, text string, entity MessageEntity) SendMessageRequest {
+		t.Helper()
+		u := commandMsg(100, userID, name, text)
+		u.Message.Entities = append(u.Message.Entities, entity)
+		env.sender.reset()
+		env.handler.HandleUpdate(ctx, u)
+		return env.sender.last()
+	}
+	press := func(userID int64, data string) AnswerCallbackQueryRequest {
+		t.Helper()
+		env.sender.reset()
+		env.handler.HandleUpdate(ctx, Update{CallbackQuery: &CallbackQuery{
+			ID:      "cb",
+			From:    User{ID: userID},
+			Message: &Message{MessageID: 7, Chat: Chat{ID: 100}},
+			Data:    data,
+		}})
+		if len(env.sender.answers) != 1 {
+			t.Fatalf("expected the callback to be answered for %q", data)
+		}
+		return env.sender.answers[0]
+	}
+	bobMention := MessageEntity{Type: "mention", Offset: 6, Length: 4}
+
+	msg := challenge(1, "Alice", "/duel @bob", bobMention)
+	if msg.Text != "⚔️ Alice challenges Bob to a duel! Accept within 5 minutes." {
+		t.Fatalf("unexpected challenge: %s", msg.Text)
+	}
+	if msg.ReplyMarkup == nil || len(msg.ReplyMarkup.InlineKeyboard[0]) != 2 {
+		t.Fatalf("expected accept and decline buttons, got %+v", msg.ReplyMarkup)
+	}
+	accept := msg.ReplyMarkup.InlineKeyboard[0][0].CallbackData
+	if accept != "duel:accept:1" {
+		t.Fatalf("unexpected accept data: %s", accept)
+	}
+
+	if got := press(1, accept); got.Text != "Only the challenged player can answer this duel." {
+		t.Errorf("expected the challenger to be refused, got %q", got.Text)
+	}
+	if len(env.sender.edits) != 0 {
+		t.Fatalf("expected no edit for the challenger's press")
+	}
+
+	if got := press(2, accept); got.Text != "" {
+		t.Errorf("expected a silent answer, got %q", got.Text)
+	}
+	if len(env.sender.edits) != 1 || !strings.HasSuffix(env.sender.edits[0].Text, "wins the duel!") {
+		t.Fatalf("expected the challenge to show the result, got %+v", env.sender.edits)
+	}
+	if env.sender.edits[0].ReplyMarkup != nil {
+		t.Errorf("expected the buttons to be removed")
+	}
+	if got := press(2, accept); got.Text != "This duel is already over." || len(env.sender.edits) != 0 {
+		t.Errorf("expected a second press to change nothing, got %q", got.Text)
+	}
+
+	// A text_mention names a player without a username.
+	msg = challenge(2, "Bob", "/duel Alice", MessageEntity{Type: "text_mention", Offset: 6, Length: 5, User: &User{ID: 1, FirstName: "Alice"}})
+	press(1, msg.ReplyMarkup.InlineKeyboard[0][1].CallbackData)
+	if len(env.sender.edits) != 1 || env.sender.edits[0].Text != "🏳️ Alice declined the duel with Bob." {
+		t.Fatalf("expected the duel to be declined, got %+v", env.sender.edits)
+	}
+
+	msg = challenge(1, "Alice", "/duel @bob", bobMention)
+	if _, err := env.storage.db.ExecContext(ctx, "UPDATE duels SET created_at = datetime('now', '-10 minutes') WHERE id = 3"); err != nil {
+		t.Fatal(err)
+	}
+	if got := press(2, msg.ReplyMarkup.InlineKeyboard[0][0].CallbackData); got.Text != "This duel is already over." {
+		t.Errorf("expected a late accept to be refused, got %q", got.Text)
+	}
+	if len(env.sender.edits) != 1 || env.sender.edits[0].Text != "⌛ Bob didn't answer the duel with Alice in time." {
+		t.Fatalf("expected the duel to expire, got %+v", env.sender.edits)
+	}
+
+	// An open duel blocks another between the same players until it
+	// times out, even if nobody presses its buttons.
+	challenge(1, "Alice", "/duel @bob", bobMention)
+	aliceMention := MessageEntity{Type: "mention", Offset: 6, Length: 6}
+	if got := challenge(2, "Bob", "/duel @alice", aliceMention); got.Text != "Bob and Alice already have an open duel. Answer it first." {
+		t.Errorf("expected a second open duel to be refused, got %q", got.Text)
+	}
+	if _, err := env.storage.db.ExecContext(ctx, "UPDATE duels SET created_at = datetime('now', '-10 minutes') WHERE id = 4"); err != nil {
+		t.Fatal(err)
+	}
+	if got := challenge(2, "Bob", "/duel @alice", aliceMention); got.ReplyMarkup == nil {
+		t.Errorf("expected a new duel once the old one timed out, got %q", got.Text)
+	}
+	var status string
+	if err := env.storage.db.QueryRowContext(ctx, "SELECT status FROM duels WHERE id = 4").Scan(&status); err != nil || status != DuelExpired {
+		t.Errorf("expected the stale duel to be expired, got %q (%v)", status, err)
+	}
+
+	for _, tc := range []struct {
+		userID int64
+		name   string
+		text   string
+		entity MessageEntity
+		want   string
+	}{
+		{1, "Alice", "/duel", MessageEntity{}, "Usage: /duel @username"},
+		{1, "Alice", "/duel @alice", aliceMention, "You can't duel yourself."},
+		{3, "Carol", "/duel @bob", bobMention, "Both players must be in the roulette to duel."},
+	} {
+		if got := challenge(tc.userID, tc.name, tc.text, tc.entity); got.Text != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.text, got.Text, tc.want)
+		}
+	}
+
+	env.sender.reset()
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/duels"))
+	text := env.sender.last().Text
+	if !strings.HasPrefix(text, "<b>Duel champions:</b>\n\n1. ") ||
+		!strings.Contains(text, "— 1 win(s), 0 loss(es)") || !strings.Contains(text, "— 0 win(s), 1 loss(es)") {
+		t.Errorf("unexpected duel leaderboard: %s", text)
+	}
+}
+
+func TestEntityText(t *testing.T) {
+	// The emoji takes two UTF-16 code units, which entity offsets count.
+	text := "/duel 🎲 @bob"
+	if got := entityText(text, MessageEntity{Type: "mention", Offset: 9, Length: 4}); got != "@bob" {
+		t.Errorf("got %q, want @bob", got)
+	}
+	if got := entityText(text, MessageEntity{Offset: 9, Length: 10}); got != "" {
+		t.Errorf("expected an out of range entity to be empty, got %q", got)
+	}
+}
+
+func TestAdminTargeting(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsgUsername(100, 1, "Alice", "alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsgUsername(100, 2, "Bob", "bob", "/join"))
+
+	// admin sends a command as Alice, with a mention entity for its
+	// @username if it has one.
+	admin := func(text string, reply *User) string {
+		t.Helper()
+		u := commandMsg(100, 1, "Alice", text)
+		if at := strings.IndexByte(text, '@'); at >= 0 {
+			u.Message.Entities = append(u.Message.Entities, MessageEntity{Type: "mention", Offset: at, Length: len(text) - at})
+		}
+		if reply != nil {
+			u.Message.ReplyToMessage = &Message{From: reply, Chat: Chat{ID: 100}, Text: "hi"}
+		}
+		env.handler.HandleUpdate(ctx, u)
+		return env.sender.last().Text
+	}
+	carol := &User{ID: 3, FirstName: "Carol", Username: "carol"}
+
+	for _, tt := range []struct {
+		text  string
+		reply *User
+		want  string
+	}{
+		{"/add", nil, "Reply to someone's message with /add to enrol them in the roulette."},
+		{"/add", &User{ID: 50, FirstName: "Bot", IsBot: true}, "Reply to someone's message"},
+		{"/add", carol, "Carol is in the roulette now."},
+		{"/add", carol, "Carol is already in the roulette."},
+		{"/kick @bob", nil, "Bob was removed from the roulette."},
+		{"/kick @bob", nil, "Bob isn't in the roulette."},
+		{"/kick @dave", nil, "dave"},
+		{"/add @bob", nil, "Bob is in the roulette now."},
+		{"/setwinner", nil, "Usage: /setwinner @username"},
+		{"/setwinner @bob", nil, "The wheel hasn't been spun today"},
+	} {
+		if got := admin(tt.text, tt.reply); !strings.Contains(got, tt.want) {
+			t.Errorf("%s: expected %q, got: %s", tt.text, tt.want, got)
+		}
+	}
+
+	participants, err := env.storage.Queries.GetParticipants(ctx, 100)
+	if err != nil || len(participants) != 3 {
+		t.Fatalf("expected 3 participants, got %+v (%v)", participants, err)
+	}
+
+	// Carol bets on Bob; whoever wins, the result is corrected to Bob.
+	if err := env.storage.Queries.AddLedgerEntry(ctx, db.AddLedgerEntryParams{
+		ChatID: 100, UserID: 3, Amount: 5, Reason: LedgerAllowance,
+	}); err != nil {
+		t.Fatalf("AddLedgerEntry: %v", err)
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 3, "Carol", "/bet @bob 5"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+
+	winners := env.handler.todayWinnerIDs(ctx, 100, mainGameID)
+	if len(winners) != 1 {
+		t.Fatalf("expected one winner, got %v", winners)
+	}
+	if winners[0] == 2 {
+		if got := admin("/setwinner @bob", nil); got != "Bob already won today." {
+			t.Fatalf("unexpected answer: %s", got)
+		}
+		if got := admin("/setwinner", carol); !strings.HasPrefix(got, "Today's result was corrected: the winner is Carol instead of Bob.") {
+			t.Fatalf("unexpected answer: %s", got)
+		}
+	}
+	if got := admin("/setwinner @bob", nil); !strings.HasPrefix(got, "Today's result was corrected: the winner is Bob instead of ") {
+		t.Fatalf("unexpected answer: %s", got)
+	}
+	if winners := env.handler.todayWinnerIDs(ctx, 100, mainGameID); !slices.Equal(winners, []int64{2}) {
+		t.Errorf("expected Bob to be today's winner, got %v", winners)
+	}
+
+	// /verify still checks the draw and tells it was overridden, unless
+	// Bob was drawn in the first place.
+	verify := admin("/verify", nil)
+	if !strings.Contains(verify, "as announced.") {
+		t.Errorf("expected the draw to verify, got: %s", verify)
+	}
+	if overridden := strings.Contains(verify, "An admin replaced the drawn winner"); overridden != (winners[0] != 2) {
+		t.Errorf("expected the override to show only when Bob wasn't drawn (drawn %d), got: %s", winners[0], verify)
+	}
+
+	for userID, want := range map[int64]int64{1: 1, 2: winPoints + 1, 3: 15 + 1} {
+		balance, err := env.storage.Queries.GetBalance(ctx, db.GetBalanceParams{ChatID: 100, UserID: userID})
+		if err != nil {
+			t.Fatalf("GetBalance: %v", err)
+		}
+		if balance != want {
+			t.Errorf("user %d: expected balance %d, got %d", userID, want, balance)
+		}
+	}
+}
+
+func TestResetUndo(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsgUsername(100, 1, "Alice", "alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsgUsername(100, 2, "Bob", "bob", "/join"))
+	if err := env.storage.Queries.AddLedgerEntry(ctx, db.AddLedgerEntryParams{
+		ChatID: 100, UserID: 1, Amount: 20, Reason: LedgerAllowance,
+	}); err != nil {
+		t.Fatalf("AddLedgerEntry: %v", err)
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/bet @bob 5"))
+
+	cmd := func(text string) string {
+		t.Helper()
+		env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", text))
+		return env.sender.last().Text
+	}
+	balances := func() [2]int64 {
+		t.Helper()
+		var got [2]int64
+		for i := range got {
+			b, err := env.storage.Queries.GetBalance(ctx, db.GetBalanceParams{ChatID: 100, UserID: int64(i + 1)})
+			if err != nil {
+				t.Fatalf("GetBalance: %v", err)
+			}
+			got[i] = b
+		}
+		return got
+	}
+	count := func(table string) int {
+		t.Helper()
+		var n int
+		if err := env.storage.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if got := cmd("/undo"); got != "There is no reset to undo today." {
+		t.Errorf("unexpected undo without a reset: %s", got)
+	}
+
+	badges := func() int {
+		t.Helper()
+		rows, err := env.storage.Queries.ListAchievements(ctx, 100)
+		if err != nil {
+			t.Fatalf("ListAchievements: %v", err)
+		}
+		return len(rows)
+	}
+
+	cmd("/roll")
+	rolled := balances()
+	if got := badges(); got != 1 {
+		t.Fatalf("expected the winner to earn a badge, got %d", got)
+	}
+	winner := env.handler.todayWinnerIDs(ctx, 100, mainGameID)
+
+	if got := cmd("/reset"); !strings.Contains(got, "has been reset") {
+		t.Fatalf("unexpected reset reply: %s", got)
+	}
+	if got := balances(); got != [2]int64{15, 0} {
+		t.Errorf("expected the roll's points to be reversed, got %v", got)
+	}
+	if count("voided_results") != 1 || count("results") != 0 {
+		t.Errorf("expected the result to be voided, not deleted")
+	}
+	var resetBy int64
+	if err := env.storage.db.QueryRowContext(ctx, "SELECT user_id FROM resets").Scan(&resetBy); err != nil || resetBy != 1 {
+		t.Errorf("expected the reset to be recorded for Alice, got %d (%v)", resetBy, err)
+	}
+	if got := badges(); got != 0 {
+		t.Errorf("expected the voided win's badge to be revoked, got %d", got)
+	}
+
+	if got := cmd("/undo"); !strings.HasPrefix(got, "The reset was undone. Today's winner is ") {
+		t.Fatalf("unexpected undo reply: %s", got)
+	}
+	if got := env.handler.todayWinnerIDs(ctx, 100, mainGameID); !slices.Equal(got, winner) {
+		t.Errorf("expected winner %v to be restored, got %v", winner, got)
+	}
+	if got := balances(); got != rolled {
+		t.Errorf("expected balances %v after undo, got %v", rolled, got)
+	}
+	if got := badges(); got != 1 {
+		t.Errorf("expected the badge to be restored, got %d", got)
+	}
+	if got := cmd("/undo"); got != "There is no reset to undo today." {
+		t.Errorf("expected a single undo, got: %s", got)
+	}
+
+	cmd("/reset")
+	cmd("/roll")
+	if got := cmd("/undo"); got != "The wheel was spun again after the reset. Reset that roll before undoing." {
+		t.Errorf("expected undo to refuse after a new roll, got: %s", got)
+	}
+
+	// Two resets so far today; the third is the last one allowed.
+	cmd("/reset")
+	cmd("/roll")
+	if got := cmd("/reset"); got != "This game's wheel can only be reset 3 time(s) a day." {
+		t.Errorf("expected the reset limit, got: %s", got)
+	}
+	if len(env.handler.todayWinnerIDs(ctx, 100, mainGameID)) != 1 {
+		t.Error("expected the result to survive a refused reset")
+	}
+	if got := cmd("/set resets 0"); got != "Invalid value for resets." {
+		t.Errorf("expected a limit of 0 to be refused, got: %s", got)
+	}
+
+	// The main game's resets don't count against another game's.
+	cmd("/addgame loser shared Loser of the day")
+	cmd("/loser")
+	if got := cmd("/reset loser"); !strings.Contains(got, "has been reset") {
+		t.Errorf("expected the named game to have its own limit, got: %s", got)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/leave"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/reset"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/set cooldown 5"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/set cooldown 99"))
+
+	rows, err := env.storage.Queries.ListAudit(ctx, 100)
+	if err != nil {
+		t.Fatalf("ListAudit: %v", err)
+	}
+	want := []struct {
+		actor         int64
+		action        string
+		before, after string
+	}{
+		{1, AuditJoin, "", `{"name":"Alice","user_id":1}`},
+		{2, AuditJoin, "", `{"name":"Bob","user_id":2}`},
+		{2, AuditLeave, `{"name":"Bob","user_id":2}`, ""},
+		{1, AuditRoll, "", `{"date":"2026-01-15","game":"","winners":[1]}`},
+		{1, AuditReset, `{"date":"2026-01-15","game":"","winners":[1]}`, ""},
+		{1, AuditSetting, `{"cooldown":"3"}`, `{"cooldown":"5"}`},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), rows)
+	}
+	for i, w := range want {
+		r := rows[i]
+		if r.ActorID != w.actor || r.Action != w.action || r.Before.String != w.before || r.After.String != w.after {
+			t.Errorf("entry %d: got %d %s %q → %q, want %+v", i, r.ActorID, r.Action, r.Before.String, r.After.String, w)
+		}
+	}
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/audit 2"))
+	text := env.sender.last().Text
+	if !strings.HasPrefix(text, "<b>Audit log:</b>\n\n") || strings.Count(text, "\n") != 3 {
+		t.Fatalf("expected two entries, got: %s", text)
+	}
+	if !strings.Contains(text, "— Alice: setting <code>{&#34;cooldown&#34;:&#34;3&#34;}</code> → <code>{&#34;cooldown&#34;:&#34;5&#34;}</code>") {
+		t.Errorf("expected the setting change first, got: %s", text)
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/audit 100"))
+	if got := env.sender.last().Text; got != "Usage: /audit [1-50]" {
+		t.Errorf("unexpected reply: %s", got)
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(200, 1, "Alice", "/audit"))
+	if got := env.sender.last().Text; got != "Nothing has been recorded in this chat yet." {
+		t.Errorf("unexpected reply: %s", got)
+	}
+}
+
+func TestAuditAdminChanges(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsgUsername(100, 1, "Alice", "alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsgUsername(100, 2, "Bob", "bob", "/join"))
+	if err := env.storage.Queries.AddLedgerEntry(ctx, db.AddLedgerEntryParams{
+		ChatID: 100, UserID: 1, Amount: 20, Reason: LedgerAllowance,
+	}); err != nil {
+		t.Fatalf("AddLedgerEntry: %v", err)
+	}
+
+	for _, text := range []string{
+		"/addgame quiz own Quiz",
+		"/newset quiz",
+		"/addline 1 {winner} wins!",
+		"/adddice 1",
+		"/setrules 1 weight=3",
+		"/delset 1",
+		"/delgame quiz",
+		"/bet @bob 5",
+	} {
+		env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", text))
+	}
+	duel := commandMsg(100, 1, "Alice", "/duel @bob")
+	duel.Message.Entities = append(duel.Message.Entities, MessageEntity{Type: "mention", Offset: 6, Length: 4})
+	env.handler.HandleUpdate(ctx, duel)
+	env.handler.HandleUpdate(ctx, Update{CallbackQuery: &CallbackQuery{
+		ID:      "cb",
+		From:    User{ID: 2},
+		Message: &Message{MessageID: 7, Chat: Chat{ID: 100}},
+		Data:    "duel:decline:1",
+	}})
+
+	rows, err := env.storage.Queries.ListAudit(ctx, 100)
+	if err != nil {
+		t.Fatalf("ListAudit: %v", err)
+	}
+	var got []string
+	for _, r := range rows[2:] {
+		got = append(got, fmt.Sprintf("%d %s %s %s", r.ActorID, r.Action, r.Before.String, r.After.String))
+	}
+	want := []string{
+		`1 addgame  {"game":"quiz","shared":false,"title":"Quiz"}`,
+		`1 newset  {"game":"quiz","set":1}`,
+		`1 addstep  {"body":"{winner} wins!","caption":"","kind":"text","position":1,"set":1}`,
+		`1 addstep  {"body":"🎲","caption":"","kind":"dice","position":2,"set":1}`,
+		`1 setrules {"rules":"","set":1} {"rules":"weight=3","set":1}`,
+		`1 delset {"rules":"weight=3","set":1} `,
+		`1 delgame {"game":"quiz","shared":false,"title":"Quiz"} `,
+		`1 bet  {"amount":5,"bet":1,"date":"2026-01-15","target_id":2}`,
+		`2 duel {"duel":1,"status":"pending"} {"duel":1,"status":"declined"}`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("unexpected audit entries:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Entries are written in the transaction of their change, so a change
+	// that can't be recorded is rolled back.
+	if _, err := env.storage.db.ExecContext(ctx, "DROP TABLE audit_log"); err != nil {
+		t.Fatal(err)
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/addgame trivia own Trivia"))
+	if _, ok, err := env.handler.lookupGame(ctx, 100, "trivia"); err != nil || ok {
+		t.Errorf("expected the game not to be created without its audit entry (%v)", err)
+	}
+}
+
+func TestMembershipSync(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/addgame quiz own Quiz"))
+	env.handler.HandleUpdate(ctx, commandMsg(100, 2, "Bob", "/join quiz"))
+
+	memberUpdate := func(self bool, user User, from, to string) {
+		t.Helper()
+		u := &ChatMemberUpdated{
+			Chat:          Chat{ID: 100},
+			From:          User{ID: 1, FirstName: "Alice"},
+			OldChatMember: ChatMember{Status: from, User: user},
+			NewChatMember: ChatMember{Status: to, User: user},
+		}
+		if self {
+			env.handler.HandleUpdate(ctx, Update{MyChatMember: u})
+		} else {
+			env.handler.HandleUpdate(ctx, Update{ChatMember: u})
+		}
+	}
+	actions := func() []string {
+		t.Helper()
+		rows, err := env.storage.Queries.ListAudit(ctx, 100)
+		if err != nil {
+			t.Fatalf("ListAudit: %v", err)
+		}
+		var got []string
+		for _, r := range rows {
+			got = append(got, r.Action+" "+r.Before.String+" "+r.After.String)
+		}
+		return got[len(got)-min(len(got), 2):]
+	}
+
+	bob := User{ID: 2, FirstName: "Bob"}
+	memberUpdate(false, bob, "member", "kicked")
+	memberUpdate(false, bob, "kicked", "left")
+
+	participants, err := env.storage.Queries.GetParticipants(ctx, 100)
+	if err != nil || len(participants) != 1 || participants[0].UserID != 1 {
+		t.Fatalf("expected only Alice to be left, got %+v (%v)", participants, err)
+	}
+	g, err := env.storage.Queries.GetGameByCommand(ctx, db.GetGameByCommandParams{ChatID: 100, Command: "quiz"})
+	if err != nil {
+		t.Fatalf("GetGameByCommand: %v", err)
+	}
+	if players, err := env.storage.Queries.GetGameParticipants(ctx, g.ID); err != nil || len(players) != 0 {
+		t.Errorf("expected Bob to be off the quiz list, got %+v (%v)", players, err)
+	}
+	if got := actions(); got[1] != `leave {"name":"Bob","user_id":2} {"status":"kicked"}` {
+		t.Errorf("expected a single leave entry, got %q", got)
+	}
+
+	// A new member joining the chat does not enter the game by itself.
+	memberUpdate(false, User{ID: 3, FirstName: "Carol"}, "left", "member")
+	if participants, _ := env.storage.Queries.GetParticipants(ctx, 100); len(participants) != 1 {
+		t.Errorf("expected Carol not to be enrolled, got %+v", participants)
+	}
+
+	dormant := func() bool {
+		t.Helper()
+		var n int
+		if err := env.storage.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM dormant_chats WHERE chat_id = 100").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n == 1
+	}
+	botUser := User{ID: 99, IsBot: true, FirstName: "Roulette"}
+	memberUpdate(true, botUser, "member", "kicked")
+	if !dormant() {
+		t.Fatal("expected the chat to be dormant after the bot was removed")
+	}
+	sent := len(env.sender.messages)
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	if len(env.sender.messages) != sent || len(env.handler.todayWinnerIDs(ctx, 100, mainGameID)) != 0 {
+		t.Error("expected a dormant chat not to be rolled")
+	}
+	memberUpdate(true, botUser, "left", "administrator")
+	if dormant() {
+		t.Error("expected the chat to wake up when the bot was added back")
+	}
+	if got := actions(); got[0] != `dormant  {"status":"kicked"}` || got[1] != `awake  {"status":"administrator"}` {
+		t.Errorf("unexpected audit entries: %q", got)
+	}
+	env.handler.HandleUpdate(ctx, commandMsg(100, 1, "Alice", "/roll"))
+	if len(env.handler.todayWinnerIDs(ctx, 100, mainGameID)) != 1 {
+		t.Error("expected the chat to be rolled once awake")
+	}
+}
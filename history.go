@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"telegram-chat-bot/db"
+)
+
+const historyPageSize = 10
+
+func (h *Handler) handleHistory(ctx context.Context, msg *Message) error {
+	text, markup, err := h.renderHistory(ctx, msg.Chat.ID, extractArgs(msg), 0)
+	if err != nil {
+		return err
+	}
+	return h.bot.SendMessage(ctx, SendMessageRequest{
+		ChatID:      msg.Chat.ID,
+		Text:        text,
+		ParseMode:   "HTML",
+		ReplyMarkup: markup,
+	})
+}
+
+// handleHistoryPage edits a /history message in place to show another page.
+// data is "<page>:<period>" as set by historyButton.
+func (h *Handler) handleHistoryPage(ctx context.Context, msg *Message, data string) error {
+	pageArg, period, _ := strings.Cut(data, ":")
+	page, err := strconv.Atoi(pageArg)
+	if err != nil {
+		return fmt.Errorf("invalid history page %q", data)
+	}
+
+	text, markup, err := h.renderHistory(ctx, msg.Chat.ID, period, page)
+	if err != nil {
+		return err
+	}
+	return h.bot.EditMessageText(ctx, EditMessageTextRequest{
+		ChatID:      msg.Chat.ID,
+		MessageID:   msg.MessageID,
+		Text:        text,
+		ParseMode:   "HTML",
+		ReplyMarkup: markup,
+	})
+}
+
+// renderHistory renders one page of results for the period argument, which
+// is empty for all time. The keyboard is nil when everything fits on a page.
+func (h *Handler) renderHistory(ctx context.Context, chatID int64, arg string, page int) (string, *InlineKeyboardMarkup, error) {
+	from, to := "0000-01-01", "9999-12-31"
+	header := h.tr.Get(TrHistoryHeader)
+	if arg != "" {
+		period, ok := h.parseStatsPeriod(arg, h.todayFunc())
+		if !ok {
+			return h.tr.Get(TrHistoryUsage), nil, nil
+		}
+		from, to = period.from, period.to
+		header = h.tr.Getf(TrHistoryPeriodHeader, period.label)
+	}
+
+	count, err := h.storage.Queries.CountResults(ctx, db.CountResultsParams{
+		ChatID:   chatID,
+		GameID:   mainGameID,
+		FromDate: from,
+		ToDate:   to,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if count == 0 {
+		return h.tr.Get(TrHistoryEmpty), nil, nil
+	}
+
+	pages := int((count + historyPageSize - 1) / historyPageSize)
+	page = min(max(page, 0), pages-1)
+
+	results, err := h.storage.Queries.GetResultsPage(ctx, db.GetResultsPageParams{
+		ChatID:   chatID,
+		GameID:   mainGameID,
+		FromDate: from,
+		ToDate:   to,
+		Limit:    historyPageSize,
+		Offset:   int64(page * historyPageSize),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(header)
+	sb.WriteString("\n\n")
+	for _, r := range results {
+		name := h.tr.Getf(TrUnknownUser, r.UserID)
+		if r.WinnerName.Valid {
+			name = r.WinnerName.String
+		} else if r.FirstName.Valid {
+			name = r.FirstName.String
+		}
+		sb.WriteString(h.tr.Getf(TrHistoryLine, r.PlayedDate, html.EscapeString(name)))
+		sb.WriteString("\n")
+	}
+
+	if pages == 1 {
+		return sb.String(), nil, nil
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(h.tr.Getf(TrHistoryPage, page+1, pages))
+
+	var row []InlineKeyboardButton
+	if page > 0 {
+		row = append(row, historyButton(h.tr.Get(TrHistoryNewer), page-1, arg))
+	}
+	if page < pages-1 {
+		row = append(row, historyButton(h.tr.Get(TrHistoryOlder), page+1, arg))
+	}
+	return sb.String(), &InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{row}}, nil
+}
+
+func historyButton(text string, page int, period string) InlineKeyboardButton {
+	return InlineKeyboardButton{
+		Text:         text,
+		CallbackData: fmt.Sprintf("history:%d:%s", page, period),
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html"
+	"strings"
+
+	"telegram-chat-bot/db"
+)
+
+// Points are kept in the append-only ledger table. Each roll of the main
+// game pays its winners and a daily allowance to everyone it drew from,
+// both tied to the roll's result.
+
+const (
+	winPoints      = 10
+	dailyAllowance = 1
+	richestLimit   = 10
+)
+
+// Ledger entry reasons stored in ledger.reason.
+const (
+	LedgerWin       = "win"
+	LedgerAllowance = "allowance"
+	LedgerReversal  = "reversal"
+)
+
+// creditRoll pays out a main game roll. resultIDs are the results of the
+// winners in rank order; the allowance is tied to the first one.
+func creditRoll(ctx context.Context, q *db.Queries, chatID int64, winners, participants []db.GetParticipantsRow, resultIDs []int64) error {
+	for i, w := range winners {
+		if err := q.AddLedgerEntry(ctx, db.AddLedgerEntryParams{
+			ChatID:   chatID,
+			UserID:   w.UserID,
+			Amount:   winPoints,
+			Reason:   LedgerWin,
+			ResultID: sql.NullInt64{Int64: resultIDs[i], Valid: true},
+		}); err != nil {
+			return err
+		}
+	}
+	for _, p := range participants {
+		if err := q.AddLedgerEntry(ctx, db.AddLedgerEntryParams{
+			ChatID:   chatID,
+			UserID:   p.UserID,
+			Amount:   dailyAllowance,
+			Reason:   LedgerAllowance,
+			ResultID: sql.NullInt64{Int64: resultIDs[0], Valid: true},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveWin moves the win points of a corrected result from the replaced
+// winner to the new one.
+func moveWin(ctx context.Context, q *db.Queries, chatID, resultID, from, to int64) error {
+	if err := q.AddLedgerEntry(ctx, db.AddLedgerEntryParams{
+		ChatID:   chatID,
+		UserID:   from,
+		Amount:   -winPoints,
+		Reason:   LedgerReversal,
+		ResultID: sql.NullInt64{Int64: resultID, Valid: true},
+	}); err != nil {
+		return err
+	}
+	return q.AddLedgerEntry(ctx, db.AddLedgerEntryParams{
+		ChatID:   chatID,
+		UserID:   to,
+		Amount:   winPoints,
+		Reason:   LedgerWin,
+		ResultID: sql.NullInt64{Int64: resultID, Valid: true},
+	})
+}
+
+// handleBalance shows the sender's points, or another player's with
+// /balance @username.
+func (h *Handler) handleBalance(ctx context.Context, msg *Message) error {
+	chatID := msg.Chat.ID
+	userID, name := msg.From.ID, msg.From.FirstName
+
+	if arg := extractArgs(msg); strings.HasPrefix(arg, "@") {
+		username, ok := usernameArg(arg)
+		if !ok {
+			return h.send(ctx, chatID, h.tr.Get(TrBalanceUsage))
+		}
+		p, err := h.storage.Queries.GetParticipantByUsername(ctx, db.GetParticipantByUsernameParams{
+			ChatID:   chatID,
+			Username: username,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return h.send(ctx, chatID, h.tr.Getf(TrStatsUnknownPlayer, username))
+		}
+		if err != nil {
+			return err
+		}
+		userID, name = p.UserID, p.FirstName
+	}
+
+	balance, err := h.storage.Queries.GetBalance(ctx, db.GetBalanceParams{
+		ChatID: chatID,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+	return h.send(ctx, chatID, h.tr.Getf(TrBalance, html.EscapeString(name), balance))
+}
+
+func (h *Handler) handleRichest(ctx context.Context, msg *Message) error {
+	rows, err := h.storage.Queries.GetRichest(ctx, db.GetRichestParams{
+		ChatID: msg.Chat.ID,
+		Limit:  richestLimit,
+	})
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return h.send(ctx, msg.Chat.ID, h.tr.Get(TrRichestEmpty))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(h.tr.Get(TrRichestHeader))
+	sb.WriteString("\n\n")
+	for i, r := range rows {
+		name := h.leaderboardName(r.FirstName, false, r.Active)
+		sb.WriteString(h.tr.Getf(TrRichestLine, i+1, name, r.Balance))
+		sb.WriteString("\n")
+	}
+	return h.send(ctx, msg.Chat.ID, sb.String())
+}
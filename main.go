@@ -12,16 +12,30 @@ import (
 )
 
 func main() {
-	token := os.Getenv("TELEGRAM_BOT_TOKEN")
-	if token == "" {
-		log.Fatal("TELEGRAM_BOT_TOKEN environment variable is required")
-	}
-
 	dbPath := os.Getenv("DB_PATH")
 	if dbPath == "" {
 		dbPath = "bot.db"
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if len(os.Args) > 1 && os.Args[1] != "run" {
+		if err := runCLI(ctx, dbPath, os.Args[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	runBot(ctx, dbPath)
+}
+
+func runBot(ctx context.Context, dbPath string) {
+	token := os.Getenv("TELEGRAM_BOT_TOKEN")
+	if token == "" {
+		log.Fatal("TELEGRAM_BOT_TOKEN environment variable is required")
+	}
+
 	rollCmd := os.Getenv("ROLL_COMMAND")
 	if rollCmd == "" {
 		rollCmd = "roll"
@@ -60,9 +74,6 @@ func main() {
 		}
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
-
 	bot := NewBotClient(token)
 
 	me, err := bot.GetMe(ctx)
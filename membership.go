@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	"telegram-chat-bot/db"
+)
+
+// handleMembership keeps the games in step with the chat. Players who
+// leave or are banned are taken out of its games, and a chat the bot was
+// removed from is marked dormant until the bot is added back.
+func (h *Handler) handleMembership(ctx context.Context, update Update) {
+	u, self := update.ChatMember, false
+	if update.MyChatMember != nil {
+		u, self = update.MyChatMember, true
+	}
+	if len(h.chatIDs) > 0 {
+		if _, ok := h.chatIDs[u.Chat.ID]; !ok {
+			return
+		}
+	}
+
+	var err error
+	if self {
+		err = h.handleBotMembership(ctx, u)
+	} else {
+		err = h.handleMemberUpdate(ctx, u)
+	}
+	if err != nil {
+		log.Printf("Error handling membership update in chat %d: %v", u.Chat.ID, err)
+	}
+}
+
+// departed reports whether a membership no longer puts its user in the chat.
+func departed(m ChatMember) bool {
+	switch m.Status {
+	case "left", "kicked":
+		return true
+	case "restricted":
+		return !m.IsMember
+	}
+	return false
+}
+
+func (h *Handler) handleMemberUpdate(ctx context.Context, u *ChatMemberUpdated) error {
+	if !departed(u.NewChatMember) || departed(u.OldChatMember) {
+		return nil
+	}
+
+	user := u.NewChatMember.User
+	_, err := h.storage.RemoveMember(ctx, u.Chat.ID, user.ID,
+		newAudit(u.Chat.ID, u.From.ID, AuditLeave, auditUser(&user), auditState{"status": u.NewChatMember.Status}))
+	return err
+}
+
+// isDormant reports whether the bot was removed from a chat.
+func (h *Handler) isDormant(ctx context.Context, chatID int64) (bool, error) {
+	_, err := h.storage.Queries.GetDormantSince(ctx, chatID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h *Handler) handleBotMembership(ctx context.Context, u *ChatMemberUpdated) error {
+	var action string
+	switch {
+	case departed(u.NewChatMember) && !departed(u.OldChatMember):
+		action = AuditDormant
+	case departed(u.OldChatMember) && !departed(u.NewChatMember):
+		action = AuditAwake
+	default:
+		return nil
+	}
+	return h.storage.InTx(ctx, func(q *db.Queries) error {
+		var result sql.Result
+		var err error
+		if action == AuditDormant {
+			result, err = q.MarkChatDormant(ctx, u.Chat.ID)
+		} else {
+			result, err = q.WakeChat(ctx, u.Chat.ID)
+		}
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		return newAudit(u.Chat.ID, u.From.ID, action, nil, auditState{"status": u.NewChatMember.Status}).record(ctx, q)
+	})
+}
@@ -1,58 +1,713 @@
 -- name: AddParticipant :exec
 INSERT INTO participants (chat_id, user_id, first_name, username)
 VALUES (?, ?, ?, ?)
+ON CONFLICT (chat_id, user_id) DO UPDATE SET
+    first_name = excluded.first_name,
+    username = excluded.username,
+    rejoined_at = CASE WHEN participants.left_at IS NULL THEN participants.rejoined_at ELSE CURRENT_TIMESTAMP END,
+    left_at = NULL;
+
+-- name: MarkParticipantLeft :execresult
+UPDATE participants SET left_at = CURRENT_TIMESTAMP
+WHERE chat_id = ? AND user_id = ? AND left_at IS NULL;
+
+-- name: GetMembership :one
+SELECT joined_at, left_at, rejoined_at
+FROM participants
+WHERE chat_id = ? AND user_id = ?;
+
+-- name: AddMembershipEvent :exec
+INSERT INTO membership_events (chat_id, user_id, event)
+VALUES (?, ?, ?);
+
+-- name: GetMembershipTimeline :many
+SELECT e.user_id, m.first_name, e.event, e.created_at
+FROM membership_events e
+LEFT JOIN chat_members m ON m.chat_id = e.chat_id AND m.user_id = e.user_id
+WHERE e.chat_id = ?
+ORDER BY e.created_at, e.id;
+
+-- name: UpsertChatMember :exec
+INSERT INTO chat_members (chat_id, user_id, first_name, username, active)
+VALUES (?, ?, ?, ?, 1)
+ON CONFLICT (chat_id, user_id) DO UPDATE SET
+    first_name = excluded.first_name,
+    username = excluded.username,
+    active = 1;
+
+-- name: SaveChatMemberName :exec
+-- Records the name of someone who only plays named games, without making
+-- them an active member of the main game.
+INSERT INTO chat_members (chat_id, user_id, first_name, username, active)
+VALUES (?, ?, ?, ?, 0)
 ON CONFLICT (chat_id, user_id) DO UPDATE SET
     first_name = excluded.first_name,
     username = excluded.username;
 
--- name: RemoveParticipant :execresult
-DELETE FROM participants WHERE chat_id = ? AND user_id = ?;
+-- name: DeactivateChatMember :exec
+UPDATE chat_members SET active = 0
+WHERE chat_id = ? AND user_id = ?;
 
 -- name: GetParticipants :many
 SELECT user_id, first_name, username
 FROM participants
-WHERE chat_id = ?
+WHERE chat_id = ? AND left_at IS NULL
 ORDER BY joined_at;
 
--- name: GetTodayResult :one
-SELECT chat_id, user_id, played_date
+-- name: GetTodayResults :many
+SELECT chat_id, user_id, played_date, winner_name, loser_name
 FROM results
-WHERE chat_id = ? AND played_date = ?;
+WHERE chat_id = ? AND game_id = ? AND played_date = ?
+ORDER BY rank;
 
--- name: SaveResult :exec
-INSERT INTO results (chat_id, user_id, played_date)
-VALUES (?, ?, ?);
+-- name: SaveResult :one
+INSERT INTO results (chat_id, game_id, user_id, played_date, rank, set_id, seed, seed_hash, participant_ids, strategy, winner_name, loser_id, loser_name)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id;
+
+-- name: AddResultParticipant :exec
+INSERT INTO result_participants (result_id, position, user_id, first_name)
+VALUES (?, ?, ?, ?);
+
+-- name: GetResultParticipants :many
+SELECT rp.user_id, rp.first_name
+FROM result_participants rp
+JOIN results r ON r.id = rp.result_id
+WHERE r.chat_id = ? AND r.game_id = ? AND r.played_date = ?
+ORDER BY rp.position;
+
+-- name: GetResultProof :one
+SELECT user_id, played_date, seed, seed_hash, participant_ids, strategy, loser_id
+FROM results
+WHERE chat_id = ? AND game_id = ? AND played_date = ?
+ORDER BY rank
+LIMIT 1;
+
+-- name: GetResultWinners :many
+SELECT user_id FROM results
+WHERE chat_id = ? AND game_id = ? AND played_date = ?
+ORDER BY rank;
+
+-- name: GetDrawnWinners :many
+-- The winners of a day as drawn, with who holds each rank now.
+SELECT COALESCE(drawn_id, user_id) AS drawn_id, user_id FROM results
+WHERE chat_id = ? AND game_id = ? AND played_date = ?
+ORDER BY rank;
+
+-- name: GetTopResult :one
+-- Results from before strategies were drawn uniformly.
+SELECT id, user_id, winner_name, loser_id, COALESCE(strategy, 'uniform') AS strategy
+FROM results
+WHERE chat_id = ? AND game_id = ? AND played_date = ?
+ORDER BY rank
+LIMIT 1;
+
+-- name: SetResultWinner :exec
+-- Keeps the drawn winner in drawn_id, clearing it when they are set back.
+UPDATE results SET
+    drawn_id = NULLIF(COALESCE(drawn_id, user_id), sqlc.arg(user_id)),
+    user_id = sqlc.arg(user_id),
+    winner_name = sqlc.arg(winner_name)
+WHERE id = sqlc.arg(id);
+
+-- name: CountResultParticipants :one
+SELECT COUNT(*) FROM result_participants WHERE result_id = ?;
+
+-- name: GetLastPlayedDate :one
+SELECT played_date FROM results
+WHERE chat_id = ? AND game_id = ?
+ORDER BY played_date DESC
+LIMIT 1;
 
 -- name: GetStats :many
-SELECT p.user_id, p.first_name, p.username, COUNT(r.id) AS wins
-FROM participants p
-LEFT JOIN results r ON p.chat_id = r.chat_id AND p.user_id = r.user_id
-WHERE p.chat_id = ?
-GROUP BY p.user_id, p.first_name, p.username
+WITH players AS (
+    -- Own games count their own players as active, shared ones the chat's.
+    SELECT m.user_id, m.first_name, m.username,
+           CASE WHEN g.shared = 0 THEN gp.user_id IS NOT NULL ELSE m.active END AS active
+    FROM chat_members m
+    LEFT JOIN games g ON g.id = sqlc.arg(game_id)
+    LEFT JOIN game_participants gp ON gp.game_id = g.id AND gp.user_id = m.user_id
+    WHERE m.chat_id = sqlc.arg(chat_id)
+)
+SELECT p.user_id, p.first_name, p.username, p.active, COUNT(r.id) AS wins
+FROM players p
+LEFT JOIN results r ON r.chat_id = sqlc.arg(chat_id) AND r.user_id = p.user_id AND r.game_id = sqlc.arg(game_id)
+GROUP BY p.user_id, p.first_name, p.username, p.active
+HAVING p.active OR COUNT(r.id) > 0
 ORDER BY wins DESC, p.first_name;
 
--- name: GetStatsByYear :many
-SELECT p.user_id, p.first_name, p.username, COUNT(r.id) AS wins
-FROM participants p
-JOIN results r ON p.chat_id = r.chat_id AND p.user_id = r.user_id
-WHERE p.chat_id = ? AND r.played_date >= ? AND r.played_date < ?
-GROUP BY p.user_id, p.first_name, p.username
+-- name: GetStatsByRange :many
+WITH players AS (
+    -- Own games count their own players as active, shared ones the chat's.
+    SELECT m.user_id, m.first_name, m.username,
+           CASE WHEN g.shared = 0 THEN gp.user_id IS NOT NULL ELSE m.active END AS active
+    FROM chat_members m
+    LEFT JOIN games g ON g.id = sqlc.arg(game_id)
+    LEFT JOIN game_participants gp ON gp.game_id = g.id AND gp.user_id = m.user_id
+    WHERE m.chat_id = sqlc.arg(chat_id)
+)
+SELECT p.user_id, p.first_name, p.username, p.active, COUNT(r.id) AS wins
+FROM players p
+JOIN results r ON r.chat_id = sqlc.arg(chat_id) AND r.user_id = p.user_id
+WHERE r.game_id = sqlc.arg(game_id)
+  AND r.played_date >= sqlc.arg(from_date)
+  AND r.played_date < sqlc.arg(to_date)
+GROUP BY p.user_id, p.first_name, p.username, p.active
 ORDER BY wins DESC, p.first_name;
 
+-- name: GetLoserStats :many
+-- Losers of a game's dual rolls, most often first.
+WITH players AS (
+    -- Own games count their own players as active, shared ones the chat's.
+    SELECT m.user_id, m.first_name, m.username,
+           CASE WHEN g.shared = 0 THEN gp.user_id IS NOT NULL ELSE m.active END AS active
+    FROM chat_members m
+    LEFT JOIN games g ON g.id = sqlc.arg(game_id)
+    LEFT JOIN game_participants gp ON gp.game_id = g.id AND gp.user_id = m.user_id
+    WHERE m.chat_id = sqlc.arg(chat_id)
+)
+SELECT p.user_id, p.first_name, p.active, COUNT(r.id) AS losses
+FROM players p
+JOIN results r ON r.chat_id = sqlc.arg(chat_id) AND r.loser_id = p.user_id
+WHERE r.game_id = sqlc.arg(game_id)
+  AND r.played_date >= sqlc.arg(from_date)
+  AND r.played_date < sqlc.arg(to_date)
+GROUP BY p.user_id, p.first_name, p.active
+ORDER BY losses DESC, p.first_name;
+
+-- name: GetUserStats :one
+SELECT
+    p.first_name,
+    COUNT(r.id) AS total_wins,
+    COUNT(CASE WHEN r.played_date >= sqlc.arg(year_start) THEN 1 END) AS year_wins,
+    COUNT(CASE WHEN r.played_date >= sqlc.arg(month_start) THEN 1 END) AS month_wins,
+    CAST(julianday(sqlc.arg(today)) - julianday(date(p.joined_at)) + 1 AS INTEGER) AS days_enrolled,
+    CAST(COALESCE(MAX(r.played_date), '') AS TEXT) AS last_win
+FROM participants p
+LEFT JOIN results r ON r.chat_id = p.chat_id AND r.user_id = p.user_id AND r.game_id = sqlc.arg(game_id)
+WHERE p.chat_id = sqlc.arg(chat_id) AND p.user_id = sqlc.arg(user_id)
+GROUP BY p.user_id, p.first_name, p.joined_at;
+
+-- name: GetUserStreaks :one
+-- Streaks are runs of consecutive win dates; the current one ends on the
+-- chat's latest result.
+WITH wins AS (
+    SELECT played_date,
+           julianday(played_date) - ROW_NUMBER() OVER (ORDER BY played_date) AS run
+    FROM results
+    WHERE chat_id = sqlc.arg(chat_id) AND game_id = sqlc.arg(game_id) AND user_id = sqlc.arg(user_id)
+),
+runs AS (
+    SELECT COUNT(*) AS length, MAX(played_date) AS last_day
+    FROM wins
+    GROUP BY run
+)
+SELECT
+    CAST(COALESCE(MAX(length), 0) AS INTEGER) AS longest,
+    CAST(COALESCE(MAX(CASE
+        WHEN last_day = (
+            SELECT MAX(played_date) FROM results
+            WHERE chat_id = sqlc.arg(chat_id) AND game_id = sqlc.arg(game_id)
+        )
+        THEN length
+    END), 0) AS INTEGER) AS current
+FROM runs;
+
+-- name: GetUserRank :one
+SELECT CAST(COUNT(*) + 1 AS INTEGER) AS rank
+FROM (
+    SELECT user_id, COUNT(*) AS wins
+    FROM results
+    WHERE chat_id = sqlc.arg(chat_id) AND game_id = sqlc.arg(game_id)
+    GROUP BY user_id
+)
+WHERE wins > (
+    SELECT COUNT(*) FROM results
+    WHERE chat_id = sqlc.arg(chat_id) AND game_id = sqlc.arg(game_id) AND user_id = sqlc.arg(user_id)
+);
+
+-- name: GetUserWinDates :many
+SELECT played_date FROM results
+WHERE chat_id = ? AND game_id = ? AND user_id = ?
+ORDER BY played_date DESC;
+
+-- name: GetWinHistory :many
+-- The winners as drawn, so that strategies replay what each roll saw even
+-- after /setwinner.
+SELECT COALESCE(drawn_id, user_id) AS user_id, played_date FROM results
+WHERE chat_id = ? AND game_id = ?
+ORDER BY played_date DESC;
+
+-- name: GetWinDays :many
+SELECT user_id, played_date FROM results
+WHERE chat_id = ? AND game_id = ?
+ORDER BY played_date DESC;
+
+-- name: GetParticipantByUsername :one
+-- Current players come first should a former one have had the username.
+SELECT user_id, first_name, left_at
+FROM participants
+WHERE chat_id = ? AND username = ? COLLATE NOCASE
+ORDER BY left_at IS NOT NULL
+LIMIT 1;
+
 -- name: GetParticipantByID :one
 SELECT first_name, username
-FROM participants
+FROM chat_members
 WHERE chat_id = ? AND user_id = ?;
 
 -- name: DeleteTodayResult :execresult
-DELETE FROM results WHERE chat_id = ? AND played_date = ?;
+DELETE FROM results WHERE chat_id = ? AND game_id = ? AND played_date = ?;
+
+-- name: CreateReset :one
+INSERT INTO resets (chat_id, game_id, played_date, user_id)
+VALUES (?, ?, ?, ?)
+RETURNING id;
+
+-- name: CountResets :one
+SELECT COUNT(*) FROM resets WHERE chat_id = ? AND game_id = ? AND played_date = ?;
+
+-- name: GetLastReset :one
+SELECT id FROM resets
+WHERE chat_id = ? AND game_id = ? AND played_date = ? AND undone_at IS NULL
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: MarkResetUndone :exec
+UPDATE resets SET undone_at = CURRENT_TIMESTAMP, undone_by = ?
+WHERE id = ?;
+
+-- name: VoidResults :exec
+INSERT INTO voided_results (id, reset_id, chat_id, user_id, played_date, created_at, set_id, seed, seed_hash,
+    participant_ids, strategy, winner_name, game_id, loser_id, loser_name, rank, drawn_id)
+SELECT id, sqlc.arg(reset_id), chat_id, user_id, played_date, created_at, set_id, seed, seed_hash,
+    participant_ids, strategy, winner_name, game_id, loser_id, loser_name, rank, drawn_id
+FROM results
+WHERE chat_id = sqlc.arg(chat_id) AND game_id = sqlc.arg(game_id) AND played_date = sqlc.arg(played_date);
 
--- name: GetRandomMessageSetID :one
-SELECT id FROM message_sets ORDER BY RANDOM() LIMIT 1;
+-- name: RestoreResults :exec
+INSERT INTO results (id, chat_id, user_id, played_date, created_at, set_id, seed, seed_hash,
+    participant_ids, strategy, winner_name, game_id, loser_id, loser_name, rank, drawn_id)
+SELECT id, chat_id, user_id, played_date, created_at, set_id, seed, seed_hash,
+    participant_ids, strategy, winner_name, game_id, loser_id, loser_name, rank, drawn_id
+FROM voided_results
+WHERE reset_id = ?;
+
+-- name: DeleteVoidedResults :exec
+DELETE FROM voided_results WHERE reset_id = ?;
+
+-- name: ListCandidateMessageSets :many
+SELECT * FROM message_sets
+WHERE (chat_id = sqlc.arg(chat_id) AND game_id = sqlc.arg(game_id))
+   OR (chat_id IS NULL AND sqlc.arg(include_global) AND sqlc.arg(game_id) = 0)
+ORDER BY id;
+
+-- name: GetRecentSetIDs :many
+SELECT set_id FROM results
+WHERE chat_id = ? AND game_id = ? AND set_id IS NOT NULL
+ORDER BY played_date DESC
+LIMIT ?;
 
 -- name: GetSetMessages :many
-SELECT body FROM set_messages
+SELECT kind, body, caption FROM set_messages
 WHERE set_id = ? ORDER BY position;
 
 -- name: GetAllTranslations :many
 SELECT key, value FROM translations;
+
+-- name: ListChats :many
+SELECT c.chat_id, COUNT(p.user_id) AS participants, d.since AS dormant_since
+FROM (SELECT chat_id FROM participants UNION SELECT chat_id FROM dormant_chats) c
+LEFT JOIN participants p ON p.chat_id = c.chat_id AND p.left_at IS NULL
+LEFT JOIN dormant_chats d ON d.chat_id = c.chat_id
+GROUP BY c.chat_id, d.since
+ORDER BY c.chat_id;
+
+-- name: GetDormantSince :one
+SELECT since FROM dormant_chats WHERE chat_id = ?;
+
+-- name: MarkChatDormant :execresult
+INSERT OR IGNORE INTO dormant_chats (chat_id) VALUES (?);
+
+-- name: WakeChat :execresult
+DELETE FROM dormant_chats WHERE chat_id = ?;
+
+-- name: GetResultsPage :many
+SELECT r.played_date, r.user_id, r.winner_name, m.first_name
+FROM results r
+LEFT JOIN chat_members m ON m.chat_id = r.chat_id AND m.user_id = r.user_id
+WHERE r.chat_id = sqlc.arg(chat_id)
+  AND r.game_id = sqlc.arg(game_id)
+  AND r.played_date >= sqlc.arg(from_date)
+  AND r.played_date < sqlc.arg(to_date)
+ORDER BY r.played_date DESC, r.rank
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: CountResults :one
+SELECT COUNT(*) FROM results
+WHERE chat_id = sqlc.arg(chat_id)
+  AND game_id = sqlc.arg(game_id)
+  AND played_date >= sqlc.arg(from_date)
+  AND played_date < sqlc.arg(to_date);
+
+-- name: ListResults :many
+SELECT r.played_date, r.user_id, r.winner_name, p.first_name, COUNT(rp.user_id) AS players
+FROM results r
+LEFT JOIN participants p ON p.chat_id = r.chat_id AND p.user_id = r.user_id
+LEFT JOIN result_participants rp ON rp.result_id = r.id
+WHERE r.chat_id = ? AND r.game_id = ?
+GROUP BY r.id
+ORDER BY r.played_date DESC, r.rank
+LIMIT ?;
+
+-- name: CreateMessageSet :one
+INSERT INTO message_sets (chat_id, game_id)
+VALUES (?, ?)
+RETURNING id;
+
+-- name: GetMessageSet :one
+SELECT * FROM message_sets WHERE id = ?;
+
+-- name: SetMessageSetRules :exec
+UPDATE message_sets
+SET weight = ?, active_from = ?, active_to = ?, weekdays = ?
+WHERE id = ?;
+
+-- name: ListMessageSets :many
+SELECT ms.id, ms.chat_id, ms.weight, ms.active_from, ms.active_to, ms.weekdays,
+       COUNT(sm.id) AS lines, g.command
+FROM message_sets ms
+LEFT JOIN set_messages sm ON sm.set_id = ms.id
+LEFT JOIN games g ON g.id = ms.game_id
+WHERE ms.chat_id = ? OR ms.chat_id IS NULL
+GROUP BY ms.id
+ORDER BY ms.chat_id IS NULL, ms.id;
+
+-- name: DeleteMessageSet :exec
+DELETE FROM message_sets WHERE id = ?;
+
+-- name: DeleteSetMessages :exec
+DELETE FROM set_messages WHERE set_id = ?;
+
+-- name: GetNextSetPosition :one
+SELECT CAST(COALESCE(MAX(position), 0) + 1 AS INTEGER) AS position
+FROM set_messages
+WHERE set_id = ?;
+
+-- name: AddSetMessage :exec
+INSERT INTO set_messages (set_id, position, kind, body, caption)
+VALUES (?, ?, ?, ?, ?);
+
+-- name: GetTranslation :one
+SELECT value FROM translations WHERE key = ?;
+
+-- name: SetTranslation :exec
+INSERT INTO translations (key, value)
+VALUES (?, ?)
+ON CONFLICT (key) DO UPDATE SET
+    value = excluded.value;
+
+-- name: GetChatSettings :one
+SELECT * FROM chat_settings WHERE chat_id = ?;
+
+-- name: SetUseGlobalSets :exec
+INSERT INTO chat_settings (chat_id, use_global_sets)
+VALUES (?, ?)
+ON CONFLICT (chat_id) DO UPDATE SET
+    use_global_sets = excluded.use_global_sets;
+
+-- name: SetSetRepeatWindow :exec
+INSERT INTO chat_settings (chat_id, set_repeat_window)
+VALUES (?, ?)
+ON CONFLICT (chat_id) DO UPDATE SET
+    set_repeat_window = excluded.set_repeat_window;
+
+-- name: SetStrategy :exec
+INSERT INTO chat_settings (chat_id, strategy)
+VALUES (?, ?)
+ON CONFLICT (chat_id) DO UPDATE SET
+    strategy = excluded.strategy;
+
+-- name: SetCooldownDays :exec
+INSERT INTO chat_settings (chat_id, cooldown_days)
+VALUES (?, ?)
+ON CONFLICT (chat_id) DO UPDATE SET
+    cooldown_days = excluded.cooldown_days;
+
+-- name: SetDrawMode :exec
+INSERT INTO chat_settings (chat_id, draw_mode)
+VALUES (?, ?)
+ON CONFLICT (chat_id) DO UPDATE SET
+    draw_mode = excluded.draw_mode;
+
+-- name: SetResetLimit :exec
+INSERT INTO chat_settings (chat_id, reset_limit)
+VALUES (?, ?)
+ON CONFLICT (chat_id) DO UPDATE SET
+    reset_limit = excluded.reset_limit;
+
+-- name: GetRollCommitment :one
+SELECT seed, seed_hash FROM roll_commitments WHERE chat_id = ?;
+
+-- name: SetRollCommitment :exec
+INSERT INTO roll_commitments (chat_id, seed, seed_hash)
+VALUES (?, ?, ?)
+ON CONFLICT(chat_id) DO UPDATE SET seed = excluded.seed, seed_hash = excluded.seed_hash, created_at = CURRENT_TIMESTAMP;
+
+-- name: AddLedgerEntry :exec
+INSERT INTO ledger (chat_id, user_id, amount, reason, result_id, bet_id)
+VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: ReverseResultEntries :exec
+-- Cancels what the results of a game's day paid out, before they are
+-- voided or deleted. Bet entries are reversed per bet.
+INSERT INTO ledger (chat_id, user_id, amount, reason, result_id, bet_id, reset_id)
+SELECT chat_id, user_id, -SUM(amount), 'reversal', result_id, bet_id, sqlc.arg(reset_id)
+FROM ledger
+WHERE result_id IN (
+    SELECT id FROM results
+    WHERE results.chat_id = sqlc.arg(chat_id) AND results.game_id = sqlc.arg(game_id) AND results.played_date = sqlc.arg(played_date)
+)
+GROUP BY chat_id, user_id, result_id, bet_id
+HAVING SUM(amount) != 0;
+
+-- name: RestoreResetEntries :exec
+-- Cancels the reversals of a reset's wins and allowances when it is undone.
+-- Bets are settled again instead.
+INSERT INTO ledger (chat_id, user_id, amount, reason, result_id)
+SELECT chat_id, user_id, -amount, 'restore', result_id
+FROM ledger
+WHERE reset_id = ? AND bet_id IS NULL;
+
+-- name: GetBalance :one
+SELECT CAST(COALESCE(SUM(amount), 0) AS INTEGER) AS balance
+FROM ledger
+WHERE chat_id = ? AND user_id = ?;
+
+-- name: GetRichest :many
+SELECT l.user_id, m.first_name, m.active, CAST(SUM(l.amount) AS INTEGER) AS balance
+FROM ledger l
+JOIN chat_members m ON m.chat_id = l.chat_id AND m.user_id = l.user_id
+WHERE l.chat_id = ?
+GROUP BY l.user_id, m.first_name, m.active
+HAVING SUM(l.amount) != 0
+ORDER BY balance DESC, m.first_name
+LIMIT ?;
+
+-- name: ListLedger :many
+SELECT l.id, l.user_id, m.first_name, l.amount, l.reason, l.result_id, l.bet_id, l.created_at
+FROM ledger l
+LEFT JOIN chat_members m ON m.chat_id = l.chat_id AND m.user_id = l.user_id
+WHERE l.chat_id = ?
+ORDER BY l.id;
+
+-- name: PlaceBet :one
+-- Fails with no rows once the day's main game roll exists, so no bet can
+-- be placed after the result.
+INSERT INTO bets (chat_id, user_id, target_id, amount, bet_date)
+SELECT sqlc.arg(chat_id), sqlc.arg(user_id), sqlc.arg(target_id), sqlc.arg(amount), sqlc.arg(bet_date)
+WHERE NOT EXISTS (
+    SELECT 1 FROM results
+    WHERE chat_id = sqlc.arg(chat_id) AND game_id = 0 AND played_date = sqlc.arg(bet_date)
+)
+RETURNING id;
+
+-- name: GetUserBet :one
+SELECT id, target_id, amount FROM bets
+WHERE chat_id = ? AND user_id = ? AND bet_date = ?;
+
+-- name: ListOpenBets :many
+-- Open bets of the day and earlier, with the names of bettor and target.
+SELECT b.id, b.user_id, b.target_id, b.amount, b.bet_date,
+       COALESCE(u.first_name, '') AS user_name, COALESCE(t.first_name, '') AS target_name
+FROM bets b
+LEFT JOIN chat_members u ON u.chat_id = b.chat_id AND u.user_id = b.user_id
+LEFT JOIN chat_members t ON t.chat_id = b.chat_id AND t.user_id = b.target_id
+WHERE b.chat_id = ? AND b.status = 'open' AND b.bet_date <= ?
+ORDER BY b.id;
+
+-- name: SettleBet :exec
+UPDATE bets SET status = ?, payout = ?, result_id = ?
+WHERE id = ?;
+
+-- name: ListResultBets :many
+SELECT id, user_id, target_id, amount, status, payout
+FROM bets
+WHERE result_id = ?
+ORDER BY id;
+
+-- name: ReopenResultBets :exec
+-- Bets settled by a day's roll that is being deleted, so the next roll
+-- settles them again.
+UPDATE bets SET status = 'open', payout = 0, result_id = NULL
+WHERE result_id IN (
+    SELECT id FROM results
+    WHERE results.chat_id = ? AND results.game_id = ? AND results.played_date = ?
+);
+
+-- name: ExpireDuels :exec
+-- Closes the chat's pending duels that were not answered in time.
+UPDATE duels
+SET status = 'expired', resolved_at = CURRENT_TIMESTAMP
+WHERE chat_id = sqlc.arg(chat_id) AND status = 'pending'
+  AND strftime('%s', 'now') - strftime('%s', created_at) > sqlc.arg(timeout_seconds);
+
+-- name: CreateDuel :one
+-- Fails with no rows while the two players already have a pending duel.
+INSERT INTO duels (chat_id, challenger_id, opponent_id)
+SELECT sqlc.arg(chat_id), sqlc.arg(challenger_id), sqlc.arg(opponent_id)
+WHERE NOT EXISTS (
+    SELECT 1 FROM duels
+    WHERE chat_id = sqlc.arg(chat_id) AND status = 'pending'
+      AND challenger_id IN (sqlc.arg(challenger_id), sqlc.arg(opponent_id))
+      AND opponent_id IN (sqlc.arg(challenger_id), sqlc.arg(opponent_id))
+)
+RETURNING id;
+
+-- name: GetDuel :one
+SELECT id, chat_id, challenger_id, opponent_id, status, created_at
+FROM duels
+WHERE id = ?;
+
+-- name: ResolveDuel :execresult
+-- Only a pending duel can be resolved, so a second press of a button
+-- changes nothing.
+UPDATE duels
+SET status = ?, challenger_roll = ?, opponent_roll = ?, winner_id = ?, resolved_at = CURRENT_TIMESTAMP
+WHERE id = ? AND status = 'pending';
+
+-- name: GetDuelStats :many
+SELECT m.user_id, m.first_name, m.active,
+    CAST(SUM(d.winner_id = m.user_id) AS INTEGER) AS wins,
+    CAST(SUM(d.winner_id != m.user_id) AS INTEGER) AS losses
+FROM duels d
+JOIN chat_members m ON m.chat_id = d.chat_id AND m.user_id IN (d.challenger_id, d.opponent_id)
+WHERE d.chat_id = ? AND d.status = 'accepted'
+GROUP BY m.user_id, m.first_name, m.active
+ORDER BY wins DESC, losses, m.first_name
+LIMIT ?;
+
+-- name: AwardAchievement :execresult
+-- A badge revoked by a reset can be earned again.
+INSERT INTO achievements (chat_id, user_id, code, awarded_date)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (chat_id, user_id, code) DO UPDATE SET
+    awarded_date = excluded.awarded_date,
+    reset_id = NULL
+WHERE achievements.reset_id IS NOT NULL;
+
+-- name: RevokeResultAchievements :exec
+-- Badges are awarded on the day of the main game win that earned them.
+UPDATE achievements SET reset_id = sqlc.arg(reset_id)
+WHERE chat_id = sqlc.arg(chat_id) AND awarded_date = sqlc.arg(played_date) AND reset_id IS NULL
+  AND user_id IN (
+      SELECT user_id FROM results
+      WHERE chat_id = sqlc.arg(chat_id) AND game_id = 0 AND played_date = sqlc.arg(played_date)
+  );
+
+-- name: RestoreResetAchievements :exec
+UPDATE achievements SET reset_id = NULL WHERE reset_id = ?;
+
+-- name: ListAchievements :many
+SELECT a.user_id, m.first_name, a.code, a.awarded_date
+FROM achievements a
+JOIN chat_members m ON m.chat_id = a.chat_id AND m.user_id = a.user_id
+WHERE a.chat_id = ? AND a.reset_id IS NULL
+ORDER BY m.first_name, a.user_id, a.awarded_date, a.code;
+
+-- name: CreateGame :one
+INSERT INTO games (chat_id, command, title, shared)
+VALUES (?, ?, ?, ?)
+RETURNING id;
+
+-- name: GetGameByCommand :one
+SELECT * FROM games WHERE chat_id = ? AND command = ?;
+
+-- name: ListGames :many
+SELECT g.id, g.command, g.title, g.shared, COUNT(gp.user_id) AS players
+FROM games g
+LEFT JOIN game_participants gp ON gp.game_id = g.id
+WHERE g.chat_id = ?
+GROUP BY g.id
+ORDER BY g.command;
+
+-- name: DeleteGame :exec
+DELETE FROM games WHERE id = ?;
+
+-- name: AddGameParticipant :execresult
+INSERT OR IGNORE INTO game_participants (game_id, user_id)
+VALUES (?, ?);
+
+-- name: RemoveGameParticipant :execresult
+DELETE FROM game_participants WHERE game_id = ? AND user_id = ?;
+
+-- name: RemoveMemberGameParticipants :execresult
+-- Takes someone who left a chat off the own lists of its named games.
+DELETE FROM game_participants
+WHERE user_id = ? AND game_id IN (SELECT id FROM games WHERE chat_id = ?);
+
+-- name: DeleteGameParticipants :exec
+DELETE FROM game_participants WHERE game_id = ?;
+
+-- name: GetGameWinners :one
+SELECT winners FROM game_settings WHERE chat_id = ? AND game_id = ?;
+
+-- name: SetGameWinners :exec
+INSERT INTO game_settings (chat_id, game_id, winners)
+VALUES (?, ?, ?)
+ON CONFLICT (chat_id, game_id) DO UPDATE SET
+    winners = excluded.winners;
+
+-- name: DeleteGameSettings :exec
+DELETE FROM game_settings WHERE chat_id = ? AND game_id = ?;
+
+-- name: GetGameParticipants :many
+SELECT gp.user_id, m.first_name, m.username
+FROM game_participants gp
+JOIN games g ON g.id = gp.game_id
+JOIN chat_members m ON m.chat_id = g.chat_id AND m.user_id = gp.user_id
+WHERE gp.game_id = ?
+ORDER BY gp.joined_at;
+
+-- name: DeleteGameResultParticipants :exec
+DELETE FROM result_participants
+WHERE result_id IN (SELECT id FROM results WHERE chat_id = ? AND game_id = ?);
+
+-- name: DeleteGameVoidedResultParticipants :exec
+DELETE FROM result_participants
+WHERE result_id IN (SELECT id FROM voided_results WHERE chat_id = ? AND game_id = ?);
+
+-- name: DeleteGameVoidedResults :exec
+DELETE FROM voided_results WHERE chat_id = ? AND game_id = ?;
+
+-- name: DeleteGameResets :exec
+DELETE FROM resets WHERE chat_id = ? AND game_id = ?;
+
+-- name: DeleteGameResults :exec
+DELETE FROM results WHERE chat_id = ? AND game_id = ?;
+
+-- name: DeleteGameSetMessages :exec
+DELETE FROM set_messages
+WHERE set_id IN (SELECT id FROM message_sets WHERE chat_id = ? AND game_id = ?);
+
+-- name: DeleteGameSets :exec
+DELETE FROM message_sets WHERE chat_id = ? AND game_id = ?;
+
+-- name: AddAuditEntry :exec
+INSERT INTO audit_log (chat_id, actor_id, action, before, after)
+VALUES (?, ?, ?, ?, ?);
+
+-- name: ListRecentAudit :many
+SELECT a.id, a.actor_id, m.first_name, a.action, a.before, a.after, a.created_at
+FROM audit_log a
+LEFT JOIN chat_members m ON m.chat_id = a.chat_id AND m.user_id = a.actor_id
+WHERE a.chat_id = ?
+ORDER BY a.id DESC
+LIMIT ?;
+
+-- name: ListAudit :many
+SELECT a.id, a.actor_id, m.first_name, a.action, a.before, a.after, a.created_at
+FROM audit_log a
+LEFT JOIN chat_members m ON m.chat_id = a.chat_id AND m.user_id = a.actor_id
+WHERE a.chat_id = ?
+ORDER BY a.id;
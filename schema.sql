@@ -4,32 +4,285 @@ CREATE TABLE IF NOT EXISTS participants (
     first_name TEXT NOT NULL,
     username   TEXT NOT NULL DEFAULT '',
     joined_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- Leaving sets left_at; rejoining clears it and sets rejoined_at, so
+    -- joined_at always keeps the first join.
+    left_at     DATETIME,
+    rejoined_at DATETIME,
     PRIMARY KEY (chat_id, user_id)
 );
 
+-- Membership timeline: event is join, leave or rejoin.
+CREATE TABLE IF NOT EXISTS membership_events (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id    INTEGER NOT NULL,
+    user_id    INTEGER NOT NULL,
+    event      TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_membership_events_chat ON membership_events (chat_id, user_id);
+
+-- Everyone who ever took part in a chat's game. Rows outlive leaving so
+-- stats keep former players' names; active is cleared when they leave.
+CREATE TABLE IF NOT EXISTS chat_members (
+    chat_id    INTEGER NOT NULL,
+    user_id    INTEGER NOT NULL,
+    first_name TEXT NOT NULL,
+    username   TEXT NOT NULL DEFAULT '',
+    active     BOOLEAN NOT NULL DEFAULT 1,
+    PRIMARY KEY (chat_id, user_id)
+);
+
+-- Extra daily games of a chat, each rolled with its own command. The main
+-- game rolled with ROLL_COMMAND is game 0 and has no row. Shared games draw
+-- from the chat's participants, the others from game_participants.
+CREATE TABLE IF NOT EXISTS games (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id    INTEGER NOT NULL,
+    command    TEXT NOT NULL,
+    title      TEXT NOT NULL,
+    shared     BOOLEAN NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (chat_id, command)
+);
+
+-- Settings of a chat's game, including the main game 0. Games without a
+-- row use the defaults.
+CREATE TABLE IF NOT EXISTS game_settings (
+    chat_id INTEGER NOT NULL,
+    game_id INTEGER NOT NULL,
+    winners INTEGER NOT NULL DEFAULT 1,
+    PRIMARY KEY (chat_id, game_id)
+);
+
+CREATE TABLE IF NOT EXISTS game_participants (
+    game_id   INTEGER NOT NULL REFERENCES games(id),
+    user_id   INTEGER NOT NULL,
+    joined_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (game_id, user_id)
+);
+
 CREATE TABLE IF NOT EXISTS results (
     id          INTEGER PRIMARY KEY AUTOINCREMENT,
     chat_id     INTEGER NOT NULL,
     user_id     INTEGER NOT NULL,
     played_date TEXT NOT NULL,
-    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    set_id      INTEGER,
+    -- Provably fair draw: the revealed seed, the hash committed before the
+    -- roll, the participant user IDs in draw order and the strategy spec.
+    seed            TEXT,
+    seed_hash       TEXT,
+    participant_ids TEXT,
+    strategy        TEXT,
+    -- The winner's first name at the time of the draw.
+    winner_name     TEXT,
+    -- The game rolled, 0 for the chat's main game.
+    game_id         INTEGER NOT NULL DEFAULT 0,
+    -- Dual rolls also draw a loser, never the winner; NULL otherwise.
+    loser_id        INTEGER,
+    loser_name      TEXT,
+    -- Games with several winners a day store one row per winner, ranked
+    -- from 1. The rank 1 row carries the set, proof and loser of the roll.
+    rank            INTEGER NOT NULL DEFAULT 1,
+    -- The winner the roll drew when /setwinner replaced them; NULL otherwise.
+    drawn_id        INTEGER
 );
 
-CREATE UNIQUE INDEX IF NOT EXISTS idx_results_chat_date ON results (chat_id, played_date);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_results_chat_game_date_rank ON results (chat_id, game_id, played_date, rank);
 
+-- Every /reset: who reset which game's day and when. user_id is 0 for a
+-- reset made with the CLI. undone_at is set when /undo restores what the
+-- reset voided.
+CREATE TABLE IF NOT EXISTS resets (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id     INTEGER NOT NULL,
+    game_id     INTEGER NOT NULL,
+    played_date TEXT NOT NULL,
+    user_id     INTEGER NOT NULL,
+    reset_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    undone_at   DATETIME,
+    undone_by   INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_resets_chat_date ON resets (chat_id, played_date);
+
+-- Results voided by a reset. Rows keep their id from results, so their
+-- participants, ledger entries and bets still point at them, and /undo
+-- moves them back unchanged.
+CREATE TABLE IF NOT EXISTS voided_results (
+    id              INTEGER PRIMARY KEY,
+    reset_id        INTEGER NOT NULL,
+    chat_id         INTEGER NOT NULL,
+    user_id         INTEGER NOT NULL,
+    played_date     TEXT NOT NULL,
+    created_at      DATETIME NOT NULL,
+    set_id          INTEGER,
+    seed            TEXT,
+    seed_hash       TEXT,
+    participant_ids TEXT,
+    strategy        TEXT,
+    winner_name     TEXT,
+    game_id         INTEGER NOT NULL,
+    loser_id        INTEGER,
+    loser_name      TEXT,
+    rank            INTEGER NOT NULL,
+    drawn_id        INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_voided_results_reset ON voided_results (reset_id);
+
+-- Everyone a result was drawn from, in draw order, with their names at the
+-- time of the draw.
+CREATE TABLE IF NOT EXISTS result_participants (
+    result_id  INTEGER NOT NULL REFERENCES results(id),
+    position   INTEGER NOT NULL,
+    user_id    INTEGER NOT NULL,
+    first_name TEXT NOT NULL,
+    PRIMARY KEY (result_id, user_id)
+);
+
+-- active_from/active_to are MM-DD bounds that may wrap around the new year.
+-- weekdays is a bitmask with bit 0 for Sunday; 0 means every day.
 CREATE TABLE IF NOT EXISTS message_sets (
-    id INTEGER PRIMARY KEY AUTOINCREMENT
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id     INTEGER,
+    weight      INTEGER NOT NULL DEFAULT 1,
+    active_from TEXT,
+    active_to   TEXT,
+    weekdays    INTEGER NOT NULL DEFAULT 0,
+    -- Chat sets announce one game; global sets only the main game.
+    game_id     INTEGER NOT NULL DEFAULT 0
 );
 
+CREATE INDEX IF NOT EXISTS idx_message_sets_chat ON message_sets (chat_id);
+
 CREATE TABLE IF NOT EXISTS set_messages (
-    id      INTEGER PRIMARY KEY AUTOINCREMENT,
-    set_id  INTEGER NOT NULL REFERENCES message_sets(id),
+    id       INTEGER PRIMARY KEY AUTOINCREMENT,
+    set_id   INTEGER NOT NULL REFERENCES message_sets(id),
     position INTEGER NOT NULL,
-    body    TEXT NOT NULL,
+    kind     TEXT NOT NULL DEFAULT 'text',
+    body     TEXT NOT NULL,
+    caption  TEXT NOT NULL DEFAULT '',
     UNIQUE(set_id, position)
 );
 
+-- The seed for a chat's next roll, committed by its hash ahead of time.
+CREATE TABLE IF NOT EXISTS roll_commitments (
+    chat_id    INTEGER PRIMARY KEY,
+    seed       TEXT NOT NULL,
+    seed_hash  TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Badges earned by winners, each awarded at most once per player. reset_id
+-- is set while the result that earned a badge is voided by a reset.
+CREATE TABLE IF NOT EXISTS achievements (
+    chat_id      INTEGER NOT NULL,
+    user_id      INTEGER NOT NULL,
+    code         TEXT NOT NULL,
+    awarded_date TEXT NOT NULL,
+    created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    reset_id     INTEGER,
+    PRIMARY KEY (chat_id, user_id, code)
+);
+
+-- Points of the chat economy. Entries are only ever appended: balances are
+-- sums of them, and corrections are new entries. Each entry names what
+-- caused it: the result of a roll for wins and allowances, the bet for
+-- stakes, and both for payouts.
+CREATE TABLE IF NOT EXISTS ledger (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id    INTEGER NOT NULL,
+    user_id    INTEGER NOT NULL,
+    amount     INTEGER NOT NULL,
+    reason     TEXT NOT NULL,
+    result_id  INTEGER,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    bet_id     INTEGER,
+    -- Set on the reversals a reset made, which /undo cancels again.
+    reset_id   INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_chat_user ON ledger (chat_id, user_id);
+
+CREATE TRIGGER IF NOT EXISTS ledger_no_update BEFORE UPDATE ON ledger
+BEGIN
+    SELECT RAISE(ABORT, 'ledger entries cannot be changed');
+END;
+
+CREATE TRIGGER IF NOT EXISTS ledger_no_delete BEFORE DELETE ON ledger
+BEGIN
+    SELECT RAISE(ABORT, 'ledger entries cannot be deleted');
+END;
+
+-- Bets on the winner of a day's main game roll, one per player and day.
+-- The roll settles the open bets of its day in the same transaction, and
+-- refunds those of days without a roll.
+CREATE TABLE IF NOT EXISTS bets (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id    INTEGER NOT NULL,
+    user_id    INTEGER NOT NULL,
+    target_id  INTEGER NOT NULL,
+    amount     INTEGER NOT NULL,
+    bet_date   TEXT NOT NULL,
+    status     TEXT NOT NULL DEFAULT 'open',
+    payout     INTEGER NOT NULL DEFAULT 0,
+    result_id  INTEGER,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (chat_id, user_id, bet_date)
+);
+
+-- Duels between two players of a chat. A challenge stays pending until the
+-- opponent answers it or it times out; an accepted duel keeps both rolls
+-- and its winner.
+CREATE TABLE IF NOT EXISTS duels (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id         INTEGER NOT NULL,
+    challenger_id   INTEGER NOT NULL,
+    opponent_id     INTEGER NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'pending',
+    challenger_roll INTEGER,
+    opponent_roll   INTEGER,
+    winner_id       INTEGER,
+    created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at     DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_duels_chat ON duels (chat_id);
+
+-- Chats the bot was removed from. Their data is kept, and the row goes
+-- away when the bot is added back.
+CREATE TABLE IF NOT EXISTS dormant_chats (
+    chat_id INTEGER PRIMARY KEY,
+    since   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Who changed what in a chat and when. before and after hold JSON of the
+-- state the action changed, NULL when there was none.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id    INTEGER NOT NULL,
+    actor_id   INTEGER NOT NULL,
+    action     TEXT NOT NULL,
+    before     TEXT,
+    after      TEXT,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_chat ON audit_log (chat_id, id);
+
 CREATE TABLE IF NOT EXISTS translations (
     key   TEXT PRIMARY KEY,
     value TEXT NOT NULL
 );
+
+CREATE TABLE IF NOT EXISTS chat_settings (
+    chat_id           INTEGER PRIMARY KEY,
+    use_global_sets   BOOLEAN NOT NULL DEFAULT 1,
+    set_repeat_window INTEGER NOT NULL DEFAULT 3,
+    strategy          TEXT NOT NULL DEFAULT 'uniform',
+    cooldown_days     INTEGER NOT NULL DEFAULT 3,
+    draw_mode         TEXT NOT NULL DEFAULT 'single',
+    reset_limit       INTEGER NOT NULL DEFAULT 3
+);
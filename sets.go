@@ -0,0 +1,550 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"telegram-chat-bot/db"
+)
+
+// Chat-managed message sets. Sets with a chat_id belong to that chat and can
+// be edited from it; global sets (NULL chat_id) are managed via the CLI.
+
+func (h *Handler) handleNewSet(ctx context.Context, msg *Message) error {
+	if !h.canAdmin(msg.From.ID) {
+		return nil
+	}
+
+	chatID := msg.Chat.ID
+	command := extractArgs(msg)
+	g, ok, err := h.lookupGame(ctx, chatID, command)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return h.send(ctx, chatID, h.tr.Getf(TrGameUnknown, command))
+	}
+
+	var setID int64
+	err = h.storage.InTx(ctx, func(q *db.Queries) (err error) {
+		setID, err = q.CreateMessageSet(ctx, db.CreateMessageSetParams{
+			ChatID: sql.NullInt64{Int64: chatID, Valid: true},
+			GameID: g.ID,
+		})
+		if err != nil {
+			return err
+		}
+		return newAudit(chatID, msg.From.ID, AuditNewSet, nil, auditState{"set": setID, "game": g.Command}).record(ctx, q)
+	})
+	if err != nil {
+		return err
+	}
+
+	return h.send(ctx, chatID, h.tr.Getf(TrSetCreated, setID, setID))
+}
+
+func (h *Handler) handleAddLine(ctx context.Context, msg *Message) error {
+	if !h.canAdmin(msg.From.ID) {
+		return nil
+	}
+
+	chatID := msg.Chat.ID
+	rawID, body, _ := strings.Cut(extractArgs(msg), " ")
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return h.send(ctx, chatID, h.tr.Get(TrSetAddLineUsage))
+	}
+
+	if name := validateTemplate(body); name != "" {
+		return h.send(ctx, chatID, h.tr.Getf(TrSetUnknownPlaceholder, name, placeholderList()))
+	}
+
+	return h.appendStep(ctx, msg, rawID, StepText, body, "")
+}
+
+// handleAddMedia appends the sticker, GIF or photo of the replied-to message
+// to a set. Arguments after the set ID become the caption.
+func (h *Handler) handleAddMedia(ctx context.Context, msg *Message) error {
+	if !h.canAdmin(msg.From.ID) {
+		return nil
+	}
+
+	chatID := msg.Chat.ID
+	rawID, caption, _ := strings.Cut(extractArgs(msg), " ")
+	caption = strings.TrimSpace(caption)
+
+	kind, fileID := replyMedia(msg)
+	if kind == "" {
+		return h.send(ctx, chatID, h.tr.Get(TrSetAddMediaUsage))
+	}
+	if kind == StepSticker {
+		// Stickers cannot carry a caption.
+		caption = ""
+	}
+
+	if name := validateTemplate(caption); name != "" {
+		return h.send(ctx, chatID, h.tr.Getf(TrSetUnknownPlaceholder, name, placeholderList()))
+	}
+
+	return h.appendStep(ctx, msg, rawID, kind, fileID, caption)
+}
+
+func (h *Handler) handleAddDice(ctx context.Context, msg *Message) error {
+	if !h.canAdmin(msg.From.ID) {
+		return nil
+	}
+
+	rawID, emoji, _ := strings.Cut(extractArgs(msg), " ")
+	emoji = strings.TrimSpace(emoji)
+	if emoji == "" {
+		emoji = diceEmojis[0]
+	}
+
+	if !slices.Contains(diceEmojis, emoji) {
+		return h.send(ctx, msg.Chat.ID, h.tr.Getf(TrSetInvalidDice, strings.Join(diceEmojis, " ")))
+	}
+
+	return h.appendStep(ctx, msg, rawID, StepDice, emoji, "")
+}
+
+// replyMedia returns the step kind and file_id of the media in the message
+// being replied to, or empty strings if there is none.
+func replyMedia(msg *Message) (kind, fileID string) {
+	reply := msg.ReplyToMessage
+	switch {
+	case reply == nil:
+		return "", ""
+	case reply.Sticker != nil:
+		return StepSticker, reply.Sticker.FileID
+	case reply.Animation != nil:
+		return StepAnimation, reply.Animation.FileID
+	case len(reply.Photo) > 0:
+		// Sizes are listed smallest first.
+		return StepPhoto, reply.Photo[len(reply.Photo)-1].FileID
+	}
+	return "", ""
+}
+
+func (h *Handler) appendStep(ctx context.Context, msg *Message, rawID, kind, body, caption string) error {
+	set, ok, err := h.lookupSet(ctx, msg, rawID, false)
+	if err != nil || !ok {
+		return err
+	}
+
+	var position int64
+	err = h.storage.InTx(ctx, func(q *db.Queries) error {
+		var err error
+		position, err = q.GetNextSetPosition(ctx, set.ID)
+		if err != nil {
+			return err
+		}
+		if err := q.AddSetMessage(ctx, db.AddSetMessageParams{
+			SetID:    set.ID,
+			Position: position,
+			Kind:     kind,
+			Body:     body,
+			Caption:  caption,
+		}); err != nil {
+			return err
+		}
+		return newAudit(msg.Chat.ID, msg.From.ID, AuditAddStep, nil,
+			auditState{"set": set.ID, "position": position, "kind": kind, "body": body, "caption": caption}).record(ctx, q)
+	})
+	if err != nil {
+		return err
+	}
+
+	return h.send(ctx, msg.Chat.ID, h.tr.Getf(TrSetLineAdded, position, set.ID))
+}
+
+func (h *Handler) handleSets(ctx context.Context, msg *Message) error {
+	chatID := msg.Chat.ID
+
+	settings, err := h.chatSettings(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	sets, err := h.storage.Queries.ListMessageSets(ctx, sql.NullInt64{Int64: chatID, Valid: true})
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	listed := 0
+	for _, s := range sets {
+		if !s.ChatID.Valid {
+			if !settings.UseGlobalSets {
+				continue
+			}
+			sb.WriteString(h.tr.Getf(TrSetsGlobalLine, s.ID, s.Lines))
+		} else {
+			sb.WriteString(h.tr.Getf(TrSetsLine, s.ID, s.Lines))
+		}
+		if rules := formatSetRules(s.Weight, s.ActiveFrom, s.ActiveTo, s.Weekdays); rules != "" {
+			sb.WriteString(" · " + rules)
+		}
+		if s.Command.Valid {
+			sb.WriteString(" · /" + s.Command.String)
+		}
+		sb.WriteString("\n")
+		listed++
+	}
+
+	var text string
+	if listed == 0 {
+		text = h.tr.Get(TrSetsNone)
+	} else {
+		text = h.tr.Get(TrSetsHeader) + "\n\n" + sb.String()
+	}
+	if !settings.UseGlobalSets {
+		text += "\n" + h.tr.Get(TrSetsGlobalOff)
+	}
+	return h.send(ctx, chatID, text)
+}
+
+func (h *Handler) handlePreviewSet(ctx context.Context, msg *Message) error {
+	chatID := msg.Chat.ID
+
+	set, ok, err := h.lookupSet(ctx, msg, extractArgs(msg), true)
+	if err != nil || !ok {
+		return err
+	}
+
+	messages, err := h.storage.Queries.GetSetMessages(ctx, set.ID)
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return h.send(ctx, chatID, h.tr.Getf(TrSetEmpty, set.ID))
+	}
+
+	participants, err := h.storage.Queries.GetParticipants(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	self := db.GetParticipantsRow{
+		UserID:    msg.From.ID,
+		FirstName: msg.From.FirstName,
+		Username:  msg.From.Username,
+	}
+	vars, err := h.templateVars(ctx, chatID, set.GameID, []db.GetParticipantsRow{self}, nil, participants, h.todayFunc())
+	if err != nil {
+		return err
+	}
+
+	h.sendAnnouncement(ctx, chatID, messages, vars)
+	return nil
+}
+
+func (h *Handler) handleDeleteSet(ctx context.Context, msg *Message) error {
+	if !h.canAdmin(msg.From.ID) {
+		return nil
+	}
+
+	set, ok, err := h.lookupSet(ctx, msg, extractArgs(msg), false)
+	if err != nil || !ok {
+		return err
+	}
+
+	err = h.storage.InTx(ctx, func(q *db.Queries) error {
+		if err := q.DeleteSetMessages(ctx, set.ID); err != nil {
+			return err
+		}
+		if err := q.DeleteMessageSet(ctx, set.ID); err != nil {
+			return err
+		}
+		return newAudit(msg.Chat.ID, msg.From.ID, AuditDelSet, auditSetRules(set.ID, set.Weight, set.ActiveFrom, set.ActiveTo, set.Weekdays), nil).record(ctx, q)
+	})
+	if err != nil {
+		return err
+	}
+
+	return h.send(ctx, msg.Chat.ID, h.tr.Getf(TrSetDeleted, set.ID))
+}
+
+func (h *Handler) handleGlobalSets(ctx context.Context, msg *Message) error {
+	if !h.canAdmin(msg.From.ID) {
+		return nil
+	}
+
+	chatID := msg.Chat.ID
+
+	enabled, err := parseOnOff(strings.ToLower(extractArgs(msg)))
+	if err != nil {
+		return h.send(ctx, chatID, h.tr.Get(TrGlobalSetsUsage))
+	}
+
+	err = h.storage.InTx(ctx, func(q *db.Queries) error {
+		before, err := loadChatSettings(ctx, q, chatID)
+		if err != nil {
+			return err
+		}
+		if err := q.SetUseGlobalSets(ctx, db.SetUseGlobalSetsParams{
+			ChatID:        chatID,
+			UseGlobalSets: enabled,
+		}); err != nil {
+			return err
+		}
+		return newAudit(chatID, msg.From.ID, AuditSetting,
+			auditState{"globalsets": formatOnOff(before.UseGlobalSets)}, auditState{"globalsets": formatOnOff(enabled)}).record(ctx, q)
+	})
+	if err != nil {
+		return err
+	}
+
+	if enabled {
+		return h.send(ctx, chatID, h.tr.Get(TrGlobalSetsEnabled))
+	}
+	return h.send(ctx, chatID, h.tr.Get(TrGlobalSetsDisabled))
+}
+
+// handleSetRules changes when and how often a chat set is picked:
+// /setrules <id> [weight=N] [dates=MM-DD..MM-DD|any] [days=sat,sun|any].
+func (h *Handler) handleSetRules(ctx context.Context, msg *Message) error {
+	if !h.canAdmin(msg.From.ID) {
+		return nil
+	}
+
+	chatID := msg.Chat.ID
+	fields := strings.Fields(extractArgs(msg))
+	if len(fields) < 2 {
+		return h.send(ctx, chatID, h.tr.Get(TrSetRulesUsage))
+	}
+
+	set, ok, err := h.lookupSet(ctx, msg, fields[0], false)
+	if err != nil || !ok {
+		return err
+	}
+
+	rules, err := parseSetRules(set, fields[1:])
+	if err != nil {
+		return h.send(ctx, chatID, h.tr.Get(TrSetRulesUsage))
+	}
+	if err := h.storage.InTx(ctx, func(q *db.Queries) error {
+		if err := q.SetMessageSetRules(ctx, rules); err != nil {
+			return err
+		}
+		return newAudit(chatID, msg.From.ID, AuditSetRules,
+			auditSetRules(set.ID, set.Weight, set.ActiveFrom, set.ActiveTo, set.Weekdays),
+			auditSetRules(set.ID, rules.Weight, rules.ActiveFrom, rules.ActiveTo, rules.Weekdays)).record(ctx, q)
+	}); err != nil {
+		return err
+	}
+
+	desc := formatSetRules(rules.Weight, rules.ActiveFrom, rules.ActiveTo, rules.Weekdays)
+	if desc == "" {
+		desc = h.tr.Get(TrSetRulesDefault)
+	}
+	return h.send(ctx, chatID, h.tr.Getf(TrSetRulesUpdated, set.ID, desc))
+}
+
+// pickMessageSet draws the announcement set for a roll of a game on date.
+// Sets active on that date are weighted by their weight; sets used in the
+// game's last set_repeat_window rolls are skipped unless nothing else is
+// left. The result is invalid when the game has no usable set.
+func (h *Handler) pickMessageSet(ctx context.Context, settings db.ChatSetting, gameID int64, date string) (sql.NullInt64, error) {
+	chatID := settings.ChatID
+
+	sets, err := h.storage.Queries.ListCandidateMessageSets(ctx, db.ListCandidateMessageSetsParams{
+		ChatID:        sql.NullInt64{Int64: chatID, Valid: true},
+		GameID:        gameID,
+		IncludeGlobal: settings.UseGlobalSets,
+	})
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+
+	var active []db.MessageSet
+	for _, set := range sets {
+		if setActiveOn(set, day) {
+			active = append(active, set)
+		}
+	}
+
+	if settings.SetRepeatWindow > 0 && len(active) > 1 {
+		recent, err := h.storage.Queries.GetRecentSetIDs(ctx, db.GetRecentSetIDsParams{
+			ChatID: chatID,
+			GameID: gameID,
+			Limit:  settings.SetRepeatWindow,
+		})
+		if err != nil {
+			return sql.NullInt64{}, err
+		}
+
+		var fresh []db.MessageSet
+		for _, set := range active {
+			if !slices.Contains(recent, sql.NullInt64{Int64: set.ID, Valid: true}) {
+				fresh = append(fresh, set)
+			}
+		}
+		if len(fresh) > 0 {
+			active = fresh
+		}
+	}
+
+	if len(active) == 0 {
+		return sql.NullInt64{}, nil
+	}
+	return sql.NullInt64{Int64: weightedPick(h.rng, active).ID, Valid: true}, nil
+}
+
+func weightedPick(rng *rand.Rand, sets []db.MessageSet) db.MessageSet {
+	var total int64
+	for _, set := range sets {
+		total += set.Weight
+	}
+
+	n := rng.Int64N(total)
+	for _, set := range sets {
+		if n < set.Weight {
+			return set
+		}
+		n -= set.Weight
+	}
+	return sets[len(sets)-1]
+}
+
+// setActiveOn reports whether set may be picked on day. Sets with a zero
+// weight are disabled.
+func setActiveOn(set db.MessageSet, day time.Time) bool {
+	if set.Weight <= 0 {
+		return false
+	}
+
+	if set.Weekdays != 0 && set.Weekdays&(1<<day.Weekday()) == 0 {
+		return false
+	}
+
+	if set.ActiveFrom.Valid && set.ActiveTo.Valid {
+		md := day.Format("01-02")
+		from, to := set.ActiveFrom.String, set.ActiveTo.String
+		if from <= to {
+			return md >= from && md <= to
+		}
+		// The range wraps around the new year, e.g. 12-20..01-06.
+		return md >= from || md <= to
+	}
+	return true
+}
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// parseSetRules applies key=value rule arguments on top of the set's current
+// rules.
+func parseSetRules(set db.MessageSet, args []string) (db.SetMessageSetRulesParams, error) {
+	rules := db.SetMessageSetRulesParams{
+		Weight:     set.Weight,
+		ActiveFrom: set.ActiveFrom,
+		ActiveTo:   set.ActiveTo,
+		Weekdays:   set.Weekdays,
+		ID:         set.ID,
+	}
+
+	for _, arg := range args {
+		key, value, ok := strings.Cut(strings.ToLower(arg), "=")
+		if !ok {
+			return rules, fmt.Errorf("expected key=value, got %q", arg)
+		}
+
+		switch key {
+		case "weight":
+			w, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || w < 0 || w > 100 {
+				return rules, fmt.Errorf("invalid weight %q", value)
+			}
+			rules.Weight = w
+		case "dates":
+			if value == "any" {
+				rules.ActiveFrom, rules.ActiveTo = sql.NullString{}, sql.NullString{}
+				continue
+			}
+			from, to, ok := strings.Cut(value, "..")
+			if !ok || !validMonthDay(from) || !validMonthDay(to) {
+				return rules, fmt.Errorf("invalid dates %q", value)
+			}
+			rules.ActiveFrom = sql.NullString{String: from, Valid: true}
+			rules.ActiveTo = sql.NullString{String: to, Valid: true}
+		case "days":
+			if value == "any" {
+				rules.Weekdays = 0
+				continue
+			}
+			var mask int64
+			for name := range strings.SplitSeq(value, ",") {
+				i := slices.Index(weekdayNames, name[:min(3, len(name))])
+				if i < 0 {
+					return rules, fmt.Errorf("invalid weekday %q", name)
+				}
+				mask |= 1 << i
+			}
+			rules.Weekdays = mask
+		default:
+			return rules, fmt.Errorf("unknown rule %q", key)
+		}
+	}
+	return rules, nil
+}
+
+func validMonthDay(s string) bool {
+	_, err := time.Parse("01-02", s)
+	return err == nil && len(s) == 5
+}
+
+// formatSetRules describes non-default set rules, or returns "".
+func formatSetRules(weight int64, from, to sql.NullString, weekdays int64) string {
+	var parts []string
+	if weight != 1 {
+		parts = append(parts, "weight="+strconv.FormatInt(weight, 10))
+	}
+	if from.Valid && to.Valid {
+		parts = append(parts, "dates="+from.String+".."+to.String)
+	}
+	if weekdays != 0 {
+		var days []string
+		for i, name := range weekdayNames {
+			if weekdays&(1<<i) != 0 {
+				days = append(days, name)
+			}
+		}
+		parts = append(parts, "days="+strings.Join(days, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+// lookupSet resolves a set ID argument to a set visible in the message's
+// chat, replying with an error message and returning ok=false otherwise.
+// Global sets are only visible when allowGlobal is set.
+func (h *Handler) lookupSet(ctx context.Context, msg *Message, arg string, allowGlobal bool) (db.MessageSet, bool, error) {
+	chatID := msg.Chat.ID
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(arg, "#"), 10, 64)
+	if err != nil {
+		return db.MessageSet{}, false, h.send(ctx, chatID, h.tr.Getf(TrSetInvalidID, arg))
+	}
+
+	set, err := h.storage.Queries.GetMessageSet(ctx, id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return db.MessageSet{}, false, err
+	}
+
+	owned := err == nil && set.ChatID.Valid && set.ChatID.Int64 == chatID
+	global := err == nil && !set.ChatID.Valid && allowGlobal
+	if !owned && !global {
+		return db.MessageSet{}, false, h.send(ctx, chatID, h.tr.Getf(TrSetNotFound, id))
+	}
+	return set, true, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"telegram-chat-bot/db"
+)
+
+func TestSetActiveOn(t *testing.T) {
+	day := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	dates := func(from, to string) (sql.NullString, sql.NullString) {
+		return sql.NullString{String: from, Valid: true}, sql.NullString{String: to, Valid: true}
+	}
+
+	december := db.MessageSet{Weight: 1}
+	december.ActiveFrom, december.ActiveTo = dates("12-01", "12-31")
+	holidays := db.MessageSet{Weight: 1}
+	holidays.ActiveFrom, holidays.ActiveTo = dates("12-20", "01-06")
+	weekend := db.MessageSet{Weight: 1, Weekdays: 1<<time.Saturday | 1<<time.Sunday}
+
+	tests := []struct {
+		name string
+		set  db.MessageSet
+		day  string
+		want bool
+	}{
+		{"default", db.MessageSet{Weight: 1}, "2026-01-15", true},
+		{"zero weight", db.MessageSet{Weight: 0}, "2026-01-15", false},
+		{"in range", december, "2026-12-24", true},
+		{"out of range", december, "2026-01-15", false},
+		{"wrapping range before new year", holidays, "2026-12-28", true},
+		{"wrapping range after new year", holidays, "2026-01-03", true},
+		{"wrapping range outside", holidays, "2026-01-15", false},
+		{"weekend on saturday", weekend, "2026-01-17", true},
+		{"weekend on thursday", weekend, "2026-01-15", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := setActiveOn(tt.set, day(tt.day)); got != tt.want {
+				t.Errorf("setActiveOn() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSetRules(t *testing.T) {
+	base := db.MessageSet{ID: 7, Weight: 1}
+
+	rules, err := parseSetRules(base, []string{"weight=5", "dates=12-01..12-31", "days=Sat,sunday"})
+	if err != nil {
+		t.Fatalf("parseSetRules: %v", err)
+	}
+	if rules.ID != 7 || rules.Weight != 5 {
+		t.Errorf("unexpected rules: %+v", rules)
+	}
+	if got := formatSetRules(rules.Weight, rules.ActiveFrom, rules.ActiveTo, rules.Weekdays); got != "weight=5 dates=12-01..12-31 days=sun,sat" {
+		t.Errorf("formatSetRules() = %q", got)
+	}
+
+	cleared, err := parseSetRules(db.MessageSet{
+		Weight: 5, ActiveFrom: rules.ActiveFrom, ActiveTo: rules.ActiveTo, Weekdays: rules.Weekdays,
+	}, []string{"weight=1", "dates=any", "days=any"})
+	if err != nil {
+		t.Fatalf("parseSetRules: %v", err)
+	}
+	if got := formatSetRules(cleared.Weight, cleared.ActiveFrom, cleared.ActiveTo, cleared.Weekdays); got != "" {
+		t.Errorf("expected default rules, got %q", got)
+	}
+
+	for _, bad := range []string{"weight=-1", "weight=abc", "dates=12-01", "dates=13-01..12-31", "days=funday", "color=red", "weight"} {
+		if _, err := parseSetRules(base, []string{bad}); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestWeightedPick(t *testing.T) {
+	sets := []db.MessageSet{{ID: 1, Weight: 1}, {ID: 2, Weight: 0}, {ID: 3, Weight: 3}}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	counts := map[int64]int{}
+	for range 2000 {
+		counts[weightedPick(rng, sets).ID]++
+	}
+	if counts[2] != 0 {
+		t.Errorf("zero-weight set was picked %d times", counts[2])
+	}
+	if counts[3] < 2*counts[1] {
+		t.Errorf("expected weight 3 set to dominate, got %v", counts)
+	}
+}
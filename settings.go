@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"telegram-chat-bot/db"
+)
+
+// Defaults for chats without a chat_settings row. Keep in sync with the
+// column defaults in schema.sql.
+const (
+	defaultSetRepeatWindow = 3
+	defaultCooldownDays    = 3
+	defaultResetLimit      = 3
+)
+
+// Draw modes stored in chat_settings.draw_mode. Dual rolls draw a loser
+// along with the winner.
+const (
+	DrawSingle = "single"
+	DrawDual   = "dual"
+)
+
+var errInvalidSetting = errors.New("invalid setting value")
+
+// chatSettingDef describes a per-chat setting that can be shown with
+// /settings and changed with /set <name> <value>.
+type chatSettingDef struct {
+	name  string
+	show  func(s db.ChatSetting) string
+	apply func(ctx context.Context, q *db.Queries, chatID int64, value string) error
+}
+
+var chatSettingDefs = []chatSettingDef{
+	{
+		name: "globalsets",
+		show: func(s db.ChatSetting) string { return formatOnOff(s.UseGlobalSets) },
+		apply: func(ctx context.Context, q *db.Queries, chatID int64, value string) error {
+			on, err := parseOnOff(value)
+			if err != nil {
+				return err
+			}
+			return q.SetUseGlobalSets(ctx, db.SetUseGlobalSetsParams{ChatID: chatID, UseGlobalSets: on})
+		},
+	},
+	{
+		name: "setrepeat",
+		show: func(s db.ChatSetting) string { return strconv.FormatInt(s.SetRepeatWindow, 10) },
+		apply: func(ctx context.Context, q *db.Queries, chatID int64, value string) error {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 || n > 30 {
+				return errInvalidSetting
+			}
+			return q.SetSetRepeatWindow(ctx, db.SetSetRepeatWindowParams{ChatID: chatID, SetRepeatWindow: n})
+		},
+	},
+	{
+		name: "strategy",
+		show: func(s db.ChatSetting) string { return s.Strategy },
+		apply: func(ctx context.Context, q *db.Queries, chatID int64, value string) error {
+			if !slices.Contains(strategyNames, value) {
+				return errInvalidSetting
+			}
+			return q.SetStrategy(ctx, db.SetStrategyParams{ChatID: chatID, Strategy: value})
+		},
+	},
+	{
+		name: "cooldown",
+		show: func(s db.ChatSetting) string { return strconv.FormatInt(s.CooldownDays, 10) },
+		apply: func(ctx context.Context, q *db.Queries, chatID int64, value string) error {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 1 || n > 30 {
+				return errInvalidSetting
+			}
+			return q.SetCooldownDays(ctx, db.SetCooldownDaysParams{ChatID: chatID, CooldownDays: n})
+		},
+	},
+	{
+		name: "mode",
+		show: func(s db.ChatSetting) string { return s.DrawMode },
+		apply: func(ctx context.Context, q *db.Queries, chatID int64, value string) error {
+			if value != DrawSingle && value != DrawDual {
+				return errInvalidSetting
+			}
+			return q.SetDrawMode(ctx, db.SetDrawModeParams{ChatID: chatID, DrawMode: value})
+		},
+	},
+	{
+		name: "resets",
+		show: func(s db.ChatSetting) string { return strconv.FormatInt(s.ResetLimit, 10) },
+		apply: func(ctx context.Context, q *db.Queries, chatID int64, value string) error {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 1 || n > 20 {
+				return errInvalidSetting
+			}
+			return q.SetResetLimit(ctx, db.SetResetLimitParams{ChatID: chatID, ResetLimit: n})
+		},
+	},
+}
+
+func (h *Handler) chatSettings(ctx context.Context, chatID int64) (db.ChatSetting, error) {
+	return loadChatSettings(ctx, h.storage.Queries, chatID)
+}
+
+// loadChatSettings returns a chat's settings, or the defaults for a chat
+// that never changed them.
+func loadChatSettings(ctx context.Context, q *db.Queries, chatID int64) (db.ChatSetting, error) {
+	settings, err := q.GetChatSettings(ctx, chatID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.ChatSetting{
+			ChatID:          chatID,
+			UseGlobalSets:   true,
+			SetRepeatWindow: defaultSetRepeatWindow,
+			Strategy:        StrategyUniform,
+			CooldownDays:    defaultCooldownDays,
+			DrawMode:        DrawSingle,
+			ResetLimit:      defaultResetLimit,
+		}, nil
+	}
+	return settings, err
+}
+
+func (h *Handler) handleSettings(ctx context.Context, msg *Message) error {
+	settings, err := h.chatSettings(ctx, msg.Chat.ID)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(h.tr.Get(TrSettingsHeader))
+	sb.WriteString("\n\n")
+	for _, def := range chatSettingDefs {
+		sb.WriteString(h.tr.Getf(TrSettingsLine, def.name, def.show(settings)))
+		sb.WriteString("\n")
+	}
+
+	return h.send(ctx, msg.Chat.ID, sb.String())
+}
+
+func (h *Handler) handleSet(ctx context.Context, msg *Message) error {
+	if !h.canAdmin(msg.From.ID) {
+		return nil
+	}
+
+	chatID := msg.Chat.ID
+	name, value, _ := strings.Cut(extractArgs(msg), " ")
+	name = strings.ToLower(name)
+	value = strings.TrimSpace(value)
+
+	var def *chatSettingDef
+	for i := range chatSettingDefs {
+		if chatSettingDefs[i].name == name {
+			def = &chatSettingDefs[i]
+			break
+		}
+	}
+	if def == nil {
+		return h.send(ctx, chatID, h.tr.Getf(TrSettingUnknown, name))
+	}
+
+	var settings db.ChatSetting
+	err := h.storage.InTx(ctx, func(q *db.Queries) error {
+		before, err := loadChatSettings(ctx, q, chatID)
+		if err != nil {
+			return err
+		}
+		if err := def.apply(ctx, q, chatID, strings.ToLower(value)); err != nil {
+			return err
+		}
+		if settings, err = loadChatSettings(ctx, q, chatID); err != nil {
+			return err
+		}
+		return newAudit(chatID, msg.From.ID, AuditSetting,
+			auditState{name: def.show(before)}, auditState{name: def.show(settings)}).record(ctx, q)
+	})
+	if errors.Is(err, errInvalidSetting) {
+		return h.send(ctx, chatID, h.tr.Getf(TrSettingInvalid, name))
+	}
+	if err != nil {
+		return err
+	}
+	return h.send(ctx, chatID, h.tr.Getf(TrSettingUpdated, name, def.show(settings)))
+}
+
+func parseOnOff(value string) (bool, error) {
+	switch value {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return false, errInvalidSetting
+}
+
+func formatOnOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"telegram-chat-bot/db"
+)
+
+// statsPeriod is a half-open range of draw dates for a leaderboard, with
+// a short label and the header and empty-result messages that describe it.
+type statsPeriod struct {
+	from, to string
+	label    string
+	header   string
+	empty    string
+}
+
+// parseStatsPeriod understands a year, "month", "week", YYYY-MM and
+// inclusive YYYY-MM-DD..YYYY-MM-DD ranges, relative to today.
+func (h *Handler) parseStatsPeriod(arg, today string) (statsPeriod, bool) {
+	day, err := time.Parse("2006-01-02", today)
+	if err != nil {
+		return statsPeriod{}, false
+	}
+
+	switch arg {
+	case "month":
+		arg = today[:7]
+	case "week":
+		monday := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		sunday := monday.AddDate(0, 0, 6)
+		label := monday.Format("2006-01-02") + ".." + sunday.Format("2006-01-02")
+		return statsPeriod{
+			from:   monday.Format("2006-01-02"),
+			to:     sunday.AddDate(0, 0, 1).Format("2006-01-02"),
+			label:  label,
+			header: h.tr.Getf(TrStatsWeekHeader, monday.Format("2006-01-02")),
+			empty:  h.tr.Getf(TrStatsNoResultsPeriod, label),
+		}, true
+	}
+
+	if year, err := strconv.Atoi(arg); err == nil && len(arg) == 4 {
+		if year < 2000 || year > 2100 {
+			return statsPeriod{}, false
+		}
+		return statsPeriod{
+			from:   fmt.Sprintf("%d-01-01", year),
+			to:     fmt.Sprintf("%d-01-01", year+1),
+			label:  arg,
+			header: h.tr.Getf(TrStatsYearHeader, year),
+			empty:  h.tr.Getf(TrStatsNoResults, year),
+		}, true
+	}
+
+	if month, err := time.Parse("2006-01", arg); err == nil {
+		return statsPeriod{
+			from:   month.Format("2006-01-02"),
+			to:     month.AddDate(0, 1, 0).Format("2006-01-02"),
+			label:  arg,
+			header: h.tr.Getf(TrStatsMonthHeader, arg),
+			empty:  h.tr.Getf(TrStatsNoResultsPeriod, arg),
+		}, true
+	}
+
+	if first, last, ok := strings.Cut(arg, ".."); ok {
+		from, err1 := time.Parse("2006-01-02", first)
+		to, err2 := time.Parse("2006-01-02", last)
+		if err1 != nil || err2 != nil || to.Before(from) {
+			return statsPeriod{}, false
+		}
+		return statsPeriod{
+			from:   first,
+			to:     to.AddDate(0, 0, 1).Format("2006-01-02"),
+			label:  arg,
+			header: h.tr.Getf(TrStatsRangeHeader, first, last),
+			empty:  h.tr.Getf(TrStatsNoResultsPeriod, arg),
+		}, true
+	}
+
+	return statsPeriod{}, false
+}
+
+func (h *Handler) handleStatsPeriod(ctx context.Context, msg *Message, g db.Game, arg string) error {
+	period, ok := h.parseStatsPeriod(arg, h.todayFunc())
+	if !ok {
+		return h.send(ctx, msg.Chat.ID, h.tr.Getf(TrStatsInvalidPeriod, arg))
+	}
+
+	stats, err := h.storage.Queries.GetStatsByRange(ctx, db.GetStatsByRangeParams{
+		ChatID:   msg.Chat.ID,
+		GameID:   g.ID,
+		FromDate: period.from,
+		ToDate:   period.to,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(stats) == 0 {
+		return h.send(ctx, msg.Chat.ID, period.empty)
+	}
+
+	winnerIDs := h.todayWinnerIDs(ctx, msg.Chat.ID, g.ID)
+
+	var sb strings.Builder
+	sb.WriteString(titled(g, period.header))
+	sb.WriteString("\n\n")
+	for i, s := range stats {
+		name := h.leaderboardName(s.FirstName, slices.Contains(winnerIDs, s.UserID), s.Active)
+		sb.WriteString(h.tr.Getf(TrStatsLine, i+1, name, s.Wins))
+		sb.WriteString("\n")
+	}
+	if err := h.writeLoserStats(ctx, &sb, msg.Chat.ID, g.ID, period.from, period.to); err != nil {
+		return err
+	}
+
+	return h.send(ctx, msg.Chat.ID, sb.String())
+}
+
+// writeLoserStats appends the losers of a game's dual rolls in the date
+// range to a leaderboard. Chats that never rolled in dual mode get nothing.
+func (h *Handler) writeLoserStats(ctx context.Context, sb *strings.Builder, chatID, gameID int64, from, to string) error {
+	losers, err := h.storage.Queries.GetLoserStats(ctx, db.GetLoserStatsParams{
+		ChatID:   chatID,
+		GameID:   gameID,
+		FromDate: from,
+		ToDate:   to,
+	})
+	if err != nil || len(losers) == 0 {
+		return err
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(h.tr.Get(TrStatsLosersHeader))
+	sb.WriteString("\n\n")
+	for i, l := range losers {
+		name := h.leaderboardName(l.FirstName, false, l.Active)
+		sb.WriteString(h.tr.Getf(TrStatsLoserLine, i+1, name, l.Losses))
+		sb.WriteString("\n")
+	}
+	return nil
+}
+
+// leaderboardName decorates a player's name with today's crown and marks
+// players who left the game.
+func (h *Handler) leaderboardName(name string, todayWinner, active bool) string {
+	if todayWinner {
+		name = "👑 " + name
+	}
+	if !active {
+		name = h.tr.Getf(TrStatsFormerPlayer, name)
+	}
+	return name
+}
+
+func (h *Handler) handleMe(ctx context.Context, msg *Message) error {
+	return h.sendUserStats(ctx, msg.Chat.ID, msg.From.ID, h.tr.Get(TrLeaveNotInGame))
+}
+
+// handleStatsUser shows the personal stats of the participant with the
+// given @username.
+func (h *Handler) handleStatsUser(ctx context.Context, msg *Message, arg string) error {
+	username := strings.TrimPrefix(arg, "@")
+	p, err := h.storage.Queries.GetParticipantByUsername(ctx, db.GetParticipantByUsernameParams{
+		ChatID:   msg.Chat.ID,
+		Username: username,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return h.send(ctx, msg.Chat.ID, h.tr.Getf(TrStatsUnknownPlayer, username))
+	}
+	if err != nil {
+		return err
+	}
+	return h.sendUserStats(ctx, msg.Chat.ID, p.UserID, h.tr.Getf(TrStatsUnknownPlayer, username))
+}
+
+// sendUserStats sends the personal stats of userID, or notFound if they are
+// not a participant.
+func (h *Handler) sendUserStats(ctx context.Context, chatID, userID int64, notFound string) error {
+	today := h.todayFunc()
+
+	stats, err := h.storage.Queries.GetUserStats(ctx, db.GetUserStatsParams{
+		YearStart:  today[:4] + "-01-01",
+		MonthStart: today[:7] + "-01",
+		Today:      today,
+		GameID:     mainGameID,
+		ChatID:     chatID,
+		UserID:     userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return h.send(ctx, chatID, notFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	streaks, err := h.storage.Queries.GetUserStreaks(ctx, db.GetUserStreaksParams{
+		ChatID: chatID,
+		GameID: mainGameID,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	rank, err := h.storage.Queries.GetUserRank(ctx, db.GetUserRankParams{
+		ChatID: chatID,
+		GameID: mainGameID,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Participants who joined after today's draw still count one day.
+	days := max(stats.DaysEnrolled, 1)
+	rate := 100 * float64(stats.TotalWins) / float64(days)
+
+	lastWin := stats.LastWin
+	if lastWin == "" {
+		lastWin = h.tr.Get(TrStatsNever)
+	}
+
+	text := h.tr.Getf(TrStatsPersonal,
+		mentionTag(userID, stats.FirstName),
+		stats.TotalWins, stats.YearWins, stats.MonthWins,
+		rate, days,
+		streaks.Current, streaks.Longest,
+		lastWin,
+		rank,
+	)
+	return h.send(ctx, chatID, text)
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	_ "embed"
+	"errors"
 	"fmt"
+	"slices"
 
 	"telegram-chat-bot/db"
 
@@ -14,6 +16,75 @@ import (
 //go:embed schema.sql
 var ddl string
 
+// columnMigrations lists columns added to tables after their first release.
+// CREATE TABLE IF NOT EXISTS leaves existing tables untouched, so these are
+// added with ALTER TABLE before the schema is applied.
+var columnMigrations = []struct {
+	table, column, definition string
+}{
+	{"message_sets", "chat_id", "INTEGER"},
+	{"set_messages", "kind", "TEXT NOT NULL DEFAULT 'text'"},
+	{"set_messages", "caption", "TEXT NOT NULL DEFAULT ''"},
+	{"results", "set_id", "INTEGER"},
+	{"message_sets", "weight", "INTEGER NOT NULL DEFAULT 1"},
+	{"message_sets", "active_from", "TEXT"},
+	{"message_sets", "active_to", "TEXT"},
+	{"message_sets", "weekdays", "INTEGER NOT NULL DEFAULT 0"},
+	{"chat_settings", "set_repeat_window", "INTEGER NOT NULL DEFAULT 3"},
+	{"chat_settings", "strategy", "TEXT NOT NULL DEFAULT 'uniform'"},
+	{"chat_settings", "cooldown_days", "INTEGER NOT NULL DEFAULT 3"},
+	{"results", "seed", "TEXT"},
+	{"results", "seed_hash", "TEXT"},
+	{"results", "participant_ids", "TEXT"},
+	{"results", "strategy", "TEXT"},
+	{"results", "winner_name", "TEXT"},
+	{"participants", "left_at", "DATETIME"},
+	{"participants", "rejoined_at", "DATETIME"},
+	{"results", "game_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"message_sets", "game_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"results", "loser_id", "INTEGER"},
+	{"results", "loser_name", "TEXT"},
+	{"chat_settings", "draw_mode", "TEXT NOT NULL DEFAULT 'single'"},
+	{"results", "rank", "INTEGER NOT NULL DEFAULT 1"},
+	{"ledger", "bet_id", "INTEGER"},
+	{"ledger", "reset_id", "INTEGER"},
+	{"chat_settings", "reset_limit", "INTEGER NOT NULL DEFAULT 3"},
+	{"results", "drawn_id", "INTEGER"},
+	{"voided_results", "drawn_id", "INTEGER"},
+	{"achievements", "reset_id", "INTEGER"},
+}
+
+// Membership events stored in membership_events.event.
+const (
+	MembershipJoin   = "join"
+	MembershipLeave  = "leave"
+	MembershipRejoin = "rejoin"
+)
+
+// dataMigrations run after the schema on every start and must be
+// idempotent.
+var dataMigrations = []string{
+	// Members predating chat_members: current participants, and former
+	// winners whose name was recorded with their result.
+	`INSERT OR IGNORE INTO chat_members (chat_id, user_id, first_name, username, active)
+	 SELECT chat_id, user_id, first_name, username, left_at IS NULL FROM participants`,
+	`INSERT OR IGNORE INTO chat_members (chat_id, user_id, first_name, active)
+	 SELECT chat_id, user_id, MAX(winner_name), 0 FROM results
+	 WHERE winner_name IS NOT NULL
+	 GROUP BY chat_id, user_id`,
+	// Participants who joined before the membership timeline existed.
+	`INSERT INTO membership_events (chat_id, user_id, event, created_at)
+	 SELECT p.chat_id, p.user_id, 'join', p.joined_at FROM participants p
+	 WHERE NOT EXISTS (
+	     SELECT 1 FROM membership_events e
+	     WHERE e.chat_id = p.chat_id AND e.user_id = p.user_id
+	 )`,
+	// Replaced by idx_results_chat_game_date when games were added.
+	`DROP INDEX IF EXISTS idx_results_chat_date`,
+	// Replaced by idx_results_chat_game_date_rank for several winners a day.
+	`DROP INDEX IF EXISTS idx_results_chat_game_date`,
+}
+
 type Storage struct {
 	db      *sql.DB
 	Queries *db.Queries
@@ -30,17 +101,489 @@ func NewStorage(ctx context.Context, dbPath string) (*Storage, error) {
 		return nil, fmt.Errorf("set WAL mode: %w", err)
 	}
 
+	if err := migrateColumns(ctx, sqlDB); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("migrate columns: %w", err)
+	}
+
 	if _, err := sqlDB.ExecContext(ctx, ddl); err != nil {
 		sqlDB.Close()
 		return nil, fmt.Errorf("create tables: %w", err)
 	}
 
+	for _, stmt := range dataMigrations {
+		if _, err := sqlDB.ExecContext(ctx, stmt); err != nil {
+			sqlDB.Close()
+			return nil, fmt.Errorf("migrate data: %w", err)
+		}
+	}
+
 	return &Storage{
 		db:      sqlDB,
 		Queries: db.New(sqlDB),
 	}, nil
 }
 
+func migrateColumns(ctx context.Context, sqlDB *sql.DB) error {
+	for _, m := range columnMigrations {
+		rows, err := sqlDB.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", m.table)
+		if err != nil {
+			return err
+		}
+		var columns []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return err
+			}
+			columns = append(columns, name)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// A missing table is created from the schema with the column included.
+		if len(columns) == 0 || slices.Contains(columns, m.column) {
+			continue
+		}
+
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)
+		if _, err := sqlDB.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("add %s.%s: %w", m.table, m.column, err)
+		}
+	}
+	return nil
+}
+
 func (s *Storage) Close() error {
 	return s.db.Close()
 }
+
+// JoinGame adds a participant to a chat's game, or brings back one who
+// left, and records them as an active member and the audit entry.
+func (s *Storage) JoinGame(ctx context.Context, p db.AddParticipantParams, audit *auditEntry) error {
+	return s.InTx(ctx, func(q *db.Queries) error {
+		membership, err := q.GetMembership(ctx, db.GetMembershipParams{
+			ChatID: p.ChatID,
+			UserID: p.UserID,
+		})
+		event := ""
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			event = MembershipJoin
+		case err != nil:
+			return err
+		case membership.LeftAt.Valid:
+			event = MembershipRejoin
+		}
+
+		if err := q.AddParticipant(ctx, p); err != nil {
+			return err
+		}
+		if event != "" {
+			if err := q.AddMembershipEvent(ctx, db.AddMembershipEventParams{
+				ChatID: p.ChatID,
+				UserID: p.UserID,
+				Event:  event,
+			}); err != nil {
+				return err
+			}
+		}
+		if err := q.UpsertChatMember(ctx, db.UpsertChatMemberParams{
+			ChatID:    p.ChatID,
+			UserID:    p.UserID,
+			FirstName: p.FirstName,
+			Username:  p.Username,
+		}); err != nil {
+			return err
+		}
+		return audit.record(ctx, q)
+	})
+}
+
+// LeaveGame marks a participant as having left a chat's game, keeping
+// their row and history, and reports whether they were playing. The audit
+// entry is recorded only if they were.
+func (s *Storage) LeaveGame(ctx context.Context, chatID, userID int64, audit *auditEntry) (bool, error) {
+	var left bool
+	err := s.InTx(ctx, func(q *db.Queries) (err error) {
+		left, err = leaveGame(ctx, q, chatID, userID)
+		if err != nil || !left {
+			return err
+		}
+		return audit.record(ctx, q)
+	})
+	return left, err
+}
+
+// RemoveMember takes someone who left the chat out of all its games: the
+// main game as with LeaveGame, and the own lists of named games. It
+// reports whether they were in any, and only then records the audit entry.
+func (s *Storage) RemoveMember(ctx context.Context, chatID, userID int64, audit *auditEntry) (bool, error) {
+	var removed bool
+	err := s.InTx(ctx, func(q *db.Queries) error {
+		left, err := leaveGame(ctx, q, chatID, userID)
+		if err != nil {
+			return err
+		}
+		result, err := q.RemoveMemberGameParticipants(ctx, db.RemoveMemberGameParticipantsParams{
+			UserID: userID,
+			ChatID: chatID,
+		})
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		removed = left || rows > 0
+		if err != nil || !removed {
+			return err
+		}
+		return audit.record(ctx, q)
+	})
+	return removed, err
+}
+
+func leaveGame(ctx context.Context, q *db.Queries, chatID, userID int64) (bool, error) {
+	result, err := q.MarkParticipantLeft(ctx, db.MarkParticipantLeftParams{
+		ChatID: chatID,
+		UserID: userID,
+	})
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil || rows == 0 {
+		return false, err
+	}
+	if err := q.AddMembershipEvent(ctx, db.AddMembershipEventParams{
+		ChatID: chatID,
+		UserID: userID,
+		Event:  MembershipLeave,
+	}); err != nil {
+		return false, err
+	}
+	return true, q.DeactivateChatMember(ctx, db.DeactivateChatMemberParams{
+		ChatID: chatID,
+		UserID: userID,
+	})
+}
+
+// JoinNamedGame adds user to the own participant list of a named game and
+// reports whether they were not on it yet, and only then records the audit
+// entry.
+func (s *Storage) JoinNamedGame(ctx context.Context, g db.Game, user *User, audit *auditEntry) (bool, error) {
+	var joined bool
+	err := s.InTx(ctx, func(q *db.Queries) error {
+		if err := q.SaveChatMemberName(ctx, db.SaveChatMemberNameParams{
+			ChatID:    g.ChatID,
+			UserID:    user.ID,
+			FirstName: user.FirstName,
+			Username:  user.Username,
+		}); err != nil {
+			return err
+		}
+		result, err := q.AddGameParticipant(ctx, db.AddGameParticipantParams{
+			GameID: g.ID,
+			UserID: user.ID,
+		})
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		joined = rows > 0
+		if err != nil || !joined {
+			return err
+		}
+		return audit.record(ctx, q)
+	})
+	return joined, err
+}
+
+// DeleteGame removes a named game with its participant list, results,
+// resets and message sets, and records the audit entry.
+func (s *Storage) DeleteGame(ctx context.Context, g db.Game, audit *auditEntry) error {
+	chatID := sql.NullInt64{Int64: g.ChatID, Valid: true}
+	return s.InTx(ctx, func(q *db.Queries) error {
+		if err := q.DeleteGameResultParticipants(ctx, db.DeleteGameResultParticipantsParams{
+			ChatID: g.ChatID,
+			GameID: g.ID,
+		}); err != nil {
+			return err
+		}
+		if err := q.DeleteGameResults(ctx, db.DeleteGameResultsParams{
+			ChatID: g.ChatID,
+			GameID: g.ID,
+		}); err != nil {
+			return err
+		}
+		if err := q.DeleteGameVoidedResultParticipants(ctx, db.DeleteGameVoidedResultParticipantsParams{
+			ChatID: g.ChatID,
+			GameID: g.ID,
+		}); err != nil {
+			return err
+		}
+		if err := q.DeleteGameVoidedResults(ctx, db.DeleteGameVoidedResultsParams{
+			ChatID: g.ChatID,
+			GameID: g.ID,
+		}); err != nil {
+			return err
+		}
+		if err := q.DeleteGameResets(ctx, db.DeleteGameResetsParams{
+			ChatID: g.ChatID,
+			GameID: g.ID,
+		}); err != nil {
+			return err
+		}
+		if err := q.DeleteGameSetMessages(ctx, db.DeleteGameSetMessagesParams{
+			ChatID: chatID,
+			GameID: g.ID,
+		}); err != nil {
+			return err
+		}
+		if err := q.DeleteGameSets(ctx, db.DeleteGameSetsParams{
+			ChatID: chatID,
+			GameID: g.ID,
+		}); err != nil {
+			return err
+		}
+		if err := q.DeleteGameParticipants(ctx, g.ID); err != nil {
+			return err
+		}
+		if err := q.DeleteGameSettings(ctx, db.DeleteGameSettingsParams{
+			ChatID: g.ChatID,
+			GameID: g.ID,
+		}); err != nil {
+			return err
+		}
+		if err := q.DeleteGame(ctx, g.ID); err != nil {
+			return err
+		}
+		return audit.record(ctx, q)
+	})
+}
+
+var (
+	errResetLimit  = errors.New("reset limit reached")
+	errRolledAgain = errors.New("rolled again since the reset")
+)
+
+// VoidResult resets a game's day on behalf of userID and reports whether
+// it had a result. The results move to voided_results under a new resets
+// row, the points they paid out are reversed in the ledger, the badges
+// they earned are revoked and the bets they settled are open again. At
+// most limit resets a day are allowed per game. The audit entry, made with
+// auditDay, is recorded with the voided winners as its before state.
+func (s *Storage) VoidResult(ctx context.Context, chatID, gameID int64, date string, userID, limit int64, audit *auditEntry) (bool, error) {
+	var voided bool
+	err := s.InTx(ctx, func(q *db.Queries) error {
+		results, err := q.GetTodayResults(ctx, db.GetTodayResultsParams{
+			ChatID:     chatID,
+			GameID:     gameID,
+			PlayedDate: date,
+		})
+		if err != nil || len(results) == 0 {
+			return err
+		}
+		voided = true
+
+		count, err := q.CountResets(ctx, db.CountResetsParams{ChatID: chatID, GameID: gameID, PlayedDate: date})
+		if err != nil {
+			return err
+		}
+		if count >= limit {
+			return errResetLimit
+		}
+
+		resetID, err := q.CreateReset(ctx, db.CreateResetParams{
+			ChatID:     chatID,
+			GameID:     gameID,
+			PlayedDate: date,
+			UserID:     userID,
+		})
+		if err != nil {
+			return err
+		}
+		if err := q.ReverseResultEntries(ctx, db.ReverseResultEntriesParams{
+			ResetID:    sql.NullInt64{Int64: resetID, Valid: true},
+			ChatID:     chatID,
+			GameID:     gameID,
+			PlayedDate: date,
+		}); err != nil {
+			return err
+		}
+		if err := q.ReopenResultBets(ctx, db.ReopenResultBetsParams{
+			ChatID:     chatID,
+			GameID:     gameID,
+			PlayedDate: date,
+		}); err != nil {
+			return err
+		}
+		if gameID == mainGameID {
+			if err := q.RevokeResultAchievements(ctx, db.RevokeResultAchievementsParams{
+				ResetID:    sql.NullInt64{Int64: resetID, Valid: true},
+				ChatID:     chatID,
+				PlayedDate: date,
+			}); err != nil {
+				return err
+			}
+		}
+		if err := q.VoidResults(ctx, db.VoidResultsParams{
+			ResetID:    resetID,
+			ChatID:     chatID,
+			GameID:     gameID,
+			PlayedDate: date,
+		}); err != nil {
+			return err
+		}
+		if _, err := q.DeleteTodayResult(ctx, db.DeleteTodayResultParams{
+			ChatID:     chatID,
+			GameID:     gameID,
+			PlayedDate: date,
+		}); err != nil {
+			return err
+		}
+		audit.before["winners"] = resultWinnerIDs(results)
+		return audit.record(ctx, q)
+	})
+	return voided, err
+}
+
+// RestoreResult undoes the latest reset of a game's day on behalf of
+// userID, as long as the day was not rolled again. The voided results come
+// back with their wins, allowances and badges, and the day's open bets are
+// settled by them again. The audit entry, made with auditDay, is recorded
+// with the restored winners as its after state. It returns the restored
+// results, none when there was no reset to undo.
+func (s *Storage) RestoreResult(ctx context.Context, chatID, gameID int64, date string, userID int64, audit *auditEntry) ([]db.GetTodayResultsRow, error) {
+	var restored []db.GetTodayResultsRow
+	err := s.InTx(ctx, func(q *db.Queries) error {
+		resetID, err := q.GetLastReset(ctx, db.GetLastResetParams{
+			ChatID:     chatID,
+			GameID:     gameID,
+			PlayedDate: date,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		params := db.GetTodayResultsParams{ChatID: chatID, GameID: gameID, PlayedDate: date}
+		if current, err := q.GetTodayResults(ctx, params); err != nil {
+			return err
+		} else if len(current) > 0 {
+			return errRolledAgain
+		}
+
+		if err := q.RestoreResults(ctx, resetID); err != nil {
+			return err
+		}
+		if err := q.DeleteVoidedResults(ctx, resetID); err != nil {
+			return err
+		}
+		if err := q.RestoreResetEntries(ctx, sql.NullInt64{Int64: resetID, Valid: true}); err != nil {
+			return err
+		}
+		if err := q.RestoreResetAchievements(ctx, sql.NullInt64{Int64: resetID, Valid: true}); err != nil {
+			return err
+		}
+		if err := q.MarkResetUndone(ctx, db.MarkResetUndoneParams{
+			UndoneBy: sql.NullInt64{Int64: userID, Valid: true},
+			ID:       resetID,
+		}); err != nil {
+			return err
+		}
+
+		if restored, err = q.GetTodayResults(ctx, params); err != nil {
+			return err
+		}
+		if gameID == mainGameID && len(restored) > 0 {
+			if err := resettleRestoredBets(ctx, q, chatID, date, restored); err != nil {
+				return err
+			}
+		}
+		audit.after["winners"] = resultWinnerIDs(restored)
+		return audit.record(ctx, q)
+	})
+	return restored, err
+}
+
+var (
+	errAlreadyWinner = errors.New("already a winner")
+	errIsLoser       = errors.New("the day's loser")
+)
+
+// SetWinner replaces the top winner of a game's day with user, who must
+// not have won or lost that day already. The drawn winner is kept so
+// /verify can tell the result was overridden. For the main game the win
+// points move to the new winner and the bets of the roll are settled
+// again. The audit entry is recorded with the replaced winner's name added
+// to its before state. It returns that name; ok is false when the day has
+// no result.
+func (s *Storage) SetWinner(ctx context.Context, chatID, gameID int64, date string, user *User, audit *auditEntry) (previous string, ok bool, err error) {
+	err = s.InTx(ctx, func(q *db.Queries) error {
+		top, err := q.GetTopResult(ctx, db.GetTopResultParams{
+			ChatID:     chatID,
+			GameID:     gameID,
+			PlayedDate: date,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ok, previous = true, top.WinnerName.String
+
+		winnerIDs, err := q.GetResultWinners(ctx, db.GetResultWinnersParams{
+			ChatID:     chatID,
+			GameID:     gameID,
+			PlayedDate: date,
+		})
+		if err != nil {
+			return err
+		}
+		if slices.Contains(winnerIDs, user.ID) {
+			return errAlreadyWinner
+		}
+		if top.LoserID.Valid && top.LoserID.Int64 == user.ID {
+			return errIsLoser
+		}
+
+		if err := q.SetResultWinner(ctx, db.SetResultWinnerParams{
+			UserID:     user.ID,
+			WinnerName: sql.NullString{String: user.FirstName, Valid: true},
+			ID:         top.ID,
+		}); err != nil {
+			return err
+		}
+		if gameID == mainGameID {
+			if err := moveWin(ctx, q, chatID, top.ID, top.UserID, user.ID); err != nil {
+				return err
+			}
+			if err := resettleBets(ctx, q, chatID, top.ID, top.UserID, user.ID, len(winnerIDs)); err != nil {
+				return err
+			}
+		}
+		audit.before["winner"] = previous
+		return audit.record(ctx, q)
+	})
+	return previous, ok, err
+}
+
+// InTx runs fn inside a transaction, committing if it returns nil.
+func (s *Storage) InTx(ctx context.Context, fn func(q *db.Queries) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(s.Queries.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"telegram-chat-bot/db"
+)
+
+func TestNewStorageMigratesColumns(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "old.db")
+
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.ExecContext(ctx, `
+		CREATE TABLE message_sets (id INTEGER PRIMARY KEY AUTOINCREMENT);
+		INSERT INTO message_sets (id) VALUES (1);
+	`); err != nil {
+		t.Fatalf("create old schema: %v", err)
+	}
+	old.Close()
+
+	storage, err := NewStorage(ctx, path)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	defer storage.Close()
+
+	set, err := storage.Queries.GetMessageSet(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetMessageSet: %v", err)
+	}
+	if set.ChatID.Valid {
+		t.Errorf("expected existing set to stay global, got chat %d", set.ChatID.Int64)
+	}
+}
+
+func TestNewStorageBackfillsChatMembers(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "old.db")
+
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.ExecContext(ctx, `
+		CREATE TABLE participants (
+			chat_id INTEGER NOT NULL, user_id INTEGER NOT NULL, first_name TEXT NOT NULL,
+			username TEXT NOT NULL DEFAULT '', joined_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (chat_id, user_id)
+		);
+		CREATE TABLE results (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, chat_id INTEGER NOT NULL, user_id INTEGER NOT NULL,
+			played_date TEXT NOT NULL, created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			winner_name TEXT
+		);
+		INSERT INTO participants (chat_id, user_id, first_name, username) VALUES (100, 1, 'Alice', 'alice');
+		INSERT INTO results (chat_id, user_id, played_date, winner_name) VALUES
+			(100, 1, '2026-01-01', 'Alice'),
+			(100, 2, '2026-01-02', 'Bob'),
+			(100, 3, '2026-01-03', NULL);
+	`); err != nil {
+		t.Fatalf("create old schema: %v", err)
+	}
+	old.Close()
+
+	storage, err := NewStorage(ctx, path)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	defer storage.Close()
+
+	stats, err := storage.Queries.GetStats(ctx, db.GetStatsParams{ChatID: 100})
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected Alice and Bob, got %+v", stats)
+	}
+	for _, s := range stats {
+		switch s.FirstName {
+		case "Alice":
+			if !s.Active || s.Username != "alice" {
+				t.Errorf("expected Alice to be an active member, got %+v", s)
+			}
+		case "Bob":
+			if s.Active {
+				t.Errorf("expected Bob to be a former member, got %+v", s)
+			}
+		default:
+			t.Errorf("unexpected member %+v", s)
+		}
+	}
+}
+
+func TestNewStorageKeysResultsByGame(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "old.db")
+
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.ExecContext(ctx, `
+		CREATE TABLE results (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, chat_id INTEGER NOT NULL, user_id INTEGER NOT NULL,
+			played_date TEXT NOT NULL, created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE UNIQUE INDEX idx_results_chat_date ON results (chat_id, played_date);
+		INSERT INTO results (chat_id, user_id, played_date) VALUES (100, 1, '2026-01-15');
+	`); err != nil {
+		t.Fatalf("create old schema: %v", err)
+	}
+	old.Close()
+
+	storage, err := NewStorage(ctx, path)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	defer storage.Close()
+
+	if _, err := storage.Queries.SaveResult(ctx, db.SaveResultParams{
+		ChatID: 100, GameID: 1, UserID: 2, PlayedDate: "2026-01-15",
+	}); err != nil {
+		t.Fatalf("expected a second game on the same day: %v", err)
+	}
+	if _, err := storage.Queries.SaveResult(ctx, db.SaveResultParams{
+		ChatID: 100, UserID: 2, PlayedDate: "2026-01-15", Rank: 1,
+	}); err == nil {
+		t.Error("expected the main game to keep one winner per rank and day")
+	}
+	if _, err := storage.Queries.SaveResult(ctx, db.SaveResultParams{
+		ChatID: 100, UserID: 2, PlayedDate: "2026-01-15", Rank: 2,
+	}); err != nil {
+		t.Errorf("expected a second winner on the same day: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"telegram-chat-bot/db"
+)
+
+// Strategy names stored in chat_settings.strategy.
+const (
+	StrategyUniform  = "uniform"
+	StrategyCooldown = "cooldown"
+	StrategyInverse  = "inverse"
+	StrategyDeck     = "deck"
+)
+
+var strategyNames = []string{StrategyUniform, StrategyCooldown, StrategyInverse, StrategyDeck}
+
+// Strategy selects the winner of a draw. participants is never empty and
+// history lists the chat's past results, newest first.
+type Strategy interface {
+	Pick(rng *rand.Rand, participants []db.GetParticipantsRow, history []db.GetWinHistoryRow, date string) db.GetParticipantsRow
+}
+
+func strategyFor(settings db.ChatSetting) Strategy {
+	switch settings.Strategy {
+	case StrategyCooldown:
+		return cooldownStrategy{days: int(settings.CooldownDays)}
+	case StrategyInverse:
+		return inverseWinsStrategy{}
+	case StrategyDeck:
+		return deckStrategy{}
+	default:
+		return uniformStrategy{}
+	}
+}
+
+// uniformStrategy gives every participant the same odds.
+type uniformStrategy struct{}
+
+func (uniformStrategy) Pick(rng *rand.Rand, participants []db.GetParticipantsRow, _ []db.GetWinHistoryRow, _ string) db.GetParticipantsRow {
+	return participants[rng.IntN(len(participants))]
+}
+
+// cooldownStrategy excludes everyone who won in the last days days. If that
+// leaves nobody, all participants are eligible again.
+type cooldownStrategy struct {
+	days int
+}
+
+func (s cooldownStrategy) Pick(rng *rand.Rand, participants []db.GetParticipantsRow, history []db.GetWinHistoryRow, date string) db.GetParticipantsRow {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return uniformStrategy{}.Pick(rng, participants, history, date)
+	}
+	since := day.AddDate(0, 0, -s.days).Format("2006-01-02")
+
+	recent := make(map[int64]bool)
+	for _, r := range history {
+		if r.PlayedDate < since {
+			break
+		}
+		recent[r.UserID] = true
+	}
+
+	var eligible []db.GetParticipantsRow
+	for _, p := range participants {
+		if !recent[p.UserID] {
+			eligible = append(eligible, p)
+		}
+	}
+	if len(eligible) == 0 {
+		eligible = participants
+	}
+	return eligible[rng.IntN(len(eligible))]
+}
+
+// inverseWinsStrategy weights each participant by 1/(1+wins), so frequent
+// winners still can win but less often.
+type inverseWinsStrategy struct{}
+
+func (inverseWinsStrategy) Pick(rng *rand.Rand, participants []db.GetParticipantsRow, history []db.GetWinHistoryRow, _ string) db.GetParticipantsRow {
+	wins := make(map[int64]int)
+	for _, r := range history {
+		wins[r.UserID]++
+	}
+
+	weights := make([]float64, len(participants))
+	var total float64
+	for i, p := range participants {
+		weights[i] = 1 / float64(1+wins[p.UserID])
+		total += weights[i]
+	}
+
+	n := rng.Float64() * total
+	for i, w := range weights {
+		if n < w {
+			return participants[i]
+		}
+		n -= w
+	}
+	return participants[len(participants)-1]
+}
+
+// deckStrategy deals every participant one win per round: nobody wins twice
+// until everyone has won in the current round, and each round is dealt in
+// a fresh random order.
+type deckStrategy struct{}
+
+func (deckStrategy) Pick(rng *rand.Rand, participants []db.GetParticipantsRow, history []db.GetWinHistoryRow, _ string) db.GetParticipantsRow {
+	member := make(map[int64]bool, len(participants))
+	for _, p := range participants {
+		member[p.UserID] = true
+	}
+
+	// Replay the wins oldest first, starting a new round whenever everyone
+	// still playing has been dealt. Former players are not in the deck.
+	dealt := make(map[int64]bool)
+	for i := len(history) - 1; i >= 0; i-- {
+		id := history[i].UserID
+		if !member[id] {
+			continue
+		}
+		if dealt[id] {
+			// A repeat from before the deck was chosen starts a new round.
+			clear(dealt)
+		}
+		dealt[id] = true
+		if len(dealt) == len(participants) {
+			clear(dealt)
+		}
+	}
+
+	var deck []db.GetParticipantsRow
+	for _, p := range participants {
+		if !dealt[p.UserID] {
+			deck = append(deck, p)
+		}
+	}
+	return deck[rng.IntN(len(deck))]
+}
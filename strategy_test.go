@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"telegram-chat-bot/db"
+)
+
+func testParticipants(n int) []db.GetParticipantsRow {
+	ps := make([]db.GetParticipantsRow, n)
+	for i := range ps {
+		ps[i] = db.GetParticipantsRow{UserID: int64(i + 1), FirstName: fmt.Sprintf("P%d", i+1)}
+	}
+	return ps
+}
+
+// simulate runs days draws with s, feeding each winner back into history.
+func simulate(s Strategy, participants []db.GetParticipantsRow, days int) []db.GetWinHistoryRow {
+	rng := rand.New(rand.NewPCG(1, 2))
+	var history []db.GetWinHistoryRow
+	for day := range days {
+		date := fmt.Sprintf("2026-01-%02d", day+1)
+		winner := s.Pick(rng, participants, history, date)
+		history = append([]db.GetWinHistoryRow{{UserID: winner.UserID, PlayedDate: date}}, history...)
+	}
+	return history
+}
+
+func TestUniformStrategy(t *testing.T) {
+	history := simulate(uniformStrategy{}, testParticipants(3), 30)
+
+	wins := map[int64]int{}
+	for _, r := range history {
+		wins[r.UserID]++
+	}
+	if len(wins) != 3 {
+		t.Errorf("expected every participant to win at least once in 30 draws, got %v", wins)
+	}
+}
+
+func TestCooldownStrategy(t *testing.T) {
+	history := simulate(cooldownStrategy{days: 2}, testParticipants(4), 30)
+
+	// Oldest first: nobody may win again within two days of a win.
+	for i := range history {
+		for j := i + 1; j < len(history) && j <= i+2; j++ {
+			if history[i].UserID == history[j].UserID {
+				t.Fatalf("user %d won on %s and %s", history[i].UserID, history[j].PlayedDate, history[i].PlayedDate)
+			}
+		}
+	}
+}
+
+func TestCooldownStrategyFallsBackWhenEveryoneCoolsDown(t *testing.T) {
+	history := simulate(cooldownStrategy{days: 5}, testParticipants(2), 4)
+	if len(history) != 4 {
+		t.Fatalf("expected a winner every day, got %d", len(history))
+	}
+}
+
+func TestInverseWinsStrategy(t *testing.T) {
+	participants := testParticipants(2)
+	var history []db.GetWinHistoryRow
+	for range 9 {
+		history = append(history, db.GetWinHistoryRow{UserID: 1, PlayedDate: "2025-12-01"})
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	wins := map[int64]int{}
+	for range 1000 {
+		wins[inverseWinsStrategy{}.Pick(rng, participants, history, "2026-01-01").UserID]++
+	}
+	// Odds are 1/10 against 1/1, so user 2 should win about 91% of draws.
+	if wins[2] < 850 {
+		t.Errorf("expected the player without wins to dominate, got %v", wins)
+	}
+}
+
+func TestDeckStrategy(t *testing.T) {
+	history := simulate(deckStrategy{}, testParticipants(4), 40)
+
+	// Oldest first, every block of four draws is one full round, and the
+	// rounds are not all dealt in the same order.
+	orders := map[string]bool{}
+	for start := len(history) - 4; start >= 0; start -= 4 {
+		seen := map[int64]bool{}
+		order := ""
+		for _, r := range history[start : start+4] {
+			if seen[r.UserID] {
+				t.Fatalf("user %d won twice in a round: %+v", r.UserID, history)
+			}
+			seen[r.UserID] = true
+			order += fmt.Sprint(r.UserID)
+		}
+		orders[order] = true
+	}
+	if len(orders) < 2 {
+		t.Errorf("expected the rounds to be shuffled, every one was dealt as %v", orders)
+	}
+}
+
+func TestDeckStrategyNewcomer(t *testing.T) {
+	participants := testParticipants(3)
+	// Users 1 and 2 won the current round; user 3 just joined.
+	history := []db.GetWinHistoryRow{
+		{UserID: 2, PlayedDate: "2026-01-02"},
+		{UserID: 1, PlayedDate: "2026-01-01"},
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 20 {
+		if got := (deckStrategy{}).Pick(rng, participants, history, "2026-01-03"); got.UserID != 3 {
+			t.Fatalf("expected the only undealt participant, got %d", got.UserID)
+		}
+	}
+}
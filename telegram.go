@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -32,19 +34,76 @@ type MessageEntity struct {
 	Type   string `json:"type"`
 	Offset int    `json:"offset"`
 	Length int    `json:"length"`
+	URL    string `json:"url,omitempty"`
+	User   *User  `json:"user,omitempty"`
+}
+
+type Sticker struct {
+	FileID string `json:"file_id"`
+}
+
+type Animation struct {
+	FileID string `json:"file_id"`
+}
+
+type PhotoSize struct {
+	FileID string `json:"file_id"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
 }
 
 type Message struct {
-	MessageID int64           `json:"message_id"`
-	From      *User           `json:"from,omitempty"`
-	Chat      Chat            `json:"chat"`
-	Text      string          `json:"text,omitempty"`
-	Entities  []MessageEntity `json:"entities,omitempty"`
+	MessageID      int64           `json:"message_id"`
+	From           *User           `json:"from,omitempty"`
+	Chat           Chat            `json:"chat"`
+	Text           string          `json:"text,omitempty"`
+	Entities       []MessageEntity `json:"entities,omitempty"`
+	ReplyToMessage *Message        `json:"reply_to_message,omitempty"`
+	Sticker        *Sticker        `json:"sticker,omitempty"`
+	Animation      *Animation      `json:"animation,omitempty"`
+	Photo          []PhotoSize     `json:"photo,omitempty"`
+}
+
+type CallbackQuery struct {
+	ID      string   `json:"id"`
+	From    User     `json:"from"`
+	Message *Message `json:"message,omitempty"`
+	Data    string   `json:"data,omitempty"`
 }
 
 type Update struct {
-	UpdateID int64    `json:"update_id"`
-	Message  *Message `json:"message,omitempty"`
+	UpdateID      int64              `json:"update_id"`
+	Message       *Message           `json:"message,omitempty"`
+	CallbackQuery *CallbackQuery     `json:"callback_query,omitempty"`
+	ChatMember    *ChatMemberUpdated `json:"chat_member,omitempty"`
+	MyChatMember  *ChatMemberUpdated `json:"my_chat_member,omitempty"`
+}
+
+// ChatMember is someone's membership of a chat. IsMember only applies to
+// restricted members.
+type ChatMember struct {
+	Status   string `json:"status"`
+	User     User   `json:"user"`
+	IsMember bool   `json:"is_member,omitempty"`
+}
+
+// ChatMemberUpdated reports a change of someone's membership; From is who
+// made it. my_chat_member updates are about the bot itself.
+type ChatMemberUpdated struct {
+	Chat          Chat       `json:"chat"`
+	From          User       `json:"from"`
+	Date          int64      `json:"date"`
+	OldChatMember ChatMember `json:"old_chat_member"`
+	NewChatMember ChatMember `json:"new_chat_member"`
+}
+
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data,omitempty"`
+}
+
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
 }
 
 type ReplyParameters struct {
@@ -52,10 +111,58 @@ type ReplyParameters struct {
 }
 
 type SendMessageRequest struct {
-	ChatID          int64            `json:"chat_id"`
-	Text            string           `json:"text"`
-	ParseMode       string           `json:"parse_mode,omitempty"`
-	ReplyParameters *ReplyParameters `json:"reply_parameters,omitempty"`
+	ChatID          int64                 `json:"chat_id"`
+	Text            string                `json:"text"`
+	ParseMode       string                `json:"parse_mode,omitempty"`
+	ReplyParameters *ReplyParameters      `json:"reply_parameters,omitempty"`
+	ReplyMarkup     *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+type EditMessageTextRequest struct {
+	ChatID      int64                 `json:"chat_id"`
+	MessageID   int64                 `json:"message_id"`
+	Text        string                `json:"text"`
+	ParseMode   string                `json:"parse_mode,omitempty"`
+	ReplyMarkup *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+type AnswerCallbackQueryRequest struct {
+	CallbackQueryID string `json:"callback_query_id"`
+	Text            string `json:"text,omitempty"`
+}
+
+type SendStickerRequest struct {
+	ChatID  int64  `json:"chat_id"`
+	Sticker string `json:"sticker"`
+}
+
+type SendAnimationRequest struct {
+	ChatID    int64  `json:"chat_id"`
+	Animation string `json:"animation"`
+	Caption   string `json:"caption,omitempty"`
+	ParseMode string `json:"parse_mode,omitempty"`
+}
+
+type SendPhotoRequest struct {
+	ChatID    int64  `json:"chat_id"`
+	Photo     string `json:"photo"`
+	Caption   string `json:"caption,omitempty"`
+	ParseMode string `json:"parse_mode,omitempty"`
+}
+
+// SendPhotoUploadRequest sends a photo from memory rather than by file_id
+// or URL, which needs a multipart upload.
+type SendPhotoUploadRequest struct {
+	ChatID    int64
+	Photo     []byte
+	Filename  string
+	Caption   string
+	ParseMode string
+}
+
+type SendDiceRequest struct {
+	ChatID int64  `json:"chat_id"`
+	Emoji  string `json:"emoji,omitempty"`
 }
 
 type BotClient struct {
@@ -85,6 +192,40 @@ func (c *BotClient) doRequest(ctx context.Context, method string, body any) (jso
 	}
 	req.Header.Set("Content-Type", "application/json")
 
+	return c.do(req)
+}
+
+// doMultipart posts fields and a single file as multipart/form-data.
+func (c *BotClient) doMultipart(ctx context.Context, method string, fields map[string]string, fileField, filename string, data []byte) (json.RawMessage, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := mw.WriteField(name, value); err != nil {
+			return nil, fmt.Errorf("write field %s: %w", name, err)
+		}
+	}
+	fw, err := mw.CreateFormFile(fileField, filename)
+	if err != nil {
+		return nil, fmt.Errorf("create form file: %w", err)
+	}
+	if _, err := fw.Write(data); err != nil {
+		return nil, fmt.Errorf("write form file: %w", err)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("close multipart: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/%s", c.baseURL, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	return c.do(req)
+}
+
+func (c *BotClient) do(req *http.Request) (json.RawMessage, error) {
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("do request: %w", err)
@@ -129,7 +270,7 @@ func (c *BotClient) GetUpdates(ctx context.Context, offset int64, timeout int) (
 	}{
 		Offset:         offset,
 		Timeout:        timeout,
-		AllowedUpdates: []string{"message"},
+		AllowedUpdates: []string{"message", "callback_query", "chat_member", "my_chat_member"},
 	}
 
 	result, err := c.doRequest(ctx, "getUpdates", body)
@@ -148,3 +289,45 @@ func (c *BotClient) SendMessage(ctx context.Context, req SendMessageRequest) err
 	_, err := c.doRequest(ctx, "sendMessage", req)
 	return err
 }
+
+func (c *BotClient) SendSticker(ctx context.Context, req SendStickerRequest) error {
+	_, err := c.doRequest(ctx, "sendSticker", req)
+	return err
+}
+
+func (c *BotClient) SendAnimation(ctx context.Context, req SendAnimationRequest) error {
+	_, err := c.doRequest(ctx, "sendAnimation", req)
+	return err
+}
+
+func (c *BotClient) SendPhoto(ctx context.Context, req SendPhotoRequest) error {
+	_, err := c.doRequest(ctx, "sendPhoto", req)
+	return err
+}
+
+func (c *BotClient) SendPhotoUpload(ctx context.Context, req SendPhotoUploadRequest) error {
+	fields := map[string]string{"chat_id": strconv.FormatInt(req.ChatID, 10)}
+	if req.Caption != "" {
+		fields["caption"] = req.Caption
+	}
+	if req.ParseMode != "" {
+		fields["parse_mode"] = req.ParseMode
+	}
+	_, err := c.doMultipart(ctx, "sendPhoto", fields, "photo", req.Filename, req.Photo)
+	return err
+}
+
+func (c *BotClient) SendDice(ctx context.Context, req SendDiceRequest) error {
+	_, err := c.doRequest(ctx, "sendDice", req)
+	return err
+}
+
+func (c *BotClient) EditMessageText(ctx context.Context, req EditMessageTextRequest) error {
+	_, err := c.doRequest(ctx, "editMessageText", req)
+	return err
+}
+
+func (c *BotClient) AnswerCallbackQuery(ctx context.Context, req AnswerCallbackQueryRequest) error {
+	_, err := c.doRequest(ctx, "answerCallbackQuery", req)
+	return err
+}
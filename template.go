@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"telegram-chat-bot/db"
+)
+
+// Message set lines may reference these placeholders as {name}. The legacy
+// %s form is still accepted as an alias for {mention}.
+var templatePlaceholders = []string{
+	"winner",        // winner's first name
+	"mention",       // clickable mention of the winner
+	"count",         // number of participants in the draw
+	"wins",          // winner's total wins in this chat, including today
+	"streak",        // consecutive days the winner has won, ending today
+	"random",        // a random participant other than the winner
+	"date",          // date of the draw
+	"winners",       // numbered mentions of all winners, in rank order
+	"loser",         // loser's first name, in dual mode
+	"loser_mention", // clickable mention of the loser, in dual mode
+}
+
+var (
+	placeholderRe = regexp.MustCompile(`\{(\w+)\}`)
+	// templateRe also matches the legacy %s, so a body is rendered in a
+	// single pass and names such as "{loser}" are never expanded.
+	templateRe = regexp.MustCompile(`%s|\{(\w+)\}`)
+)
+
+type templateVars struct {
+	Winner  string
+	Mention string
+	Count   int
+	Wins    int
+	Streak  int
+	Random  string
+	Date    string
+	Winners []string // mentions in rank order
+
+	// Loser and LoserMention are empty unless a loser was drawn.
+	Loser        string
+	LoserMention string
+}
+
+func (v templateVars) lookup(name string) (string, bool) {
+	switch name {
+	case "winner":
+		return v.Winner, true
+	case "mention":
+		return v.Mention, true
+	case "count":
+		return strconv.Itoa(v.Count), true
+	case "wins":
+		return strconv.Itoa(v.Wins), true
+	case "streak":
+		return strconv.Itoa(v.Streak), true
+	case "random":
+		return v.Random, true
+	case "date":
+		return v.Date, true
+	case "winners":
+		lines := make([]string, len(v.Winners))
+		for i, w := range v.Winners {
+			lines[i] = fmt.Sprintf("%d. %s", i+1, w)
+		}
+		return strings.Join(lines, "\n"), true
+	case "loser":
+		return v.Loser, true
+	case "loser_mention":
+		return v.LoserMention, true
+	}
+	return "", false
+}
+
+// renderTemplate substitutes placeholders in body. Unknown placeholders are
+// left as is; validateTemplate rejects them when lines are stored.
+func renderTemplate(body string, vars templateVars) string {
+	return templateRe.ReplaceAllStringFunc(body, func(m string) string {
+		if m == "%s" {
+			return vars.Mention
+		}
+		if val, ok := vars.lookup(m[1 : len(m)-1]); ok {
+			return val
+		}
+		return m
+	})
+}
+
+// validateTemplate returns the first unknown placeholder in body, or "" if
+// all placeholders are known.
+func validateTemplate(body string) string {
+	for _, m := range placeholderRe.FindAllStringSubmatch(body, -1) {
+		if _, ok := (templateVars{}).lookup(m[1]); !ok {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// mentionsWinner reports whether any step of a set names the winner, either
+// in a text line or in a media caption.
+func mentionsWinner(steps []db.GetSetMessagesRow) bool {
+	return stepsMention(steps, "%s", "{winner}", "{mention}", "{winners}")
+}
+
+// mentionsAllWinners reports whether any step of a set names every winner.
+func mentionsAllWinners(steps []db.GetSetMessagesRow) bool {
+	return stepsMention(steps, "{winners}")
+}
+
+// mentionsLoser reports whether any step of a set names the loser.
+func mentionsLoser(steps []db.GetSetMessagesRow) bool {
+	return stepsMention(steps, "{loser}", "{loser_mention}")
+}
+
+func stepsMention(steps []db.GetSetMessagesRow, placeholders ...string) bool {
+	for _, step := range steps {
+		text := step.Body
+		if step.Kind != StepText {
+			text = step.Caption
+		}
+		for _, p := range placeholders {
+			if strings.Contains(text, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func placeholderList() string {
+	names := make([]string, len(templatePlaceholders))
+	for i, name := range templatePlaceholders {
+		names[i] = "{" + name + "}"
+	}
+	return strings.Join(names, ", ")
+}
+
+// winStreak counts consecutive days ending on today, given win dates sorted
+// newest first.
+func winStreak(dates []string, today string) int {
+	day, err := time.Parse("2006-01-02", today)
+	if err != nil {
+		return 0
+	}
+
+	streak := 0
+	for _, d := range dates {
+		want := day.Format("2006-01-02")
+		if d > want {
+			continue
+		}
+		if d != want {
+			break
+		}
+		streak++
+		day = day.AddDate(0, 0, -1)
+	}
+	return streak
+}
+
+func templateError(name string) error {
+	return fmt.Errorf("unknown placeholder {%s}, available: %s", name, placeholderList())
+}
@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func TestRenderTemplate(t *testing.T) {
+	vars := templateVars{
+		Winner:  "Alice",
+		Mention: "<b>Alice</b>",
+		Count:   3,
+		Wins:    7,
+		Streak:  2,
+		Random:  "Bob",
+		Date:    "2026-01-15",
+	}
+
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"{winner} won", "Alice won"},
+		{"Hail %s!", "Hail <b>Alice</b>!"},
+		{"{mention}: {wins} wins, {streak} in a row", "<b>Alice</b>: 7 wins, 2 in a row"},
+		{"{count} players on {date}, sorry {random}", "3 players on 2026-01-15, sorry Bob"},
+		{"100% sure, {unknown} {}", "100% sure, {unknown} {}"},
+	}
+
+	for _, tt := range tests {
+		if got := renderTemplate(tt.body, vars); got != tt.want {
+			t.Errorf("renderTemplate(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+
+	// Names that look like placeholders are not expanded.
+	vars = templateVars{Winner: "{loser}", Mention: "<b>{count}</b>", Count: 3, Loser: "Bob"}
+	if got, want := renderTemplate("%s / {winner} / {loser}", vars), "<b>{count}</b> / {loser} / Bob"; got != want {
+		t.Errorf("renderTemplate() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	if name := validateTemplate("{winner} and {random} on {date}, 50% {"); name != "" {
+		t.Errorf("expected valid template, got unknown %q", name)
+	}
+	if name := validateTemplate("{winner} beat {loser}"); name != "" {
+		t.Errorf("expected valid template, got unknown %q", name)
+	}
+	if name := validateTemplate("{winner} beat {champion}"); name != "champion" {
+		t.Errorf("expected unknown placeholder champion, got %q", name)
+	}
+}
+
+func TestWinStreak(t *testing.T) {
+	tests := []struct {
+		name  string
+		dates []string
+		want  int
+	}{
+		{"no wins", nil, 0},
+		{"today only", []string{"2026-01-15"}, 1},
+		{"three in a row", []string{"2026-01-15", "2026-01-14", "2026-01-13", "2026-01-10"}, 3},
+		{"across month", []string{"2026-01-15", "2026-01-01", "2025-12-31"}, 1},
+		{"not today", []string{"2026-01-14", "2026-01-13"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := winStreak(tt.dates, "2026-01-15"); got != tt.want {
+				t.Errorf("winStreak() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
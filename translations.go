@@ -9,21 +9,168 @@ import (
 )
 
 const (
-	TrJoinSuccess        = "join_success"
-	TrLeaveSuccess       = "leave_success"
-	TrLeaveNotInGame     = "leave_not_in_game"
-	TrNoParticipants     = "no_participants"
-	TrAlreadyPlayed      = "already_played"
-	TrFallbackWinner     = "fallback_winner"
-	TrStatsHeader        = "stats_header"
-	TrStatsYearHeader    = "stats_year_header"
-	TrStatsInvalidYear   = "stats_invalid_year"
-	TrStatsNoResults     = "stats_no_results"
-	TrStatsLine          = "stats_line"
-	TrParticipantsHeader = "participants_header"
-	TrResetNoResult      = "reset_no_result"
-	TrResetSuccess       = "reset_success"
-	TrUnknownUser        = "unknown_user"
+	TrJoinSuccess            = "join_success"
+	TrLeaveSuccess           = "leave_success"
+	TrLeaveNotInGame         = "leave_not_in_game"
+	TrNoParticipants         = "no_participants"
+	TrAlreadyPlayed          = "already_played"
+	TrFallbackWinner         = "fallback_winner"
+	TrStatsHeader            = "stats_header"
+	TrStatsYearHeader        = "stats_year_header"
+	TrStatsNoResults         = "stats_no_results"
+	TrStatsLine              = "stats_line"
+	TrParticipantsHeader     = "participants_header"
+	TrResetNoResult          = "reset_no_result"
+	TrResetSuccess           = "reset_success"
+	TrUnknownUser            = "unknown_user"
+	TrSetCreated             = "set_created"
+	TrSetLineAdded           = "set_line_added"
+	TrSetAddLineUsage        = "set_addline_usage"
+	TrSetUnknownPlaceholder  = "set_unknown_placeholder"
+	TrSetAddMediaUsage       = "set_addmedia_usage"
+	TrSetInvalidDice         = "set_invalid_dice"
+	TrSetInvalidID           = "set_invalid_id"
+	TrSetNotFound            = "set_not_found"
+	TrSetDeleted             = "set_deleted"
+	TrSetEmpty               = "set_empty"
+	TrSetsHeader             = "sets_header"
+	TrSetsLine               = "sets_line"
+	TrSetsGlobalLine         = "sets_global_line"
+	TrSetsNone               = "sets_none"
+	TrSetsGlobalOff          = "sets_global_off"
+	TrGlobalSetsUsage        = "global_sets_usage"
+	TrGlobalSetsEnabled      = "global_sets_enabled"
+	TrGlobalSetsDisabled     = "global_sets_disabled"
+	TrSetRulesUsage          = "set_rules_usage"
+	TrSetRulesUpdated        = "set_rules_updated"
+	TrSetRulesDefault        = "set_rules_default"
+	TrSettingsHeader         = "settings_header"
+	TrSettingsLine           = "settings_line"
+	TrSettingUnknown         = "setting_unknown"
+	TrSettingInvalid         = "setting_invalid"
+	TrSettingUpdated         = "setting_updated"
+	TrVerifyUsage            = "verify_usage"
+	TrVerifyNoResult         = "verify_no_result"
+	TrVerifyResult           = "verify_result"
+	TrVerifyOK               = "verify_ok"
+	TrVerifyHashMismatch     = "verify_hash_mismatch"
+	TrVerifyMalformed        = "verify_malformed"
+	TrVerifyWinnerMismatch   = "verify_winner_mismatch"
+	TrVerifyNext             = "verify_next"
+	TrStatsPersonal          = "stats_personal"
+	TrStatsNever             = "stats_never"
+	TrStatsUnknownPlayer     = "stats_unknown_player"
+	TrStatsInvalidPeriod     = "stats_invalid_period"
+	TrStatsMonthHeader       = "stats_month_header"
+	TrStatsWeekHeader        = "stats_week_header"
+	TrStatsRangeHeader       = "stats_range_header"
+	TrStatsNoResultsPeriod   = "stats_no_results_period"
+	TrStatsFormerPlayer      = "stats_former_player"
+	TrHistoryHeader          = "history_header"
+	TrHistoryPeriodHeader    = "history_period_header"
+	TrHistoryLine            = "history_line"
+	TrHistoryPage            = "history_page"
+	TrHistoryNewer           = "history_newer"
+	TrHistoryOlder           = "history_older"
+	TrHistoryEmpty           = "history_empty"
+	TrHistoryUsage           = "history_usage"
+	TrChartCaption           = "chart_caption"
+	TrChartAllTime           = "chart_all_time"
+	TrChartCalendarCaption   = "chart_calendar_caption"
+	TrChartNoData            = "chart_no_data"
+	TrChartUsage             = "chart_usage"
+	TrAchievementFirstWin    = "achievement_first_win"
+	TrAchievementStreak3     = "achievement_streak_3"
+	TrAchievementWins10      = "achievement_wins_10"
+	TrAchievementDrought100  = "achievement_drought_100"
+	TrAchievementAnniversary = "achievement_anniversary"
+	TrAchievementAwarded     = "achievement_awarded"
+	TrAchievementsHeader     = "achievements_header"
+	TrAchievementsLine       = "achievements_line"
+	TrAchievementsEmpty      = "achievements_empty"
+	TrGameUnknown            = "game_unknown"
+	TrGamesEmpty             = "games_empty"
+	TrGamesHeader            = "games_header"
+	TrGamesShared            = "games_shared"
+	TrGamesOwn               = "games_own"
+	TrGamesLine              = "games_line"
+	TrAddGameUsage           = "addgame_usage"
+	TrAddGameInvalidCommand  = "addgame_invalid_command"
+	TrAddGameExists          = "addgame_exists"
+	TrAddGameCreated         = "addgame_created"
+	TrDelGameUsage           = "delgame_usage"
+	TrDelGameDeleted         = "delgame_deleted"
+	TrGameSharedList         = "game_shared_list"
+	TrGameJoined             = "game_joined"
+	TrGameAlreadyJoined      = "game_already_joined"
+	TrGameLeft               = "game_left"
+	TrGameNotJoined          = "game_not_joined"
+	TrFallbackLoser          = "fallback_loser"
+	TrAlreadyPlayedLoser     = "already_played_loser"
+	TrStatsLosersHeader      = "stats_losers_header"
+	TrStatsLoserLine         = "stats_loser_line"
+	TrVerifyLoserOK          = "verify_loser_ok"
+	TrVerifyLoserMismatch    = "verify_loser_mismatch"
+	TrVerifyNoLoser          = "verify_no_loser"
+	TrFallbackWinners        = "fallback_winners"
+	TrAlreadyPlayedWinners   = "already_played_winners"
+	TrWinnersUsage           = "winners_usage"
+	TrWinnersShow            = "winners_show"
+	TrWinnersUpdated         = "winners_updated"
+	TrMainGame               = "main_game"
+	TrBalance                = "balance"
+	TrRichestHeader          = "richest_header"
+	TrRichestLine            = "richest_line"
+	TrRichestEmpty           = "richest_empty"
+	TrBetUsage               = "bet_usage"
+	TrBetExists              = "bet_exists"
+	TrBetInsufficient        = "bet_insufficient"
+	TrBetsClosed             = "bets_closed"
+	TrBetPlaced              = "bet_placed"
+	TrBetsHeader             = "bets_header"
+	TrBetWon                 = "bet_won"
+	TrBetLost                = "bet_lost"
+	TrBetRefunded            = "bet_refunded"
+	TrDuelUsage              = "duel_usage"
+	TrDuelSelf               = "duel_self"
+	TrDuelNotPlaying         = "duel_not_playing"
+	TrDuelChallenge          = "duel_challenge"
+	TrDuelAccept             = "duel_accept"
+	TrDuelDecline            = "duel_decline"
+	TrDuelNotYours           = "duel_not_yours"
+	TrDuelClosed             = "duel_closed"
+	TrDuelExpired            = "duel_expired"
+	TrDuelDeclined           = "duel_declined"
+	TrDuelResult             = "duel_result"
+	TrDuelsHeader            = "duels_header"
+	TrDuelsLine              = "duels_line"
+	TrDuelsEmpty             = "duels_empty"
+	TrKickUsage              = "kick_usage"
+	TrKickSuccess            = "kick_success"
+	TrKickNotPlaying         = "kick_not_playing"
+	TrAddUsage               = "add_usage"
+	TrAddSuccess             = "add_success"
+	TrAddAlready             = "add_already"
+	TrSetWinnerUsage         = "setwinner_usage"
+	TrSetWinnerNoResult      = "setwinner_no_result"
+	TrSetWinnerAlready       = "setwinner_already"
+	TrSetWinnerSuccess       = "setwinner_success"
+	TrResetLimit             = "reset_limit"
+	TrUndoNothing            = "undo_nothing"
+	TrUndoRolledAgain        = "undo_rolled_again"
+	TrUndoSuccess            = "undo_success"
+	TrAuditUsage             = "audit_usage"
+	TrAuditEmpty             = "audit_empty"
+	TrAuditHeader            = "audit_header"
+	TrAuditLine              = "audit_line"
+	TrSetWinnerLoser         = "setwinner_loser"
+	TrVerifyOverridden       = "verify_overridden"
+	TrBalanceUsage           = "balance_usage"
+	TrChartTitle             = "chart_title"
+	TrChartCalendarTitle     = "chart_calendar_title"
+	TrDuelPending            = "duel_pending"
+	TrAuditCLI               = "audit_cli"
+	TrBetsUniformOnly        = "bets_uniform_only"
 )
 
 type Translator struct {